@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/yongliucc/link-deck/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned when a username and password do not match
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Authenticator checks a username and password and returns the matching user
+type Authenticator interface {
+	// Authenticate returns ErrInvalidCredentials if the credentials are rejected
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// LocalAuthenticator checks passwords stored as bcrypt hashes in the users table
+type LocalAuthenticator struct {
+	Store models.UserStore
+}
+
+// Authenticate checks the password of a local user
+func (a LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	user, err := a.Store.GetUserByUsername(username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Unknown usernames take as long as wrong passwords, so they cannot be told apart
+			models.CheckPasswordHash(password, dummyHash())
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	// Accounts from other providers have no local password
+	if user.AuthProvider != models.AuthProviderLocal {
+		models.CheckPasswordHash(password, dummyHash())
+		return nil, ErrInvalidCredentials
+	}
+	if !models.CheckPasswordHash(password, user.Password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Hashes of another cost still verify, they are replaced by one of the current cost
+	if models.NeedsRehash(user.Password) {
+		if err := a.Store.UpdatePassword(user.ID, password); err != nil {
+			log.Printf("LocalAuthenticator: Failed to rehash the password of user %s: %v", username, err)
+		}
+	}
+
+	return user, nil
+}
+
+var dummy struct {
+	sync.Mutex
+	hash string
+}
+
+// dummyHash returns a bcrypt hash of the current cost to compare passwords with when there is
+// no local password to check, so that takes as long as checking one. The result is ignored.
+func dummyHash() string {
+	dummy.Lock()
+	defer dummy.Unlock()
+
+	// The cost can change, tests lower it
+	if cost, err := bcrypt.Cost([]byte(dummy.hash)); err != nil || cost != models.BcryptCost {
+		hash, err := models.HashPassword("link-deck dummy password")
+		if err != nil {
+			// Only invalid costs fail, which the comparison then skips as well
+			return ""
+		}
+		dummy.hash = hash
+	}
+
+	return dummy.hash
+}
+
+// Chain tries each authenticator in order and returns the first user accepted
+type Chain []Authenticator
+
+// Authenticate returns the user from the first authenticator accepting the credentials
+func (chain Chain) Authenticate(username, password string) (*models.User, error) {
+	for _, authenticator := range chain {
+		user, err := authenticator.Authenticate(username, password)
+		if err == ErrInvalidCredentials {
+			continue
+		}
+		return user, err
+	}
+
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"os"
+	"testing"
+
+	"github.com/yongliucc/link-deck/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	// Hashing at the production cost would make the tests slow
+	models.BcryptCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+// newTestStore returns an in-memory store with a local user carol, closed when the test ends
+func newTestStore(t *testing.T) models.Store {
+	t.Helper()
+
+	store, err := models.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("open memory store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.CreateUser("carol", "carol-password", models.RoleEditor); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	return store
+}
+
+func TestLocalAuthenticator(t *testing.T) {
+	store := newTestStore(t)
+	a := LocalAuthenticator{Store: store}
+
+	if user, err := a.Authenticate("carol", "carol-password"); err != nil || user.Username != "carol" {
+		t.Errorf("authenticate carol %+v, %v", user, err)
+	}
+	for _, credentials := range [][2]string{{"carol", "wrong"}, {"nobody", "carol-password"}} {
+		if _, err := a.Authenticate(credentials[0], credentials[1]); err != ErrInvalidCredentials {
+			t.Errorf("authenticate %v returned %v, want invalid credentials", credentials, err)
+		}
+	}
+}
+
+func TestLocalAuthenticatorRehashesPasswords(t *testing.T) {
+	store := newTestStore(t)
+
+	// A hash of another cost, like those of earlier versions, still verifies
+	models.BcryptCost = bcrypt.MinCost + 1
+	_, err := store.CreateUser("dave", "dave-password", models.RoleViewer)
+	models.BcryptCost = bcrypt.MinCost
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	if _, err := (LocalAuthenticator{Store: store}).Authenticate("dave", "dave-password"); err != nil {
+		t.Fatalf("authenticate dave: %v", err)
+	}
+	user, err := store.GetUserByUsername("dave")
+	if err != nil {
+		t.Fatalf("get dave: %v", err)
+	}
+	if cost, err := bcrypt.Cost([]byte(user.Password)); err != nil || cost != bcrypt.MinCost {
+		t.Errorf("hash cost after login %d, %v, want %d", cost, err, bcrypt.MinCost)
+	}
+	if _, err := (LocalAuthenticator{Store: store}).Authenticate("dave", "dave-password"); err != nil {
+		t.Errorf("authenticate dave with the new hash: %v", err)
+	}
+}
+
+func TestDummyHashFollowsCost(t *testing.T) {
+	// Logins of unknown users compare against it, so its cost must be that of real hashes
+	for _, cost := range []int{bcrypt.MinCost + 1, bcrypt.MinCost} {
+		models.BcryptCost = cost
+		if got, err := bcrypt.Cost([]byte(dummyHash())); err != nil || got != cost {
+			t.Errorf("dummy hash cost %d, %v, want %d", got, err, cost)
+		}
+	}
+
+	// LDAP accounts have no local password but are compared all the same
+	store := newTestStore(t)
+	if _, err := store.ProvisionExternalUser(models.AuthProviderLDAP, "uid=bob", "bob", models.RoleViewer); err != nil {
+		t.Fatalf("create LDAP user: %v", err)
+	}
+	for _, username := range []string{"bob", "nobody"} {
+		if _, err := (LocalAuthenticator{Store: store}).Authenticate(username, "link-deck dummy password"); err != ErrInvalidCredentials {
+			t.Errorf("authenticate %s with the dummy password returned %v, want invalid credentials", username, err)
+		}
+	}
+}
+
+func TestChainFallsBackToLDAP(t *testing.T) {
+	store := newTestStore(t)
+	directory := newTestDirectory()
+	chain := Chain{LocalAuthenticator{Store: store}, newTestLDAPAuthenticator(t, LDAPConfig{}, store, directory)}
+
+	// Local accounts are checked first, without asking the directory
+	if user, err := chain.Authenticate("carol", "carol-password"); err != nil || user.AuthProvider != models.AuthProviderLocal {
+		t.Errorf("authenticate carol %+v, %v", user, err)
+	}
+	if directory.dials != 0 {
+		t.Errorf("directory dialed %d times for a local account", directory.dials)
+	}
+
+	// Users unknown locally are checked against the directory
+	if user, err := chain.Authenticate("bob", "bob-password"); err != nil || user.AuthProvider != models.AuthProviderLDAP {
+		t.Errorf("authenticate bob %+v, %v", user, err)
+	}
+
+	// LDAP accounts have no local password, so the local authenticator passes them on
+	if user, err := chain.Authenticate("bob", "bob-password"); err != nil || user.Username != "bob" {
+		t.Errorf("authenticate bob again %+v, %v", user, err)
+	}
+
+	if _, err := chain.Authenticate("bob", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("authenticate bob with a wrong password returned %v, want invalid credentials", err)
+	}
+
+	// Errors other than wrong credentials stop the chain
+	directory.down = true
+	if _, err := chain.Authenticate("bob", "bob-password"); err == nil || err == ErrInvalidCredentials {
+		t.Errorf("authenticate bob with the directory down returned %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// LDAPConfig configures authentication against an LDAP directory
+type LDAPConfig struct {
+	Enabled bool `json:"enabled"`
+	// URL of the directory, e.g. ldaps://ldap.example.com:636
+	URL string `json:"url"`
+	// StartTLS upgrades a plain ldap:// connection to TLS before binding
+	StartTLS           bool `json:"start_tls"`
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// UserDNTemplate builds the DN to bind as, %s is replaced by the escaped username,
+	// e.g. uid=%s,ou=people,dc=example,dc=com
+	UserDNTemplate string `json:"user_dn_template"`
+	// AdminGroupDN optionally names a group whose members get the admin role
+	AdminGroupDN string `json:"admin_group_dn"`
+	// GroupMemberAttribute is the group attribute listing member DNs, defaults to member
+	GroupMemberAttribute string `json:"group_member_attribute"`
+	// DefaultRole is given to users outside the admin group, defaults to viewer
+	DefaultRole string `json:"default_role"`
+}
+
+// ldapDirectory is the connection to an LDAP directory the authenticator uses, an *ldap.Conn
+type ldapDirectory interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPAuthenticator binds to an LDAP directory as the user to check their password
+type LDAPAuthenticator struct {
+	config LDAPConfig
+	store  models.UserStore
+	// dial connects to the directory, tests replace it with a fake directory
+	dial func() (ldapDirectory, error)
+}
+
+// NewLDAPAuthenticator checks the configuration and returns an LDAP authenticator
+// that caches accounts in store
+func NewLDAPAuthenticator(config LDAPConfig, store models.UserStore) (*LDAPAuthenticator, error) {
+	if config.URL == "" {
+		return nil, errors.New("ldap url is required")
+	}
+	if strings.Count(config.UserDNTemplate, "%s") != 1 {
+		return nil, errors.New("ldap user_dn_template must contain %s exactly once")
+	}
+
+	// Apply defaults
+	if config.GroupMemberAttribute == "" {
+		config.GroupMemberAttribute = "member"
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = models.RoleViewer
+	}
+	if !models.IsValidRole(config.DefaultRole) {
+		return nil, fmt.Errorf("ldap default_role %q is not a valid role", config.DefaultRole)
+	}
+
+	a := &LDAPAuthenticator{config: config, store: store}
+	a.dial = a.dialURL
+	return a, nil
+}
+
+// Authenticate binds as the user and caches the account in the users table
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	userDN := fmt.Sprintf(a.config.UserDNTemplate, ldap.EscapeDN(username))
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind failed: %w", err)
+	}
+
+	role := a.config.DefaultRole
+	if a.config.AdminGroupDN != "" {
+		isAdmin, err := a.isGroupMember(conn, a.config.AdminGroupDN, userDN)
+		if err != nil {
+			return nil, err
+		}
+		if isAdmin {
+			role = models.RoleAdmin
+		}
+	}
+
+	user, err := a.store.ProvisionExternalUser(models.AuthProviderLDAP, userDN, username, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cache ldap user %s: %w", username, err)
+	}
+
+	log.Printf("LDAPAuthenticator: User %s authenticated with role %s", username, role)
+	return user, nil
+}
+
+// dialURL connects to the directory at the configured URL, upgrading to TLS if configured
+func (a *LDAPAuthenticator) dialURL() (ldapDirectory, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(a.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap: %w", err)
+	}
+
+	if a.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls failed: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// isGroupMember reports whether the group lists the user DN as a member
+func (a *LDAPAuthenticator) isGroupMember(conn ldapDirectory, groupDN, userDN string) (bool, error) {
+	request := ldap.NewSearchRequest(
+		groupDN,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		fmt.Sprintf("(%s=%s)", a.config.GroupMemberAttribute, ldap.EscapeFilter(userDN)),
+		[]string{"dn"},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		// A missing admin group is a configuration mistake, not a reason to refuse login
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			log.Printf("LDAPAuthenticator: Group %s does not exist", groupDN)
+			return false, nil
+		}
+		return false, fmt.Errorf("ldap group search failed: %w", err)
+	}
+
+	return len(result.Entries) > 0, nil
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// fakeDirectory is an LDAP directory in memory with user passwords and group members by DN
+type fakeDirectory struct {
+	passwords map[string]string
+	groups    map[string][]string
+	// dials counts the connections, failing ones too
+	dials int
+	down  bool
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	if want, ok := d.passwords[username]; !ok || want != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	return nil
+}
+
+func (d *fakeDirectory) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	members, ok := d.groups[request.BaseDN]
+	if !ok {
+		return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+	}
+
+	result := &ldap.SearchResult{}
+	for _, member := range members {
+		if request.Filter == fmt.Sprintf("(member=%s)", ldap.EscapeFilter(member)) {
+			result.Entries = append(result.Entries, ldap.NewEntry(request.BaseDN, nil))
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error {
+	return nil
+}
+
+// newTestLDAPAuthenticator returns an authenticator for the fake directory caching users in store
+func newTestLDAPAuthenticator(t *testing.T, config LDAPConfig, store models.UserStore, directory *fakeDirectory) *LDAPAuthenticator {
+	t.Helper()
+
+	config.URL = "ldap://ldap.example.com"
+	config.UserDNTemplate = "uid=%s,ou=people,dc=example,dc=com"
+	a, err := NewLDAPAuthenticator(config, store)
+	if err != nil {
+		t.Fatalf("new LDAP authenticator: %v", err)
+	}
+	a.dial = func() (ldapDirectory, error) {
+		directory.dials++
+		if directory.down {
+			return nil, errors.New("connection refused")
+		}
+		return directory, nil
+	}
+
+	return a
+}
+
+// newTestDirectory returns a directory where alice and bob have passwords and alice is an admin
+func newTestDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		passwords: map[string]string{
+			"uid=alice,ou=people,dc=example,dc=com": "alice-password",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-password",
+		},
+		groups: map[string][]string{
+			"cn=admins,ou=groups,dc=example,dc=com": {"uid=alice,ou=people,dc=example,dc=com"},
+		},
+	}
+}
+
+func TestLDAPAuthenticatorProvisionsUsers(t *testing.T) {
+	store := newTestStore(t)
+	directory := newTestDirectory()
+	a := newTestLDAPAuthenticator(t, LDAPConfig{AdminGroupDN: "cn=admins,ou=groups,dc=example,dc=com"}, store, directory)
+
+	// The first login creates the account, the admin group decides the role
+	for username, role := range map[string]string{"alice": models.RoleAdmin, "bob": models.RoleViewer} {
+		user, err := a.Authenticate(username, username+"-password")
+		if err != nil {
+			t.Fatalf("authenticate %s: %v", username, err)
+		}
+		if user.Username != username || user.Role != role || user.AuthProvider != models.AuthProviderLDAP {
+			t.Errorf("user %+v, want %s with role %s from LDAP", user, username, role)
+		}
+	}
+
+	// Later logins follow the directory
+	directory.groups["cn=admins,ou=groups,dc=example,dc=com"] = nil
+	user, err := a.Authenticate("alice", "alice-password")
+	if err != nil || user.Role != models.RoleViewer {
+		t.Errorf("alice after leaving the admin group %+v, %v", user, err)
+	}
+	if cached, err := store.GetUserByUsername("alice"); err != nil || cached.ID != user.ID || cached.Role != models.RoleViewer {
+		t.Errorf("cached alice %+v, %v", cached, err)
+	}
+}
+
+func TestLDAPAuthenticatorRejectsBadBinds(t *testing.T) {
+	store := newTestStore(t)
+	directory := newTestDirectory()
+	a := newTestLDAPAuthenticator(t, LDAPConfig{}, store, directory)
+
+	for _, credentials := range [][2]string{{"alice", "wrong"}, {"mallory", "alice-password"}, {"alice", ""}} {
+		if user, err := a.Authenticate(credentials[0], credentials[1]); err != ErrInvalidCredentials {
+			t.Errorf("authenticate %v returned %+v, %v, want invalid credentials", credentials, user, err)
+		}
+	}
+	if _, err := store.GetUserByUsername("alice"); err == nil {
+		t.Error("failed login provisioned alice")
+	}
+
+	// Empty passwords would be unauthenticated binds and never reach the directory
+	if directory.dials != 2 {
+		t.Errorf("directory dialed %d times, want 2", directory.dials)
+	}
+
+	// An unreachable directory is an error, not a wrong password
+	directory.down = true
+	if _, err := a.Authenticate("alice", "alice-password"); err == nil || err == ErrInvalidCredentials {
+		t.Errorf("authenticate with the directory down returned %v", err)
+	}
+}
+
+func TestLDAPAuthenticatorMissingGroup(t *testing.T) {
+	store := newTestStore(t)
+	a := newTestLDAPAuthenticator(t, LDAPConfig{AdminGroupDN: "cn=missing,ou=groups,dc=example,dc=com", DefaultRole: models.RoleEditor}, store, newTestDirectory())
+
+	// A missing admin group gives everyone the default role instead of refusing logins
+	user, err := a.Authenticate("alice", "alice-password")
+	if err != nil || user.Role != models.RoleEditor {
+		t.Errorf("alice with a missing admin group %+v, %v", user, err)
+	}
+}
+
+func TestNewLDAPAuthenticatorRejectsInvalidConfig(t *testing.T) {
+	store := newTestStore(t)
+	for name, config := range map[string]LDAPConfig{
+		"no URL":          {UserDNTemplate: "uid=%s,dc=example,dc=com"},
+		"no placeholder":  {URL: "ldap://ldap.example.com", UserDNTemplate: "uid=alice,dc=example,dc=com"},
+		"two placeholder": {URL: "ldap://ldap.example.com", UserDNTemplate: "uid=%s,cn=%s"},
+		"invalid role":    {URL: "ldap://ldap.example.com", UserDNTemplate: "uid=%s", DefaultRole: "root"},
+	} {
+		if _, err := NewLDAPAuthenticator(config, store); err == nil {
+			t.Errorf("authenticator with %s was created", name)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/yongliucc/link-deck/models"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig configures OpenID Connect single sign-on
+type OIDCConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	// UsernameClaim is the ID token claim used as username, defaults to preferred_username
+	UsernameClaim string `json:"username_claim"`
+	// GroupsClaim is the ID token claim listing the user's IdP groups, defaults to groups
+	GroupsClaim string `json:"groups_claim"`
+	// RoleMapping maps IdP groups to link-deck roles, the highest matching role wins
+	RoleMapping map[string]string `json:"role_mapping"`
+	// DefaultRole is given to users in none of the mapped groups, defaults to viewer
+	DefaultRole string `json:"default_role"`
+}
+
+// OIDCIdentity is the user identity asserted by the identity provider
+type OIDCIdentity struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// OIDCProvider runs the authorization code flow against an OpenID Connect issuer
+type OIDCProvider struct {
+	config   OIDCConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider discovers the issuer's endpoints and returns a provider for it
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc issuer, client_id and redirect_url are required")
+	}
+
+	// Apply defaults
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"profile", "email", "groups"}
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.DefaultRole == "" {
+		config.DefaultRole = models.RoleViewer
+	}
+	if !models.IsValidRole(config.DefaultRole) {
+		return nil, fmt.Errorf("oidc default_role %q is not a valid role", config.DefaultRole)
+	}
+	for group, role := range config.RoleMapping {
+		if !models.IsValidRole(role) {
+			return nil, fmt.Errorf("oidc role_mapping for group %q has invalid role %q", group, role)
+		}
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc issuer: %w", err)
+	}
+
+	return &OIDCProvider{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, config.Scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL returns the identity provider URL the user is redirected to for login
+func (p *OIDCProvider) AuthCodeURL(state, nonce string) string {
+	return p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+// Exchange trades an authorization code for tokens and returns the verified identity
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (*OIDCIdentity, error) {
+	token, err := p.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse id_token claims: %w", err)
+	}
+
+	// Fall back to the subject if the IdP does not send a username
+	username, _ := claims[p.config.UsernameClaim].(string)
+	if username == "" {
+		username = idToken.Subject
+	}
+
+	identity := &OIDCIdentity{
+		Subject:  idToken.Subject,
+		Username: username,
+	}
+	if groups, ok := claims[p.config.GroupsClaim].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	}
+
+	return identity, nil
+}
+
+// RoleFor maps the IdP groups of a user to the highest configured role
+func (p *OIDCProvider) RoleFor(groups []string) string {
+	role := p.config.DefaultRole
+	for _, group := range groups {
+		if mapped, ok := p.config.RoleMapping[group]; ok && models.HasRole(mapped, role) {
+			role = mapped
+		}
+	}
+
+	return role
+}
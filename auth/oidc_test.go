@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yongliucc/link-deck/auth/oidctest"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// newTestOIDCProvider returns a provider for a mock IdP, mapping the admins and editors groups to roles
+func newTestOIDCProvider(t *testing.T) (*OIDCProvider, *oidctest.IdP) {
+	t.Helper()
+
+	idp := oidctest.New(t, "link-deck")
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		Issuer:      idp.URL,
+		ClientID:    idp.ClientID,
+		RedirectURL: "http://localhost/api/auth/oidc/callback",
+		RoleMapping: map[string]string{"admins": models.RoleAdmin, "editors": models.RoleEditor},
+	})
+	if err != nil {
+		t.Fatalf("new OIDC provider: %v", err)
+	}
+
+	return provider, idp
+}
+
+func TestOIDCExchange(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+
+	idp.Issue("code", map[string]any{"sub": "u-1", "nonce": "n", "preferred_username": "alice", "groups": []string{"editors", "staff"}})
+	identity, err := provider.Exchange(context.Background(), "code", "n")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	want := &OIDCIdentity{Subject: "u-1", Username: "alice", Groups: []string{"editors", "staff"}}
+	if !reflect.DeepEqual(identity, want) {
+		t.Errorf("identity %+v, want %+v", identity, want)
+	}
+
+	// Codes are single use
+	if _, err := provider.Exchange(context.Background(), "code", "n"); err == nil {
+		t.Error("exchange of a used code succeeded")
+	}
+
+	// Without a username claim the subject is the username
+	idp.Issue("no-username", map[string]any{"sub": "u-2", "nonce": "n"})
+	if identity, err := provider.Exchange(context.Background(), "no-username", "n"); err != nil || identity.Username != "u-2" {
+		t.Errorf("identity without username %+v, %v", identity, err)
+	}
+}
+
+func TestOIDCExchangeRejectsBadTokens(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+
+	for name, claims := range map[string]map[string]any{
+		"nonce mismatch": {"sub": "u-1", "nonce": "other"},
+		"other audience": {"sub": "u-1", "nonce": "n", "aud": "another-client"},
+		"other issuer":   {"sub": "u-1", "nonce": "n", "iss": "https://idp.example.com"},
+		"expired":        {"sub": "u-1", "nonce": "n", "exp": 1},
+	} {
+		code := strings.ReplaceAll(name, " ", "-")
+		idp.Issue(code, claims)
+		if identity, err := provider.Exchange(context.Background(), code, "n"); err == nil {
+			t.Errorf("exchange with %s returned %+v", name, identity)
+		}
+	}
+
+	if _, err := provider.Exchange(context.Background(), "unknown", "n"); err == nil {
+		t.Error("exchange of an unknown code succeeded")
+	}
+}
+
+func TestOIDCRoleFor(t *testing.T) {
+	provider, _ := newTestOIDCProvider(t)
+
+	for _, tt := range []struct {
+		groups []string
+		want   string
+	}{
+		{nil, models.RoleViewer},
+		{[]string{"staff"}, models.RoleViewer},
+		{[]string{"editors"}, models.RoleEditor},
+		// The highest role of all mapped groups wins, whatever their order
+		{[]string{"admins", "editors"}, models.RoleAdmin},
+		{[]string{"editors", "admins"}, models.RoleAdmin},
+	} {
+		if got := provider.RoleFor(tt.groups); got != tt.want {
+			t.Errorf("RoleFor(%v) = %s, want %s", tt.groups, got, tt.want)
+		}
+	}
+}
+
+func TestNewOIDCProviderRejectsInvalidRoles(t *testing.T) {
+	idp := oidctest.New(t, "link-deck")
+	base := OIDCConfig{Issuer: idp.URL, ClientID: idp.ClientID, RedirectURL: "http://localhost/callback"}
+
+	invalidDefault := base
+	invalidDefault.DefaultRole = "owner"
+	invalidMapping := base
+	invalidMapping.RoleMapping = map[string]string{"admins": "root"}
+	for name, config := range map[string]OIDCConfig{
+		"default role": invalidDefault,
+		"role mapping": invalidMapping,
+		"no issuer":    {ClientID: "link-deck", RedirectURL: "http://localhost/callback"},
+	} {
+		if _, err := NewOIDCProvider(context.Background(), config); err == nil {
+			t.Errorf("provider with an invalid %s was created", name)
+		}
+	}
+}
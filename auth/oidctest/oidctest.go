@@ -0,0 +1,134 @@
+// Package oidctest provides a mock OpenID Connect identity provider for tests. It serves
+// discovery, the signing keys and a token endpoint that answers the codes it was given.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyID identifies the signing key of the IdP in its key set
+const keyID = "oidctest"
+
+// IdP is an identity provider running on a local test server
+type IdP struct {
+	// URL is the issuer, where discovery is served
+	URL      string
+	ClientID string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]jwt.MapClaims
+}
+
+// New starts an identity provider for the client clientID, stopped when the test ends
+func New(t *testing.T, clientID string) *IdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate IdP key: %v", err)
+	}
+	idp := &IdP{ClientID: clientID, key: key, codes: make(map[string]jwt.MapClaims)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("GET /keys", idp.keys)
+	mux.HandleFunc("POST /token", idp.token)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	idp.URL = server.URL
+
+	return idp
+}
+
+// Issue makes code exchangeable once for an ID token with claims, such as sub, nonce and groups,
+// on top of the issuer, audience and lifetime. Claims can override those to forge bad tokens.
+func (idp *IdP) Issue(code string, claims map[string]any) {
+	token := jwt.MapClaims{
+		"iss": idp.URL,
+		"aud": idp.ClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		token[name] = value
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = token
+}
+
+// discovery serves the OpenID provider metadata
+func (idp *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                idp.URL,
+		"authorization_endpoint":                idp.URL + "/authorize",
+		"token_endpoint":                        idp.URL + "/token",
+		"jwks_uri":                              idp.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+// keys serves the public signing key as a JSON Web Key Set
+func (idp *IdP) keys(w http.ResponseWriter, r *http.Request) {
+	public := idp.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+// token exchanges an issued code for a signed ID token
+func (idp *IdP) token(w http.ResponseWriter, r *http.Request) {
+	code := r.PostFormValue("code")
+	idp.mu.Lock()
+	claims, ok := idp.codes[code]
+	delete(idp.codes, code)
+	idp.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// writeJSON writes value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThrottleLimits configures how failed logins of one username or one IP address are slowed down
+type ThrottleLimits struct {
+	// FreeAttempts is the number of failures allowed before backoff starts
+	FreeAttempts int `json:"free_attempts"`
+	// BaseDelaySeconds is the first backoff delay, doubled with each further failure
+	BaseDelaySeconds int `json:"base_delay_seconds"`
+	// MaxDelaySeconds caps the backoff delay
+	MaxDelaySeconds int `json:"max_delay_seconds"`
+	// LockoutAttempts is the number of failures after which logins are locked for LockoutSeconds
+	LockoutAttempts int `json:"lockout_attempts"`
+	// LockoutSeconds is how long a lockout lasts
+	LockoutSeconds int `json:"lockout_seconds"`
+	// ResetSeconds is how long without failures until earlier failures are forgotten
+	ResetSeconds int `json:"reset_seconds"`
+}
+
+// ThrottleConfig configures brute-force protection of the login endpoints
+type ThrottleConfig struct {
+	// Disabled turns off login throttling, e.g. behind a proxy that already rate limits
+	Disabled    bool           `json:"disabled"`
+	PerUsername ThrottleLimits `json:"per_username"`
+	PerIP       ThrottleLimits `json:"per_ip"`
+}
+
+// DefaultThrottleConfig returns the throttling used unless configured otherwise.
+// Addresses get more attempts than usernames since many users can share one address.
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		PerUsername: ThrottleLimits{
+			FreeAttempts:     3,
+			BaseDelaySeconds: 1,
+			MaxDelaySeconds:  30,
+			LockoutAttempts:  10,
+			LockoutSeconds:   15 * 60,
+			ResetSeconds:     15 * 60,
+		},
+		PerIP: ThrottleLimits{
+			FreeAttempts:     10,
+			BaseDelaySeconds: 1,
+			MaxDelaySeconds:  60,
+			LockoutAttempts:  50,
+			LockoutSeconds:   60 * 60,
+			ResetSeconds:     60 * 60,
+		},
+	}
+}
+
+// throttleEntry tracks the recent failures of one username or address
+type throttleEntry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// throttleSweepInterval is how often entries that no longer matter are removed
+const throttleSweepInterval = time.Minute
+
+// Throttle tracks failed logins per username and per IP address in memory
+// and tells callers how long to wait before the next attempt
+type Throttle struct {
+	config    ThrottleConfig
+	mu        sync.Mutex
+	usernames map[string]*throttleEntry
+	ips       map[string]*throttleEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewThrottle returns a throttle with the given limits
+func NewThrottle(config ThrottleConfig) *Throttle {
+	return &Throttle{
+		config:    config,
+		usernames: make(map[string]*throttleEntry),
+		ips:       make(map[string]*throttleEntry),
+		now:       time.Now,
+	}
+}
+
+// Reserve counts a login for username from ip as failed before its credentials are checked, so
+// parallel guesses cannot all pass before any of them is counted. It returns how many failures the
+// username has had recently, or how long to wait if logins are throttled, in which case nothing is
+// counted. Logins that do not fail have to take the reservation back with Success or Release.
+func (t *Throttle) Reserve(username, ip string) (int, time.Duration) {
+	if t.config.Disabled {
+		return 0, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	username = strings.ToLower(username)
+	wait := waitFor(t.usernames[username], now)
+	if ipWait := waitFor(t.ips[ip], now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		return 0, wait
+	}
+
+	t.sweep(now)
+	failures := recordFailure(t.usernames, username, t.config.PerUsername, now)
+	recordFailure(t.ips, ip, t.config.PerIP, now)
+
+	return failures, 0
+}
+
+// Release takes back the reservation of a login that did not fail, e.g. because the
+// credentials could not be checked or a second factor is still needed
+func (t *Throttle) Release(username, ip string) {
+	if t.config.Disabled {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	releaseFailure(t.usernames, strings.ToLower(username), t.config.PerUsername)
+	releaseFailure(t.ips, ip, t.config.PerIP)
+}
+
+// Success forgets the failed logins of a username after it logged in and takes back the reservation
+// of the address. Earlier failures of the address are kept, so one valid account cannot be used to reset them.
+func (t *Throttle) Success(username, ip string) {
+	if t.config.Disabled {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.usernames, strings.ToLower(username))
+	releaseFailure(t.ips, ip, t.config.PerIP)
+}
+
+// waitFor returns how long until entry is no longer blocked
+func waitFor(entry *throttleEntry, now time.Time) time.Duration {
+	if entry == nil || !now.Before(entry.blockedUntil) {
+		return 0
+	}
+
+	return entry.blockedUntil.Sub(now)
+}
+
+// recordFailure counts a failure for key and blocks it according to limits
+func recordFailure(entries map[string]*throttleEntry, key string, limits ThrottleLimits, now time.Time) int {
+	entry := entries[key]
+	if entry == nil || now.Sub(entry.lastFailure) > seconds(limits.ResetSeconds) {
+		entry = &throttleEntry{}
+		entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+	entry.block(limits)
+
+	return entry.failures
+}
+
+// releaseFailure takes back the last failure counted for key, unblocking it if that failure blocked it
+func releaseFailure(entries map[string]*throttleEntry, key string, limits ThrottleLimits) {
+	entry := entries[key]
+	if entry == nil {
+		return
+	}
+
+	entry.failures--
+	if entry.failures <= 0 {
+		delete(entries, key)
+		return
+	}
+	entry.block(limits)
+}
+
+// block sets until when the entry is blocked after its last failure, depending on the number of failures
+func (entry *throttleEntry) block(limits ThrottleLimits) {
+	switch {
+	case limits.LockoutAttempts > 0 && entry.failures >= limits.LockoutAttempts:
+		entry.blockedUntil = entry.lastFailure.Add(seconds(limits.LockoutSeconds))
+	case entry.failures > limits.FreeAttempts:
+		// Double the delay with each failure past the free ones, without overflowing the shift
+		delay := seconds(limits.MaxDelaySeconds)
+		if exponent := entry.failures - limits.FreeAttempts - 1; exponent < 20 {
+			if backoff := seconds(limits.BaseDelaySeconds) << exponent; backoff < delay {
+				delay = backoff
+			}
+		}
+		entry.blockedUntil = entry.lastFailure.Add(delay)
+	default:
+		entry.blockedUntil = time.Time{}
+	}
+}
+
+// sweep removes entries that are neither blocked nor recent enough to count, at most once per interval
+func (t *Throttle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < throttleSweepInterval {
+		return
+	}
+	t.lastSweep = now
+
+	sweepEntries(t.usernames, seconds(t.config.PerUsername.ResetSeconds), now)
+	sweepEntries(t.ips, seconds(t.config.PerIP.ResetSeconds), now)
+}
+
+// sweepEntries removes the entries that can no longer affect a login
+func sweepEntries(entries map[string]*throttleEntry, reset time.Duration, now time.Time) {
+	for key, entry := range entries {
+		if !now.Before(entry.blockedUntil) && now.Sub(entry.lastFailure) > reset {
+			delete(entries, key)
+		}
+	}
+}
+
+// seconds converts a number of seconds from the config to a duration
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestThrottle returns a throttle with per-username limits and a clock the test moves forward.
+// Addresses are not limited unless the test sets limits for them.
+func newTestThrottle(limits ThrottleLimits) (*Throttle, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := NewThrottle(ThrottleConfig{
+		PerUsername: limits,
+		PerIP:       ThrottleLimits{FreeAttempts: 1000, ResetSeconds: 3600},
+	})
+	t.now = func() time.Time { return now }
+
+	return t, &now
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	throttle, now := newTestThrottle(ThrottleLimits{FreeAttempts: 2, BaseDelaySeconds: 1, MaxDelaySeconds: 4, ResetSeconds: 3600})
+
+	for i := 1; i <= 3; i++ {
+		if failures, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 0 || failures != i {
+			t.Fatalf("attempt %d: %d failures, wait %v", i, failures, wait)
+		}
+	}
+
+	// The delay doubles with each failure past the free ones, up to the maximum
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if _, wait := throttle.Reserve("alice", "192.0.2.1"); wait != delay {
+			t.Fatalf("wait %v, want %v", wait, delay)
+		}
+		// Usernames are throttled whatever their case and address
+		if _, wait := throttle.Reserve("ALICE", "198.51.100.1"); wait != delay {
+			t.Fatalf("wait of ALICE %v, want %v", wait, delay)
+		}
+		*now = now.Add(delay)
+		if _, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 0 {
+			t.Fatalf("wait %v after the delay", wait)
+		}
+	}
+
+	// Other usernames are not affected
+	if _, wait := throttle.Reserve("bob", "192.0.2.1"); wait != 0 {
+		t.Errorf("wait of bob %v", wait)
+	}
+
+	// Failures are forgotten after the reset time
+	*now = now.Add(time.Hour + time.Second)
+	if failures, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 0 || failures != 1 {
+		t.Errorf("after the reset time: %d failures, wait %v", failures, wait)
+	}
+}
+
+func TestThrottleLockout(t *testing.T) {
+	throttle, now := newTestThrottle(ThrottleLimits{FreeAttempts: 100, LockoutAttempts: 3, LockoutSeconds: 600, ResetSeconds: 3600})
+
+	for i := 0; i < 3; i++ {
+		throttle.Reserve("alice", "192.0.2.1")
+	}
+	if _, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 10*time.Minute {
+		t.Errorf("wait %v, want the lockout of 10m", wait)
+	}
+
+	*now = now.Add(10 * time.Minute)
+	if _, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 0 {
+		t.Errorf("wait %v after the lockout", wait)
+	}
+}
+
+func TestThrottleSuccessAndRelease(t *testing.T) {
+	throttle, _ := newTestThrottle(ThrottleLimits{FreeAttempts: 2, BaseDelaySeconds: 60, MaxDelaySeconds: 60, ResetSeconds: 3600})
+	throttle.config.PerIP = ThrottleLimits{FreeAttempts: 3, BaseDelaySeconds: 60, MaxDelaySeconds: 60, ResetSeconds: 3600}
+
+	// Two failures, then the right password: the third reservation is taken back with the failures of the username
+	throttle.Reserve("alice", "192.0.2.1")
+	throttle.Reserve("alice", "192.0.2.1")
+	throttle.Reserve("alice", "192.0.2.1")
+	throttle.Success("alice", "192.0.2.1")
+	if failures, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 0 || failures != 1 {
+		t.Errorf("after success: %d failures, wait %v", failures, wait)
+	}
+	throttle.Success("alice", "192.0.2.1")
+
+	// The two earlier failures of the address are kept, two more block it
+	throttle.Reserve("bob", "192.0.2.1")
+	throttle.Reserve("carol", "192.0.2.1")
+	if _, wait := throttle.Reserve("dave", "192.0.2.1"); wait != time.Minute {
+		t.Errorf("wait of the address %v, want 1m", wait)
+	}
+
+	// Releasing the reservation that blocked the username unblocks it
+	throttle, _ = newTestThrottle(ThrottleLimits{FreeAttempts: 1, BaseDelaySeconds: 60, MaxDelaySeconds: 60, ResetSeconds: 3600})
+	throttle.Reserve("alice", "192.0.2.1")
+	throttle.Reserve("alice", "192.0.2.1")
+	throttle.Release("alice", "192.0.2.1")
+	if failures, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 0 || failures != 2 {
+		t.Errorf("after release: %d failures, wait %v", failures, wait)
+	}
+}
+
+func TestThrottleConcurrentAttempts(t *testing.T) {
+	throttle, _ := newTestThrottle(ThrottleLimits{FreeAttempts: 3, BaseDelaySeconds: 60, MaxDelaySeconds: 60, ResetSeconds: 3600})
+
+	// Parallel guesses are counted as they come in, so only the free ones and the one blocking get through
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, wait := throttle.Reserve("alice", fmt.Sprintf("192.0.2.%d", i)); wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 4 {
+		t.Errorf("%d parallel attempts got through, want 4", allowed)
+	}
+}
+
+func TestThrottleDisabled(t *testing.T) {
+	throttle := NewThrottle(ThrottleConfig{Disabled: true, PerUsername: ThrottleLimits{LockoutAttempts: 1, LockoutSeconds: 600}})
+	for i := 0; i < 10; i++ {
+		if _, wait := throttle.Reserve("alice", "192.0.2.1"); wait != 0 {
+			t.Fatalf("disabled throttle made attempt %d wait %v", i, wait)
+		}
+	}
+}
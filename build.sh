@@ -37,7 +37,7 @@ export CGO_ENABLED=1  # Enable CGO for SQLite support
 
 # Build for current platform
 print_step "Building Go server for current platform..."
-go build -ldflags="-s -w" -o bin/link-deck main.go
+go build -tags sqlite_fts5 -ldflags="-s -w" -o bin/link-deck main.go
 if [ $? -ne 0 ]; then
   print_error "Go build failed!"
   exit 1
@@ -50,19 +50,19 @@ if [ "$1" == "--all" ]; then
   
   # Linux (amd64)
   print_step "Building for Linux (amd64)..."
-  CGO_ENABLED=1 GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o bin/link-deck-linux-amd64 main.go
+  CGO_ENABLED=1 GOOS=linux GOARCH=amd64 go build -tags sqlite_fts5 -ldflags="-s -w" -o bin/link-deck-linux-amd64 main.go
   
   # Windows (amd64)
   print_step "Building for Windows (amd64)..."
-  CGO_ENABLED=1 GOOS=windows GOARCH=amd64 go build -ldflags="-s -w" -o bin/link-deck-windows-amd64.exe main.go
+  CGO_ENABLED=1 GOOS=windows GOARCH=amd64 go build -tags sqlite_fts5 -ldflags="-s -w" -o bin/link-deck-windows-amd64.exe main.go
   
   # macOS (amd64)
   print_step "Building for macOS (amd64)..."
-  CGO_ENABLED=1 GOOS=darwin GOARCH=amd64 go build -ldflags="-s -w" -o bin/link-deck-darwin-amd64 main.go
+  CGO_ENABLED=1 GOOS=darwin GOARCH=amd64 go build -tags sqlite_fts5 -ldflags="-s -w" -o bin/link-deck-darwin-amd64 main.go
   
   # macOS (arm64)
   print_step "Building for macOS (arm64)..."
-  CGO_ENABLED=1 GOOS=darwin GOARCH=arm64 go build -ldflags="-s -w" -o bin/link-deck-darwin-arm64 main.go
+  CGO_ENABLED=1 GOOS=darwin GOARCH=arm64 go build -tags sqlite_fts5 -ldflags="-s -w" -o bin/link-deck-darwin-arm64 main.go
   
   print_success "All platforms built successfully!"
 fi
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// maxAliasSuggestions is how many close aliases are suggested for an alias that matches no link
+const maxAliasSuggestions = 5
+
+// AliasTarget is the link an alias leads to, with the URL its parameters were put into
+type AliasTarget struct {
+	LinkID int64  `json:"link_id"`
+	Alias  string `json:"alias"`
+	URL    string `json:"url"`
+}
+
+// ResolveAlias handles looking up the link a go-link path like pr/123 leads to among the
+// links the user can read, counting it as a click. Paths no alias matches get suggestions.
+func (h *Handler) ResolveAlias(c *gin.Context) {
+	path := strings.Trim(c.Param("alias"), "/")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alias is required"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	groups, err := h.Store.GetAllLinkGroups(userID)
+	if err != nil {
+		log.Printf("ResolveAlias: Error retrieving link groups of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve alias"})
+		return
+	}
+	// Links that are not HTTP or HTTPS, which the app would run when opening them, are never resolved
+	var links []models.Link
+	for _, group := range models.FlattenLinkGroups(groups) {
+		for _, link := range group.Links {
+			if models.IsValidLinkURL(link.URL) {
+				links = append(links, link)
+			}
+		}
+	}
+
+	link, parameters, ok := models.ResolveAlias(links, path)
+	target := models.ExpandAliasURL(link.URL, parameters)
+	if !ok || !models.IsValidLinkURL(target) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":       "No link has the alias " + path,
+			"suggestions": models.SuggestAliases(links, path, maxAliasSuggestions),
+		})
+		return
+	}
+
+	// A click that cannot be recorded must not keep the user from their link
+	if err := h.Store.RecordClick(link.ID, userID, clickReferrer(c)); err != nil {
+		log.Printf("ResolveAlias: Error recording click on link %d: %v", link.ID, err)
+	}
+
+	c.JSON(http.StatusOK, AliasTarget{
+		LinkID: link.ID,
+		Alias:  link.Alias,
+		URL:    target,
+	})
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// APITokenRequest represents the create API token request body
+type APITokenRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APITokenResponse represents a newly created API token, the only time the token itself is shown
+type APITokenResponse struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+// GetAPITokens handles listing the personal access tokens of the current user
+func (h *Handler) GetAPITokens(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tokens, err := h.Store.GetAPITokensByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateAPIToken handles creating a personal access token for the current user
+func (h *Handler) CreateAPIToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req APITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// Tokens are read-only unless scopes are given
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{models.ScopeRead}
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+			return
+		}
+		// A token cannot do more than its user
+		if !models.HasRole(c.GetString("role"), models.ScopeRole(scope)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scope exceeds your role: " + scope})
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	token, plain, err := h.Store.CreateAPIToken(userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		log.Printf("CreateAPIToken: Failed to create API token for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, APITokenResponse{APIToken: *token, Token: plain})
+}
+
+// DeleteAPIToken handles revoking a personal access token of the current user
+func (h *Handler) DeleteAPIToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	h.deleteAPIToken(c, userID)
+}
+
+// GetUserAPITokens handles listing the personal access tokens of a user
+func (h *Handler) GetUserAPITokens(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	tokens, err := h.Store.GetAPITokensByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// DeleteUserAPIToken handles revoking a personal access token of a user
+func (h *Handler) DeleteUserAPIToken(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	h.deleteAPIToken(c, userID)
+}
+
+// deleteAPIToken deletes the token in the tokenId parameter if it belongs to the user
+func (h *Handler) deleteAPIToken(c *gin.Context, userID int64) {
+	tokenID, err := strconv.ParseInt(c.Param("tokenId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	err = h.Store.DeleteAPIToken(tokenID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API token deleted successfully"})
+}
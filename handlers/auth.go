@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/auth"
 	"github.com/yongliucc/link-deck/middleware"
 	"github.com/yongliucc/link-deck/models"
 )
@@ -15,51 +19,247 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse represents the login response body
+// LoginResponse represents the login and refresh response body
 type LoginResponse struct {
-	Token    string `json:"token"`
-	Username string `json:"username"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds until the access token expires
+	Username     string `json:"username"`
+	Role         string `json:"role"`
 }
 
-// Login handles user login
-func Login(c *gin.Context) {
+// RefreshRequest represents the refresh request body
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TwoFactorChallengeResponse is returned by login instead of tokens when the user has two-factor auth
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// LoginTwoFactorRequest represents the second login step request body
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// Login handles user login, checking the credentials with the handler's authenticator.
+// Repeated failures are slowed down by the throttle.
+func (h *Handler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	// Get user by username
-	user, err := models.GetUserByUsername(req.Username)
+	// Count the attempt before spending time on the password hash, so parallel guesses are throttled too
+	failures, ok := h.reserveAttempt(c, req.Username)
+	if !ok {
+		return
+	}
+
+	// Check username and password
+	user, err := h.Authenticator.Authenticate(req.Username, req.Password)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == auth.ErrInvalidCredentials {
+			log.Printf("Login: Failed login for user %s from %s (%d recent failures)", req.Username, c.ClientIP(), failures)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		h.Throttle.Release(req.Username, c.ClientIP())
+		log.Printf("Login: Failed to authenticate user %s: %v", req.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate user"})
+		return
+	}
+
+	// Disabled accounts cannot log in
+	if user.Disabled {
+		h.Throttle.Release(req.Username, c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	// Users with two-factor auth need a code before they get a session,
+	// so the password alone does not reset their failures
+	if user.TwoFactor {
+		h.Throttle.Release(req.Username, c.ClientIP())
+		challenge, err := h.Auth.GenerateChallengeToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, TwoFactorChallengeResponse{TwoFactorRequired: true, ChallengeToken: challenge})
+		return
+	}
+
+	// Start a session and return its tokens
+	response, err := h.startSession(c, user)
+	if err != nil {
+		h.Throttle.Release(req.Username, c.ClientIP())
+		log.Printf("Login: Failed to start session for user %s: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.Throttle.Success(req.Username, c.ClientIP())
+	c.JSON(http.StatusOK, response)
+}
+
+// reserveAttempt counts a login for username from the client as failed until it succeeds, returning
+// the recent failures. It responds with 429 and reports false if logins are throttled.
+func (h *Handler) reserveAttempt(c *gin.Context, username string) (int, bool) {
+	failures, wait := h.Throttle.Reserve(username, c.ClientIP())
+	if wait <= 0 {
+		return failures, true
+	}
+
+	// Retry-After is in whole seconds, round up so clients do not retry too early
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	log.Printf("Login: Throttled login for user %s from %s for %ds", username, c.ClientIP(), retryAfter)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, please try again later"})
+
+	return 0, false
+}
+
+// LoginTwoFactor handles the second login step, exchanging a challenge token and a TOTP
+// or recovery code for a session. Wrong codes count as failed logins for the throttle.
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var req LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userID, err := h.Auth.ParseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please log in again"})
+		return
+	}
+
+	user, err := h.Store.GetUserByID(userID)
+	if err != nil || user.Disabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is disabled or no longer exists"})
+		return
+	}
+
+	// Codes are short, guessing them is throttled like guessing passwords
+	failures, ok := h.reserveAttempt(c, user.Username)
+	if !ok {
+		return
+	}
+
+	ok, err = h.Store.VerifyTwoFactorCode(user.ID, req.Code)
+	if err != nil {
+		h.Throttle.Release(user.Username, c.ClientIP())
+		log.Printf("LoginTwoFactor: Failed to verify code of user %s: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !ok {
+		log.Printf("LoginTwoFactor: Invalid two-factor code for user %s from %s (%d recent failures)", user.Username, c.ClientIP(), failures)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	// Start a session and return its tokens
+	response, err := h.startSession(c, user)
+	if err != nil {
+		h.Throttle.Release(user.Username, c.ClientIP())
+		log.Printf("LoginTwoFactor: Failed to start session for user %s: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.Throttle.Success(user.Username, c.ClientIP())
+	c.JSON(http.StatusOK, response)
+}
+
+// startSession creates a session for a user who just logged in and returns its tokens
+func (h *Handler) startSession(c *gin.Context, user *models.User) (*LoginResponse, error) {
+	// Take the chance to clean up sessions nobody can use anymore
+	if err := h.Store.DeleteExpiredSessions(); err != nil {
+		log.Printf("startSession: Failed to delete expired sessions: %v", err)
+	}
+
+	session, refreshToken, err := h.Store.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP(), middleware.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := h.Auth.GenerateToken(user.ID, user.Username, user.Role, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(middleware.AccessTokenTTL.Seconds()),
+		Username:     user.Username,
+		Role:         user.Role,
+	}, nil
+}
+
+// Refresh handles exchanging a refresh token for a new access token and refresh token
+func (h *Handler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// Rotate the refresh token, each one can only be used once
+	session, refreshToken, err := h.Store.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		if err == models.ErrRefreshTokenReused {
+			log.Printf("Refresh: Refresh token reused, session revoked")
+		}
+		if err == sql.ErrNoRows || err == models.ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
 
-	// Check password
-	if !models.CheckPasswordHash(req.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+	// The access token carries the current username and role
+	user, err := h.Store.GetUserByID(session.UserID)
+	if err != nil || user.Disabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is disabled or no longer exists"})
 		return
 	}
 
-	// Generate token
-	token, err := middleware.GenerateToken(user.ID, user.Username)
+	token, err := h.Auth.GenerateToken(user.ID, user.Username, user.Role, session.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	// Return token
 	c.JSON(http.StatusOK, LoginResponse{
-		Token:    token,
-		Username: user.Username,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(middleware.AccessTokenTTL.Seconds()),
+		Username:     user.Username,
+		Role:         user.Role,
 	})
 }
 
+// Logout handles ending the current session
+func (h *Handler) Logout(c *gin.Context) {
+	sessionID := c.GetInt64("sessionID")
+
+	err := h.Store.RevokeSession(sessionID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
 // ChangePasswordRequest represents the change password request body
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
@@ -67,7 +267,7 @@ type ChangePasswordRequest struct {
 }
 
 // ChangePassword handles changing a user's password
-func ChangePassword(c *gin.Context) {
+func (h *Handler) ChangePassword(c *gin.Context) {
 	var req ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -89,12 +289,18 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	// Get user by username
-	user, err := models.GetUserByUsername(username.(string))
+	user, err := h.Store.GetUserByUsername(username.(string))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
 		return
 	}
 
+	// Passwords of single sign-on accounts are managed by the identity provider
+	if user.AuthProvider != models.AuthProviderLocal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by your identity provider"})
+		return
+	}
+
 	// Check old password
 	if !models.CheckPasswordHash(req.OldPassword, user.Password) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid old password"})
@@ -102,11 +308,29 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	// Update password
-	err = models.UpdatePassword(userID.(int64), req.NewPassword)
+	err = h.Store.UpdatePassword(userID.(int64), req.NewPassword)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
+	// Log out every other session, they may have been opened with the old password
+	_, err = h.Store.RevokeUserSessions(userID.(int64), c.GetInt64("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end other sessions"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
+
+// currentUserID returns the ID of the authenticated user set by AuthMiddleware
+func currentUserID(c *gin.Context) (int64, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return 0, false
+	}
+
+	id, ok := userID.(int64)
+	return id, ok
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/yongliucc/link-deck/models"
+	xhtml "golang.org/x/net/html"
+)
+
+// Formats of exports and imports
+const (
+	formatJSON     = "json"     // ExportData, the default
+	formatNetscape = "netscape" // The bookmarks.html files of browsers
+)
+
+// bookmarksGroupName is the group bookmarks outside of any folder are imported into
+const bookmarksGroupName = "Bookmarks"
+
+// errNoBookmarks is returned for files without a bookmark list
+var errNoBookmarks = errors.New("no bookmark list found")
+
+// parseNetscapeBookmarks reads a bookmarks.html file, as browsers export it, as the data of an import.
+// Folders become groups and nested folders subgroups, keeping their order, and bookmarks outside of any
+// folder go to a group named Bookmarks. Bookmarks other than HTTP and HTTPS links, such as bookmarklets,
+// are left out, and so are icons and tags that could not be imported.
+func parseNetscapeBookmarks(file []byte, maxIconBytes int64) (ExportData, error) {
+	var (
+		groups []ExportLinkGroup
+		// open holds the groups of the open folder lists, the outermost list is 0
+		open []int64
+		// folder is the name of the folder whose list comes next
+		folder *string
+		// described is the link the next description belongs to
+		described *ExportLink
+		// rootGroup holds the bookmarks outside of any folder once there are some
+		rootGroup int64
+	)
+	groupIndex := func(id int64) int { return int(id) - 1 }
+	addGroup := func(name string, parentID int64) int64 {
+		if name == "" {
+			name = "Untitled"
+		}
+		id := int64(len(groups) + 1)
+		groups = append(groups, ExportLinkGroup{ID: id, ParentID: parentID, Name: name, Links: []ExportLink{}})
+		return id
+	}
+
+	z := xhtml.NewTokenizer(bytes.NewReader(file))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			if z.Err() != io.EOF {
+				return ExportData{}, z.Err()
+			}
+			break
+		}
+
+		name, _ := z.TagName()
+		switch {
+		case tt == xhtml.StartTagToken && string(name) == "h3":
+			title := readBookmarkText(z, "h3")
+			folder, described = &title, nil
+
+		case tt == xhtml.StartTagToken && string(name) == "dl":
+			switch {
+			case folder != nil:
+				var parentID int64
+				if len(open) > 0 {
+					parentID = open[len(open)-1]
+				}
+				open = append(open, addGroup(*folder, parentID))
+				folder = nil
+			case len(open) > 0:
+				// A list without a heading belongs to the enclosing folder
+				open = append(open, open[len(open)-1])
+			default:
+				open = append(open, 0)
+			}
+
+		case tt == xhtml.EndTagToken && string(name) == "dl":
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+			described = nil
+
+		case tt == xhtml.StartTagToken && string(name) == "a":
+			attrs := readBookmarkAttrs(z)
+			title := readBookmarkText(z, "a")
+			described = nil
+			if len(open) == 0 || !models.IsValidLinkURL(attrs["href"]) {
+				continue
+			}
+
+			groupID := open[len(open)-1]
+			if groupID == 0 {
+				if rootGroup == 0 {
+					rootGroup = addGroup(bookmarksGroupName, 0)
+				}
+				groupID = rootGroup
+			}
+			if title == "" {
+				title = attrs["href"]
+			}
+			link := ExportLink{GroupID: groupID, Name: title, URL: attrs["href"]}
+			for _, tag := range strings.Split(attrs["tags"], ",") {
+				if tags, err := models.NormalizeTags([]string{tag}); err == nil {
+					link.Tags = append(link.Tags, tags...)
+				}
+			}
+			if _, err := parseIconDataURL(attrs["icon"], maxIconBytes); err == nil {
+				link.IconData = attrs["icon"]
+			}
+
+			group := &groups[groupIndex(groupID)]
+			group.Links = append(group.Links, link)
+			described = &group.Links[len(group.Links)-1]
+
+		case tt == xhtml.StartTagToken && string(name) == "dd":
+			// The description is the text up to the next tag
+			if described != nil && z.Next() == xhtml.TextToken {
+				described.Description = truncateText(strings.TrimSpace(string(z.Text())), models.MaxDescriptionLength)
+			}
+			described = nil
+		}
+	}
+	if groups == nil {
+		return ExportData{}, errNoBookmarks
+	}
+
+	// Groups and links are ordered as in the file
+	positions := make(map[int64]int)
+	for i := range groups {
+		positions[groups[i].ParentID]++
+		groups[i].SortOrder = positions[groups[i].ParentID]
+		for j := range groups[i].Links {
+			groups[i].Links[j].SortOrder = j + 1
+		}
+	}
+
+	return ExportData{LinkGroups: groups}, nil
+}
+
+// readBookmarkAttrs returns the attributes of the current tag by lowercase name
+func readBookmarkAttrs(z *xhtml.Tokenizer) map[string]string {
+	attrs := make(map[string]string)
+	for {
+		key, value, more := z.TagAttr()
+		attrs[strings.ToLower(string(key))] = string(value)
+		if !more {
+			return attrs
+		}
+	}
+}
+
+// readBookmarkText returns the trimmed text up to the end tag of tag
+func readBookmarkText(z *xhtml.Tokenizer, tag string) string {
+	var text strings.Builder
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return strings.TrimSpace(text.String())
+		case xhtml.TextToken:
+			text.Write(z.Text())
+		case xhtml.EndTagToken:
+			if name, _ := z.TagName(); string(name) == tag {
+				return strings.TrimSpace(text.String())
+			}
+		}
+	}
+}
+
+// truncateText cuts text to at most n bytes without splitting a character
+func truncateText(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+
+	return strings.ToValidUTF8(text[:n], "")
+}
+
+// writeNetscapeBookmarks writes the exported groups as a bookmarks.html file that browsers import,
+// with a folder for each group. Links come before the subgroups of their group.
+func writeNetscapeBookmarks(w io.Writer, data ExportData) error {
+	subgroups := make(map[int64][]ExportLinkGroup)
+	for _, group := range data.LinkGroups {
+		subgroups[group.ParentID] = append(subgroups[group.ParentID], group)
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE NETSCAPE-Bookmark-file-1>\n" +
+		"<!-- This is an automatically generated file. It will be read and overwritten. DO NOT EDIT! -->\n" +
+		`<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">` + "\n" +
+		"<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n")
+
+	var write func(parentID int64, indent string)
+	write = func(parentID int64, indent string) {
+		for _, group := range subgroups[parentID] {
+			fmt.Fprintf(&b, "%s<DT><H3>%s</H3>\n%s<DL><p>\n", indent, html.EscapeString(group.Name), indent)
+			for _, link := range group.Links {
+				fmt.Fprintf(&b, `%s    <DT><A HREF="%s"`, indent, html.EscapeString(link.URL))
+				if link.IconData != "" {
+					fmt.Fprintf(&b, ` ICON="%s"`, html.EscapeString(link.IconData))
+				}
+				if len(link.Tags) > 0 {
+					fmt.Fprintf(&b, ` TAGS="%s"`, html.EscapeString(strings.Join(link.Tags, ",")))
+				}
+				fmt.Fprintf(&b, ">%s</A>\n", html.EscapeString(link.Name))
+				if link.Description != "" {
+					fmt.Fprintf(&b, "%s    <DD>%s\n", indent, html.EscapeString(link.Description))
+				}
+			}
+			write(group.ID, indent+"    ")
+			fmt.Fprintf(&b, "%s</DL><p>\n", indent)
+		}
+	}
+	write(0, "    ")
+	b.WriteString("</DL><p>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
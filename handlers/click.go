@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Limits of the click analytics
+const (
+	defaultAnalyticsDays = 7
+	maxAnalyticsDays     = 365
+	maxAnalyticsLimit    = 200
+	maxReferrerLength    = 500
+)
+
+// clickURLLifetime is how long redirect URLs work after the links were listed
+const clickURLLifetime = 7 * 24 * time.Hour
+
+// clickSignatureValue is what the redirect URL of a link is signed for, userID is 0 for public links
+// and expires the Unix time after which the URL no longer works
+func clickSignatureValue(linkID, userID, expires int64) string {
+	return fmt.Sprintf("click:%d:%d:%d", linkID, userID, expires)
+}
+
+// setClickURL sets the redirect URL that opens a link and counts the clicks of the user. The URL
+// is signed, browsers open it without a token, and carries the user the link was listed for.
+func (h *Handler) setClickURL(link *models.Link, userID int64) {
+	expires := time.Now().Add(clickURLLifetime).Unix()
+	link.ClickURL = fmt.Sprintf("/r/%d?u=%d&e=%d&sig=%s",
+		link.ID, userID, expires, h.Auth.Sign(clickSignatureValue(link.ID, userID, expires)))
+}
+
+// setClickURLs sets the redirect URLs of links for the user
+func (h *Handler) setClickURLs(links []models.Link, userID int64) {
+	for i := range links {
+		h.setClickURL(&links[i], userID)
+	}
+}
+
+// RedirectLink handles opening a link from its signed redirect URL, recording the click
+func (h *Handler) RedirectLink(c *gin.Context) {
+	linkID, err := strconv.ParseInt(c.Param("linkId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+	userID, err := strconv.ParseInt(c.DefaultQuery("u", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// Unsigned and expired requests are answered like missing links so links are not disclosed
+	expires, err := strconv.ParseInt(c.Query("e"), 10, 64)
+	if err != nil || time.Now().Unix() > expires ||
+		!h.Auth.VerifySignature(clickSignatureValue(linkID, userID, expires), c.Query("sig")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+
+	link, err := h.Store.GetLink(linkID)
+	if err == nil {
+		// Access may have been lost since the URL was signed, e.g. with a revoked share
+		err = h.checkClickAccess(link, userID)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+			return
+		}
+		log.Printf("RedirectLink: Error retrieving link %d: %v", linkID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link"})
+		return
+	}
+
+	// A click that cannot be recorded must not keep the user from their link
+	if err := h.Store.RecordClick(linkID, userID, clickReferrer(c)); err != nil {
+		log.Printf("RedirectLink: Error recording click on link %d: %v", linkID, err)
+	}
+
+	// Every click has to reach the server to be counted
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, link.URL)
+}
+
+// checkClickAccess returns sql.ErrNoRows unless the user may still read the link: an enabled
+// user who owns its group or has it shared, or for user 0, visitors, a public group
+func (h *Handler) checkClickAccess(link models.Link, userID int64) error {
+	if userID == 0 {
+		visibility, err := h.Store.GetLinkGroupVisibility(link.GroupID)
+		if err != nil {
+			return err
+		}
+		if visibility != models.VisibilityPublic {
+			return sql.ErrNoRows
+		}
+		return nil
+	}
+
+	user, err := h.Store.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		return sql.ErrNoRows
+	}
+	permission, err := h.Store.GetLinkGroupPermission(link.GroupID, userID)
+	if err != nil {
+		return err
+	}
+	if permission == "" {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// clickReferrer returns the page a click came from, cut to the length that is kept
+func clickReferrer(c *gin.Context) string {
+	referrer := c.Request.Referer()
+	if len(referrer) > maxReferrerLength {
+		referrer = referrer[:maxReferrerLength]
+	}
+
+	return referrer
+}
+
+// LinkClicks is how often a link was clicked, with the group it belongs to
+type LinkClicks struct {
+	LinkID    int64  `json:"link_id"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	GroupID   int64  `json:"group_id"`
+	GroupName string `json:"group_name"`
+	Clicks    int64  `json:"clicks"`
+}
+
+// GroupClicks is how often the links of a group were clicked
+type GroupClicks struct {
+	GroupID  int64  `json:"group_id"`
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+	// Clicks counts the links of the group itself, TotalClicks those of its subgroups too
+	Clicks      int64 `json:"clicks"`
+	TotalClicks int64 `json:"total_clicks"`
+}
+
+// DailyClicks is how often a link was clicked on a day, in UTC
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+// LinkClickHistory is how often a link was clicked on each day of a time window
+type LinkClickHistory struct {
+	LinkID int64         `json:"link_id"`
+	Clicks int64         `json:"clicks"`
+	Daily  []DailyClicks `json:"daily"`
+}
+
+// analyticsWindow reads the days parameter, the number of days counted back from today, and
+// returns the start of the first one. It writes an error response if the parameter is invalid.
+func analyticsWindow(c *gin.Context) (int, time.Time, bool) {
+	days := defaultAnalyticsDays
+	if param := c.Query("days"); param != "" {
+		var err error
+		days, err = strconv.Atoi(param)
+		if err != nil || days < 1 || days > maxAnalyticsDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Days must be between 1 and 365"})
+			return 0, time.Time{}, false
+		}
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	return days, today.AddDate(0, 0, 1-days), true
+}
+
+// readableClickCounts returns the groups the user can read, as a tree, with the click counts of all links since a time
+func (h *Handler) readableClickCounts(c *gin.Context, since time.Time) ([]models.LinkGroup, map[int64]int64, bool) {
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, nil, false
+	}
+
+	groups, err := h.Store.GetAllLinkGroups(userID)
+	if err != nil {
+		log.Printf("Analytics: Error retrieving link groups of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analytics"})
+		return nil, nil, false
+	}
+	counts, err := h.Store.CountLinkClicks(since)
+	if err != nil {
+		log.Printf("Analytics: Error counting clicks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analytics"})
+		return nil, nil, false
+	}
+
+	return groups, counts, true
+}
+
+// GetLinkAnalytics handles listing how often the links the user can read were clicked
+// in the last days, most used first. Links without clicks are listed last, for pruning.
+func (h *Handler) GetLinkAnalytics(c *gin.Context) {
+	_, since, ok := analyticsWindow(c)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if param := c.Query("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxAnalyticsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 200"})
+			return
+		}
+	}
+
+	groups, counts, ok := h.readableClickCounts(c, since)
+	if !ok {
+		return
+	}
+
+	// Initialize as empty slice instead of nil
+	entries := []LinkClicks{}
+	for _, group := range models.FlattenLinkGroups(groups) {
+		for _, link := range group.Links {
+			entries = append(entries, LinkClicks{
+				LinkID:    link.ID,
+				Name:      link.Name,
+				URL:       link.URL,
+				GroupID:   group.ID,
+				GroupName: group.Name,
+				Clicks:    counts[link.ID],
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Clicks != entries[j].Clicks {
+			return entries[i].Clicks > entries[j].Clicks
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// GetGroupAnalytics handles listing how often the links of the groups the user can read
+// were clicked in the last days, most used first
+func (h *Handler) GetGroupAnalytics(c *gin.Context) {
+	_, since, ok := analyticsWindow(c)
+	if !ok {
+		return
+	}
+
+	groups, counts, ok := h.readableClickCounts(c, since)
+	if !ok {
+		return
+	}
+
+	// Initialize as empty slice instead of nil
+	entries := []GroupClicks{}
+	var add func(group models.LinkGroup) int64
+	add = func(group models.LinkGroup) int64 {
+		i := len(entries)
+		entries = append(entries, GroupClicks{GroupID: group.ID, Name: group.Name, ParentID: group.ParentID})
+		for _, link := range group.Links {
+			entries[i].Clicks += counts[link.ID]
+		}
+		entries[i].TotalClicks = entries[i].Clicks
+		for _, subgroup := range group.Subgroups {
+			// add appends to entries, so entries[i] is only written after it returns
+			total := add(subgroup)
+			entries[i].TotalClicks += total
+		}
+		return entries[i].TotalClicks
+	}
+	for _, group := range groups {
+		add(group)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].TotalClicks != entries[j].TotalClicks {
+			return entries[i].TotalClicks > entries[j].TotalClicks
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// GetLinkClickHistory handles counting the clicks on a link for each of the last days
+func (h *Handler) GetLinkClickHistory(c *gin.Context) {
+	linkID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+
+	days, since, ok := analyticsWindow(c)
+	if !ok {
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireLinkPermission(c, linkID, userID, models.PermissionRead) {
+		return
+	}
+
+	times, err := h.Store.GetLinkClickTimes(linkID, since)
+	if err != nil {
+		log.Printf("GetLinkClickHistory: Error retrieving clicks of link %d: %v", linkID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analytics"})
+		return
+	}
+
+	history := LinkClickHistory{LinkID: linkID, Clicks: int64(len(times)), Daily: make([]DailyClicks, days)}
+	for i := range history.Daily {
+		history.Daily[i].Date = since.AddDate(0, 0, i).Format("2006-01-02")
+	}
+	for _, clickedAt := range times {
+		day := int(clickedAt.UTC().Sub(since) / (24 * time.Hour))
+		if day >= 0 && day < days {
+			history.Daily[day].Clicks++
+		}
+	}
+
+	c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"github.com/yongliucc/link-deck/auth"
+	"github.com/yongliucc/link-deck/icons"
+	"github.com/yongliucc/link-deck/middleware"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Handler holds what the HTTP handlers need. Every server has its own,
+// so several servers with different stores can run in one process.
+type Handler struct {
+	// Store holds users, link groups and everything else
+	Store models.Store
+	// Auth issues the tokens of logins
+	Auth *middleware.Auth
+	// Authenticator checks usernames and passwords, nil if password login is disabled
+	Authenticator auth.Authenticator
+	// Throttle slows down repeated failed logins
+	Throttle *auth.Throttle
+	// OIDC is the single sign-on provider, nil if single sign-on is disabled
+	OIDC *auth.OIDCProvider
+	// Icons fetches the icons of links
+	Icons *icons.Fetcher
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Health states links can be filtered by
+const (
+	healthDown      = "down"      // Checked and failing
+	healthUp        = "up"        // Checked and responding
+	healthUnchecked = "unchecked" // Not checked yet
+)
+
+// LinkHealthEntry is the health of a link with the group it belongs to
+type LinkHealthEntry struct {
+	LinkID    int64              `json:"link_id"`
+	Name      string             `json:"name"`
+	URL       string             `json:"url"`
+	GroupID   int64              `json:"group_id"`
+	GroupName string             `json:"group_name"`
+	Status    string             `json:"status"`
+	Health    *models.LinkHealth `json:"health"`
+}
+
+// healthStatus returns whether a link is up, down or unchecked
+func healthStatus(health *models.LinkHealth) string {
+	switch {
+	case health == nil:
+		return healthUnchecked
+	case health.Healthy():
+		return healthUp
+	default:
+		return healthDown
+	}
+}
+
+// healthRank orders links that are down first, then unchecked ones
+var healthRank = map[string]int{healthDown: 0, healthUnchecked: 1, healthUp: 2}
+
+// GetLinksHealth handles listing the health of the links the user can read,
+// links that are down first. The status parameter keeps only links that are down, up or unchecked.
+func (h *Handler) GetLinksHealth(c *gin.Context) {
+	status := c.Query("status")
+	if _, ok := healthRank[status]; status != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be down, up or unchecked"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	groups, err := h.Store.GetAllLinkGroups(userID)
+	if err != nil {
+		log.Printf("GetLinksHealth: Error retrieving link groups of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link health"})
+		return
+	}
+
+	// Initialize as empty slice instead of nil
+	entries := []LinkHealthEntry{}
+	for _, group := range models.FlattenLinkGroups(groups) {
+		for _, link := range group.Links {
+			entry := LinkHealthEntry{
+				LinkID:    link.ID,
+				Name:      link.Name,
+				URL:       link.URL,
+				GroupID:   group.ID,
+				GroupName: group.Name,
+				Status:    healthStatus(link.Health),
+				Health:    link.Health,
+			}
+			if status == "" || entry.Status == status {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Status != entries[j].Status {
+			return healthRank[entries[i].Status] < healthRank[entries[j].Status]
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/icons"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// iconSignatureValue is what the icon URL of a link is signed for. The version identifies the icon,
+// see models.Link.IconVersion, so URLs handed out for an earlier icon stop working.
+func iconSignatureValue(linkID int64, version string) string {
+	return fmt.Sprintf("icon:%d:%s", linkID, version)
+}
+
+// setIconURL sets where the icon of a link is served. The URL is signed, browsers load it in img tags
+// without a token, and changes along with the icon so cached icons are replaced.
+func (h *Handler) setIconURL(link *models.Link) {
+	version := link.IconVersion()
+	link.IconURL = fmt.Sprintf("/api/icons/%d?v=%s&sig=%s",
+		link.ID, version, h.Auth.Sign(iconSignatureValue(link.ID, version)))
+}
+
+// setIconURLs sets where the icons of links are served
+func (h *Handler) setIconURLs(links []models.Link) {
+	for i := range links {
+		h.setIconURL(&links[i])
+	}
+}
+
+// GetLinkIcon handles serving the icon of a link from a signed icon URL.
+// Uploaded icons are served as they are, others are fetched and cached.
+func (h *Handler) GetLinkIcon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+
+	// Unsigned requests and URLs of an earlier icon of the link are answered
+	// like missing icons so links are not disclosed
+	version := c.Query("v")
+	if !h.Auth.VerifySignature(iconSignatureValue(id, version), c.Query("sig")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Icon not found"})
+		return
+	}
+	link, err := h.Store.GetLink(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+			return
+		}
+		log.Printf("GetLinkIcon: Error retrieving link %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get icon"})
+		return
+	}
+	if link.IconVersion() != version {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Icon not found"})
+		return
+	}
+
+	icon, err := h.Store.GetLinkIcon(id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("GetLinkIcon: Error retrieving icon of link %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get icon"})
+		return
+	}
+	if err == sql.ErrNoRows || (!icon.Uploaded && h.Icons.Expired(icon.UpdatedAt, len(icon.Data) == 0)) {
+		icon, err = h.fetchLinkIcon(c.Request.Context(), link, icon)
+		if err != nil {
+			log.Printf("GetLinkIcon: Error storing icon of link %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get icon"})
+			return
+		}
+	}
+	if len(icon.Data) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Icon not found"})
+		return
+	}
+
+	// Browsers keep icons for a day, and revalidate them with the ETag after that
+	etag := `"` + models.IconSum(icon.Data) + `"`
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("ETag", etag)
+	// Uploaded SVGs could carry scripts, they must not run when an icon is opened directly
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, icon.ContentType, icon.Data)
+}
+
+// fetchLinkIcon fetches the icon of a link from its icon URL, or else from its site, and stores it.
+// Failures are stored too so they are not retried at once. With fetching disabled current is returned.
+func (h *Handler) fetchLinkIcon(ctx context.Context, link models.Link, current models.LinkIcon) (models.LinkIcon, error) {
+	var (
+		fetched icons.Icon
+		err     error
+	)
+	if link.Icon != "" {
+		fetched, err = h.Icons.Fetch(ctx, link.Icon)
+	} else {
+		fetched, err = h.Icons.FetchFavicon(ctx, link.URL)
+	}
+	if errors.Is(err, icons.ErrFetchDisabled) {
+		return current, nil
+	}
+	if err != nil {
+		log.Printf("GetLinkIcon: No icon found for link %d: %v", link.ID, err)
+	}
+
+	icon := models.LinkIcon{ContentType: fetched.ContentType, Data: fetched.Data}
+	if err := h.Store.SaveLinkIcon(link.ID, icon); err != nil {
+		return models.LinkIcon{}, err
+	}
+
+	return icon, nil
+}
+
+// UploadLinkIcon handles uploading an image as the icon of a link
+func (h *Handler) UploadLinkIcon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireLinkPermission(c, id, userID, models.PermissionWrite) {
+		return
+	}
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	defer file.Close()
+
+	// Read one byte more than allowed to tell files that are too large
+	data, err := io.ReadAll(io.LimitReader(file, h.Icons.MaxBytes()+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	icon, err := icons.Parse(data, h.Icons.MaxBytes())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Icon must be an image of at most %d KB", h.Icons.MaxBytes()>>10)})
+		return
+	}
+
+	err = h.Store.SaveLinkIcon(id, models.LinkIcon{ContentType: icon.ContentType, Data: icon.Data, Uploaded: true})
+	if err != nil {
+		log.Printf("UploadLinkIcon: Error storing icon of link %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save icon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Icon uploaded successfully"})
+}
+
+// DeleteLinkIcon handles removing the uploaded or cached icon of a link, so it is fetched again
+func (h *Handler) DeleteLinkIcon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireLinkPermission(c, id, userID, models.PermissionWrite) {
+		return
+	}
+
+	err = h.Store.DeleteLinkIcon(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Icon not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove icon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Icon removed successfully"})
+}
+
+// iconDataURL returns an icon as a data URL for exports
+func iconDataURL(icon models.LinkIcon) string {
+	return "data:" + icon.ContentType + ";base64," + base64.StdEncoding.EncodeToString(icon.Data)
+}
+
+// parseIconDataURL reads an icon from a data URL of an export
+func parseIconDataURL(dataURL string, maxBytes int64) (icons.Icon, error) {
+	rest, ok := strings.CutPrefix(dataURL, "data:")
+	if !ok {
+		return icons.Icon{}, icons.ErrNotImage
+	}
+	_, encoded, ok := strings.Cut(rest, ";base64,")
+	if !ok {
+		return icons.Icon{}, icons.ErrNotImage
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return icons.Icon{}, icons.ErrNotImage
+	}
+
+	// The content type is detected again rather than trusted
+	return icons.Parse(data, maxBytes)
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/yongliucc/link-deck/icons"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Modes of imports, deciding what happens to the groups and links already there
+const (
+	importMerge        = "merge"         // Adds the links whose URLs are new to their group
+	importReplaceGroup = "replace-group" // Replaces the links of the groups in the import, the default
+	importReplaceAll   = "replace-all"   // Deletes all of the user's groups first
+)
+
+// Actions of the changes of an import
+const (
+	importCreate = "create"
+	importUpdate = "update"
+	importDelete = "delete"
+)
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// ImportChange is a group or link an import creates, updates or deletes
+type ImportChange struct {
+	Action string `json:"action"`
+	// Type is group or link
+	Type string `json:"type"`
+	// Group is the path of the group, like Work / Databases, for links the group they are in
+	Group string `json:"group"`
+	Name  string `json:"name"`
+	URL   string `json:"url,omitempty"`
+}
+
+// ImportResult lists the changes of an import, or the changes it would make on a dry run
+type ImportResult struct {
+	Message string         `json:"message"`
+	Mode    string         `json:"mode"`
+	DryRun  bool           `json:"dry_run"`
+	Changes []ImportChange `json:"changes"`
+}
+
+// linkImport applies the groups of an import to the groups of a user within a transaction, recording the changes
+type linkImport struct {
+	tx      models.Store
+	userID  int64
+	mode    string
+	data    ExportData
+	uploads map[[2]int]icons.Icon
+	changes []ImportChange
+	// failure and failedLink describe the step that failed
+	failure, failedLink string
+}
+
+// groupPath returns the path of a group below the group at parentPath, which is empty at the top level
+func groupPath(parentPath, name string) string {
+	if parentPath == "" {
+		return name
+	}
+
+	return parentPath + " / " + name
+}
+
+// recordGroup records a change of the group at path
+func (im *linkImport) recordGroup(action, path, name string) {
+	im.changes = append(im.changes, ImportChange{Action: action, Type: "group", Group: path, Name: name})
+}
+
+// recordLink records a change of a link in the group at path
+func (im *linkImport) recordLink(action, path, name, url string) {
+	im.changes = append(im.changes, ImportChange{Action: action, Type: "link", Group: path, Name: name, URL: url})
+}
+
+// run imports the groups in order, parents before their subgroups, into the existing groups of the user
+func (im *linkImport) run(existing []models.LinkGroup, order []int) error {
+	// Only the user's own groups are matched, shared groups are left alone
+	var own []models.LinkGroup
+	paths := make(map[int64]string)
+	existingByKey := make(map[groupKey]models.LinkGroup)
+	for _, group := range models.FlattenLinkGroups(existing) {
+		if group.UserID != im.userID {
+			continue
+		}
+		key := groupKey{name: group.Name}
+		if group.ParentID != nil {
+			key.parentID = *group.ParentID
+		}
+		paths[group.ID] = groupPath(paths[key.parentID], group.Name)
+		existingByKey[key] = group
+		own = append(own, group)
+	}
+
+	if im.mode == importReplaceAll {
+		if err := im.deleteGroups(existing, own, paths); err != nil {
+			return err
+		}
+		existingByKey = make(map[groupKey]models.LinkGroup)
+	}
+
+	// Track the mapping between old and new IDs
+	groupIDMap := make(map[int64]int64)
+	for _, i := range order {
+		group := im.data.LinkGroups[i]
+
+		// Check if a group with this name already exists below the same parent
+		var parentID int64
+		if group.ParentID != 0 {
+			parentID = groupIDMap[group.ParentID]
+		}
+		path := groupPath(paths[parentID], group.Name)
+
+		existingGroup, exists := existingByKey[groupKey{parentID, group.Name}]
+		if exists {
+			// Merges keep the order of existing groups, replacing updates it and keeps the visibility
+			if im.mode != importMerge && existingGroup.SortOrder != group.SortOrder {
+				if err := im.tx.UpdateLinkGroup(existingGroup.ID, group.Name, group.SortOrder, ""); err != nil {
+					im.failure = "Failed to update existing group"
+					return err
+				}
+				im.recordGroup(importUpdate, path, group.Name)
+			}
+		} else {
+			var err error
+			existingGroup.ID, err = im.createGroup(group, parentID)
+			if err != nil {
+				return err
+			}
+			im.recordGroup(importCreate, path, group.Name)
+		}
+
+		groupIDMap[group.ID] = existingGroup.ID
+		paths[existingGroup.ID] = path
+		if err := im.importLinks(i, existingGroup.ID, path, existingGroup.Links); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteGroups deletes the user's own groups with their subgroups and links
+func (im *linkImport) deleteGroups(existing, own []models.LinkGroup, paths map[int64]string) error {
+	for _, group := range own {
+		im.recordGroup(importDelete, paths[group.ID], group.Name)
+		for _, link := range group.Links {
+			im.recordLink(importDelete, paths[group.ID], link.Name, link.URL)
+		}
+	}
+
+	for _, group := range existing {
+		if group.UserID != im.userID {
+			continue
+		}
+		if err := im.tx.DeleteLinkGroup(group.ID, im.userID); err != nil {
+			im.failure = "Failed to remove existing groups"
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createGroup creates an imported group below the group parentID, 0 at the top level
+func (im *linkImport) createGroup(group ExportLinkGroup, parentID int64) (int64, error) {
+	// Groups are private unless the export says otherwise
+	visibility := group.Visibility
+	if !models.IsValidVisibility(visibility) {
+		visibility = models.VisibilityPrivate
+	}
+
+	groupID, err := im.tx.CreateLinkGroup(im.userID, group.Name, group.SortOrder, visibility)
+	if err != nil {
+		im.failure = "Failed to import groups"
+		return 0, err
+	}
+	if parentID != 0 {
+		if err := im.tx.MoveLinkGroup(groupID, parentID); err != nil {
+			im.failure = "Failed to import groups"
+			return 0, err
+		}
+	}
+
+	return groupID, nil
+}
+
+// importLinks imports the links of the group at index i into the group groupID, which holds the existing links.
+// Merges only add the links whose URLs are new to the group. Otherwise the group ends up with the imported links:
+// existing links with their URLs are updated, keeping their clicks and health, and the other links are deleted.
+func (im *linkImport) importLinks(i int, groupID int64, path string, existing []models.Link) error {
+	links := im.data.LinkGroups[i].Links
+
+	if im.mode == importMerge {
+		urls := make(map[string]bool)
+		for _, link := range existing {
+			urls[link.URL] = true
+		}
+		for j, link := range links {
+			if urls[link.URL] {
+				continue
+			}
+			urls[link.URL] = true
+			if err := im.createLink(groupID, path, i, j); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Existing links are matched to the imported links with their URLs in order
+	byURL := make(map[string][]models.Link)
+	for _, link := range existing {
+		byURL[link.URL] = append(byURL[link.URL], link)
+	}
+	matches := make(map[int]models.Link)
+	matched := make(map[int64]bool)
+	for j, link := range links {
+		if candidates := byURL[link.URL]; len(candidates) > 0 {
+			matches[j], byURL[link.URL] = candidates[0], candidates[1:]
+			matched[candidates[0].ID] = true
+		}
+	}
+
+	// Unmatched links are deleted first so their aliases are free again
+	for _, link := range existing {
+		if matched[link.ID] {
+			continue
+		}
+		if err := im.tx.DeleteLink(link.ID); err != nil {
+			im.failure = "Failed to remove existing links"
+			return err
+		}
+		im.recordLink(importDelete, path, link.Name, link.URL)
+	}
+
+	for j := range links {
+		var err error
+		if link, ok := matches[j]; ok {
+			err = im.updateLink(link, path, i, j)
+		} else {
+			err = im.createLink(groupID, path, i, j)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createLink creates the link at index j of the group at index i in the group groupID
+func (im *linkImport) createLink(groupID int64, path string, i, j int) error {
+	link := im.data.LinkGroups[i].Links[j]
+
+	linkID, err := im.tx.CreateLink(groupID, link.Name, link.URL, link.SortOrder)
+	if err != nil {
+		im.failure = "Failed to import links"
+		return err
+	}
+	if err := im.tx.SetLinkTags(linkID, link.Tags); err != nil {
+		im.failure = "Failed to import tags"
+		return err
+	}
+	if err := im.tx.SetLinkDetails(linkID, link.details()); err != nil {
+		im.failure = "Failed to import link details"
+		return err
+	}
+	if link.Alias != "" {
+		if err := im.tx.SetLinkAlias(linkID, link.Alias); err != nil {
+			im.failure, im.failedLink = "Failed to import aliases", link.Name
+			return err
+		}
+	}
+	if icon, ok := im.uploads[[2]int{i, j}]; ok {
+		err := im.tx.SaveLinkIcon(linkID, models.LinkIcon{ContentType: icon.ContentType, Data: icon.Data, Uploaded: true})
+		if err != nil {
+			im.failure = "Failed to import icons"
+			return err
+		}
+	}
+
+	im.recordLink(importCreate, path, link.Name, link.URL)
+	return nil
+}
+
+// updateLink updates an existing link to the link at index j of the group at index i, if they differ
+func (im *linkImport) updateLink(existing models.Link, path string, i, j int) error {
+	link := im.data.LinkGroups[i].Links[j]
+	icon, uploaded := im.uploads[[2]int{i, j}]
+
+	changed, err := im.linkChanged(existing, link, icon, uploaded)
+	if err != nil {
+		im.failure = "Failed to retrieve existing links"
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := im.tx.UpdateLink(existing.ID, existing.GroupID, link.Name, link.URL, link.SortOrder); err != nil {
+		im.failure = "Failed to import links"
+		return err
+	}
+	if err := im.tx.SetLinkTags(existing.ID, link.Tags); err != nil {
+		im.failure = "Failed to import tags"
+		return err
+	}
+	if err := im.tx.SetLinkDetails(existing.ID, link.details()); err != nil {
+		im.failure = "Failed to import link details"
+		return err
+	}
+	if err := im.tx.SetLinkAlias(existing.ID, link.Alias); err != nil {
+		im.failure, im.failedLink = "Failed to import aliases", link.Name
+		return err
+	}
+	switch {
+	case uploaded:
+		err = im.tx.SaveLinkIcon(existing.ID, models.LinkIcon{ContentType: icon.ContentType, Data: icon.Data, Uploaded: true})
+	case existing.IconUploaded:
+		err = im.tx.DeleteLinkIcon(existing.ID)
+	}
+	if err != nil {
+		im.failure = "Failed to import icons"
+		return err
+	}
+
+	im.recordLink(importUpdate, path, link.Name, link.URL)
+	return nil
+}
+
+// linkChanged reports whether an imported link differs from the existing link with its URL
+func (im *linkImport) linkChanged(existing models.Link, link ExportLink, icon icons.Icon, uploaded bool) (bool, error) {
+	if existing.Name != link.Name || existing.SortOrder != link.SortOrder || existing.Alias != link.Alias ||
+		!slices.Equal(existing.Tags, link.Tags) || existing.Description != link.Description ||
+		existing.Owner != link.Owner || existing.Environment != link.Environment ||
+		!maps.Equal(existing.Metadata, link.Metadata) || existing.Icon != link.Icon || existing.IconUploaded != uploaded {
+		return true, nil
+	}
+	if !uploaded {
+		return false, nil
+	}
+
+	current, err := im.tx.GetLinkIcon(existing.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return current.ContentType != icon.ContentType || !bytes.Equal(current.Data, icon.Data), nil
+}
@@ -3,20 +3,28 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/icons"
 	"github.com/yongliucc/link-deck/models"
 )
 
 // LinkGroupRequest represents the link group request body
 type LinkGroupRequest struct {
-	Name      string `json:"name" binding:"required"`
-	SortOrder int    `json:"sort_order"`
+	Name       string `json:"name" binding:"required"`
+	SortOrder  int    `json:"sort_order"`
+	Visibility string `json:"visibility"`
+	// ParentID nests the group below another group of its owner, 0 for the top level.
+	// On update the group is moved with its subgroups, or kept where it is if omitted.
+	ParentID *int64 `json:"parent_id"`
 }
 
 // LinkRequest represents the link request body
@@ -25,23 +33,125 @@ type LinkRequest struct {
 	Name      string `json:"name" binding:"required"`
 	URL       string `json:"url" binding:"required"`
 	SortOrder int    `json:"sort_order"`
+	// Tags replace the tags of the link, on update the tags are kept if omitted
+	Tags []string `json:"tags"`
+	// Details of the link, on update each one is kept if omitted
+	Description *string           `json:"description"`
+	Owner       *string           `json:"owner"`
+	Environment *string           `json:"environment"`
+	Metadata    map[string]string `json:"metadata"`
+	// Icon is the URL of the link's icon, empty to use the favicon of its site
+	Icon *string `json:"icon"`
+	// Alias opens the link at /go/<alias>, empty for none. On update it is kept if omitted.
+	Alias *string `json:"alias"`
+}
+
+// alias returns the normalized alias of the request, empty if it sets none
+func (req LinkRequest) alias() (string, error) {
+	if req.Alias == nil {
+		return "", nil
+	}
+
+	return models.NormalizeAlias(*req.Alias)
+}
+
+// hasDetails reports whether the request sets any of the details of the link
+func (req LinkRequest) hasDetails() bool {
+	return req.Description != nil || req.Owner != nil || req.Environment != nil || req.Metadata != nil ||
+		req.Icon != nil
+}
+
+// linkDetails returns the normalized details of the request, taking those it omits from current
+func (req LinkRequest) linkDetails(current models.LinkDetails) (models.LinkDetails, error) {
+	details := current
+	if req.Description != nil {
+		details.Description = *req.Description
+	}
+	if req.Owner != nil {
+		details.Owner = *req.Owner
+	}
+	if req.Environment != nil {
+		details.Environment = *req.Environment
+	}
+	if req.Metadata != nil {
+		details.Metadata = req.Metadata
+	}
+	if req.Icon != nil {
+		details.Icon = *req.Icon
+	}
+
+	return models.NormalizeLinkDetails(details)
+}
+
+// aliasTakenMessage answers aliases another link has. Aliases are unique across all links,
+// so the message never repeats the alias, which may be in a group the user cannot read.
+const aliasTakenMessage = "Alias is not available"
+
+// maxReorderIDs is the most groups or links that can be reordered at once
+const maxReorderIDs = 1000
+
+// ReorderRequest represents the request body for reordering link groups or links
+type ReorderRequest struct {
+	// IDs in their new order, each gets its position as sort order
+	IDs []int64 `json:"ids" binding:"required"`
 }
 
-// ExportLinkGroup represents a link group for export/import without timestamps
+// valid reports whether the request lists at least one and at most maxReorderIDs distinct IDs
+func (req ReorderRequest) valid() bool {
+	if len(req.IDs) == 0 || len(req.IDs) > maxReorderIDs {
+		return false
+	}
+
+	seen := make(map[int64]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+
+	return true
+}
+
+// ExportLinkGroup represents a link group for export/import without timestamps.
+// Groups are listed with each parent before its subgroups.
 type ExportLinkGroup struct {
-	ID        int64        `json:"id"`
-	Name      string       `json:"name"`
-	SortOrder int          `json:"sort_order"`
-	Links     []ExportLink `json:"links,omitempty"`
+	ID int64 `json:"id"`
+	// ParentID is the ID of the exported group this one is nested below
+	ParentID   int64        `json:"parent_id,omitempty"`
+	Name       string       `json:"name"`
+	SortOrder  int          `json:"sort_order"`
+	Visibility string       `json:"visibility,omitempty"`
+	Links      []ExportLink `json:"links,omitempty"`
 }
 
 // ExportLink represents a link for export/import without timestamps
 type ExportLink struct {
-	ID        int64  `json:"id"`
-	GroupID   int64  `json:"group_id"`
-	Name      string `json:"name"`
-	URL       string `json:"url"`
-	SortOrder int    `json:"sort_order"`
+	ID          int64             `json:"id"`
+	GroupID     int64             `json:"group_id"`
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	SortOrder   int               `json:"sort_order"`
+	Tags        []string          `json:"tags,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Icon        string            `json:"icon,omitempty"`
+	Alias       string            `json:"alias,omitempty"`
+	// IconData is the uploaded icon of the link as a data URL
+	IconData string `json:"icon_data,omitempty"`
+}
+
+// details returns the details of the exported link
+func (l ExportLink) details() models.LinkDetails {
+	return models.LinkDetails{
+		Description: l.Description,
+		Owner:       l.Owner,
+		Environment: l.Environment,
+		Metadata:    l.Metadata,
+		Icon:        l.Icon,
+	}
 }
 
 // ExportData represents the data structure for export/import operations
@@ -50,7 +160,7 @@ type ExportData struct {
 }
 
 // GetAllLinkGroups handles getting all link groups with their links
-func GetAllLinkGroups(c *gin.Context) {
+func (h *Handler) GetAllLinkGroups(c *gin.Context) {
 	// Check if this is an admin route
 	path := c.Request.URL.Path
 	isAdminRoute := strings.Contains(path, "/admin/")
@@ -58,20 +168,21 @@ func GetAllLinkGroups(c *gin.Context) {
 	// Log the request details
 	log.Printf("GetAllLinkGroups: Processing request for %s (Admin Route: %v)", path, isAdminRoute)
 
-	// If this is an admin route, check for authentication
-	if isAdminRoute {
-		// Check if user is authenticated (AuthMiddleware should have aborted if not authenticated)
-		_, exists := c.Get("userID")
-		if !exists {
-			log.Printf("GetAllLinkGroups: User not authenticated for admin route %s", path)
-			// Just return an empty array instead of error
+	// Check if user is authenticated (AuthMiddleware should have aborted if not authenticated)
+	userID, exists := currentUserID(c)
+	if !exists {
+		log.Printf("GetAllLinkGroups: User not authenticated for %s", path)
+		if isAdminRoute {
+			// For admin route, just return an empty array instead of error
 			c.JSON(http.StatusOK, []models.LinkGroup{})
 			return
 		}
-		log.Printf("GetAllLinkGroups: User authenticated, proceeding with data retrieval")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
 	}
+	log.Printf("GetAllLinkGroups: User %d authenticated, proceeding with data retrieval", userID)
 
-	groups, err := models.GetAllLinkGroups()
+	groups, err := h.Store.GetAllLinkGroups(userID)
 	if err != nil {
 		log.Printf("GetAllLinkGroups: Error retrieving link groups: %v", err)
 		if isAdminRoute {
@@ -83,26 +194,56 @@ func GetAllLinkGroups(c *gin.Context) {
 		return
 	}
 
-	// Ensure links is never null/nil for any group
-	for i := range groups {
-		if groups[i].Links == nil {
-			groups[i].Links = []models.Link{}
-		}
+	h.prepareLinkGroups(groups, userID)
+
+	// Only show links with the requested tag
+	if tag := c.Query("tag"); tag != "" {
+		groups = models.FilterLinkGroupsByTag(groups, tag)
 	}
 
 	log.Printf("GetAllLinkGroups: Successfully retrieved %d link groups", len(groups))
 	c.JSON(http.StatusOK, groups)
 }
 
+// GetPublicLinkGroups handles getting all public link groups without authentication
+func (h *Handler) GetPublicLinkGroups(c *gin.Context) {
+	groups, err := h.Store.GetPublicLinkGroups()
+	if err != nil {
+		log.Printf("GetPublicLinkGroups: Error retrieving public link groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link groups"})
+		return
+	}
+
+	// Clicks of visitors are counted without a user
+	h.prepareLinkGroups(groups, 0)
+
+	// Only show links with the requested tag
+	if tag := c.Query("tag"); tag != "" {
+		groups = models.FilterLinkGroupsByTag(groups, tag)
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
 // GetLinksByGroupID handles getting all links for a specific group
-func GetLinksByGroupID(c *gin.Context) {
+func (h *Handler) GetLinksByGroupID(c *gin.Context) {
 	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
 		return
 	}
 
-	links, err := models.GetLinksByGroupID(groupID)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireGroupPermission(c, groupID, userID, models.PermissionRead) {
+		return
+	}
+
+	links, err := h.Store.GetLinksByGroupID(groupID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
@@ -112,18 +253,52 @@ func GetLinksByGroupID(c *gin.Context) {
 		return
 	}
 
+	h.setIconURLs(links)
+	h.setClickURLs(links, userID)
 	c.JSON(http.StatusOK, links)
 }
 
 // CreateLinkGroup handles creating a new link group
-func CreateLinkGroup(c *gin.Context) {
+func (h *Handler) CreateLinkGroup(c *gin.Context) {
 	var req LinkGroupRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	id, err := models.CreateLinkGroup(req.Name, req.SortOrder)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// New groups are private unless a visibility is given
+	if req.Visibility == "" {
+		req.Visibility = models.VisibilityPrivate
+	}
+	if !models.IsValidVisibility(req.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be private or public"})
+		return
+	}
+
+	// Subgroups belong to the owner of their parent
+	var parentID int64
+	if req.ParentID != nil {
+		parentID = *req.ParentID
+	}
+	if parentID != 0 && !h.requireGroupPermission(c, parentID, userID, models.PermissionOwner) {
+		return
+	}
+
+	var id int64
+	err := h.Store.InTx(func(tx models.Store) error {
+		var err error
+		id, err = tx.CreateLinkGroup(userID, req.Name, req.SortOrder, req.Visibility)
+		if err != nil || parentID == 0 {
+			return err
+		}
+		return tx.MoveLinkGroup(id, parentID)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link group"})
 		return
@@ -133,7 +308,7 @@ func CreateLinkGroup(c *gin.Context) {
 }
 
 // UpdateLinkGroup handles updating an existing link group
-func UpdateLinkGroup(c *gin.Context) {
+func (h *Handler) UpdateLinkGroup(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
@@ -146,12 +321,46 @@ func UpdateLinkGroup(c *gin.Context) {
 		return
 	}
 
-	err = models.UpdateLinkGroup(id, req.Name, req.SortOrder)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Only the owner may change who can see a group or where it is nested
+	need := models.PermissionWrite
+	if req.Visibility != "" {
+		if !models.IsValidVisibility(req.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be private or public"})
+			return
+		}
+		need = models.PermissionOwner
+	}
+	if req.ParentID != nil {
+		need = models.PermissionOwner
+	}
+	if !h.requireGroupPermission(c, id, userID, need) {
+		return
+	}
+	if req.ParentID != nil && *req.ParentID != 0 && !h.requireGroupPermission(c, *req.ParentID, userID, models.PermissionOwner) {
+		return
+	}
+
+	err = h.Store.InTx(func(tx models.Store) error {
+		if err := tx.UpdateLinkGroup(id, req.Name, req.SortOrder, req.Visibility); err != nil || req.ParentID == nil {
+			return err
+		}
+		return tx.MoveLinkGroup(id, *req.ParentID)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
 			return
 		}
+		if err == models.ErrGroupCycle {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A group cannot be moved into itself or its subgroups"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update link group"})
 		return
 	}
@@ -159,16 +368,31 @@ func UpdateLinkGroup(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Link group updated successfully"})
 }
 
-// DeleteLinkGroup handles deleting a link group
-func DeleteLinkGroup(c *gin.Context) {
+// DeleteLinkGroup handles deleting a link group with its subgroups
+func (h *Handler) DeleteLinkGroup(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
 		return
 	}
 
-	err = models.DeleteLinkGroup(id)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Only the owner may delete a group, even if it is shared with write access
+	if !h.requireGroupPermission(c, id, userID, models.PermissionOwner) {
+		return
+	}
+
+	err = h.Store.DeleteLinkGroup(id, userID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete link group"})
 		return
 	}
@@ -176,16 +400,159 @@ func DeleteLinkGroup(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Link group deleted successfully"})
 }
 
+// ReorderLinkGroups handles setting the order of link groups in one go
+func (h *Handler) ReorderLinkGroups(c *gin.Context) {
+	var req ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if !req.valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "IDs must be a list of 1 to 1000 distinct group IDs"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Every group must be editable by the user
+	permissions, err := h.Store.GetLinkGroupPermissions(req.IDs, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link groups"})
+		return
+	}
+	for _, id := range req.IDs {
+		permission := permissions[id]
+		if !models.CanReadGroup(permission) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		if !models.CanEditGroup(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have write access to this group"})
+			return
+		}
+	}
+
+	err = h.Store.ReorderLinkGroups(req.IDs)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder link groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Link groups reordered successfully"})
+}
+
+// ReorderLinks handles setting the order of the links of a group in one go
+func (h *Handler) ReorderLinks(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if !req.valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "IDs must be a list of 1 to 1000 distinct link IDs"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireGroupPermission(c, groupID, userID, models.PermissionWrite) {
+		return
+	}
+
+	err = h.Store.ReorderLinks(groupID, req.IDs)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "All links must belong to the group"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder links"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Links reordered successfully"})
+}
+
 // CreateLink handles creating a new link
-func CreateLink(c *gin.Context) {
+func (h *Handler) CreateLink(c *gin.Context) {
 	var req LinkRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	id, err := models.CreateLink(req.GroupID, req.Name, req.URL, req.SortOrder)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !models.IsValidLinkURL(req.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL must be an absolute http or https URL"})
+		return
+	}
+
+	tags, err := models.NormalizeTags(req.Tags)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tags must be at most 50 characters and cannot contain commas"})
+		return
+	}
+	details, err := req.linkDetails(models.LinkDetails{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link details: " + err.Error()})
+		return
+	}
+	alias, err := req.alias()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alias: " + err.Error()})
+		return
+	}
+
+	// Links can only be added to groups the user can edit
+	if !h.requireGroupPermission(c, req.GroupID, userID, models.PermissionWrite) {
+		return
+	}
+
+	var id int64
+	err = h.Store.InTx(func(tx models.Store) error {
+		var err error
+		id, err = tx.CreateLink(req.GroupID, req.Name, req.URL, req.SortOrder)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetLinkTags(id, tags); err != nil {
+			return err
+		}
+		if err := tx.SetLinkDetails(id, details); err != nil {
+			return err
+		}
+		if alias == "" {
+			return nil
+		}
+		return tx.SetLinkAlias(id, alias)
+	})
+	if err != nil {
+		if err == models.ErrAliasExists {
+			c.JSON(http.StatusConflict, gin.H{"error": aliasTakenMessage})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link"})
 		return
 	}
@@ -194,7 +561,7 @@ func CreateLink(c *gin.Context) {
 }
 
 // UpdateLink handles updating an existing link
-func UpdateLink(c *gin.Context) {
+func (h *Handler) UpdateLink(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
@@ -207,12 +574,78 @@ func UpdateLink(c *gin.Context) {
 		return
 	}
 
-	err = models.UpdateLink(id, req.GroupID, req.Name, req.URL, req.SortOrder)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !models.IsValidLinkURL(req.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL must be an absolute http or https URL"})
+		return
+	}
+
+	var tags []string
+	if req.Tags != nil {
+		tags, err = models.NormalizeTags(req.Tags)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tags must be at most 50 characters and cannot contain commas"})
+			return
+		}
+	}
+	if _, err := req.linkDetails(models.LinkDetails{}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link details: " + err.Error()})
+		return
+	}
+	alias, err := req.alias()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alias: " + err.Error()})
+		return
+	}
+
+	// The user must be able to edit both the link's current group and its new group
+	if !h.requireLinkPermission(c, id, userID, models.PermissionWrite) ||
+		!h.requireGroupPermission(c, req.GroupID, userID, models.PermissionWrite) {
+		return
+	}
+
+	err = h.Store.InTx(func(tx models.Store) error {
+		if err := tx.UpdateLink(id, req.GroupID, req.Name, req.URL, req.SortOrder); err != nil {
+			return err
+		}
+		// Omitted tags, details and aliases are kept, e.g. when links are only reordered
+		if tags != nil {
+			if err := tx.SetLinkTags(id, tags); err != nil {
+				return err
+			}
+		}
+		if req.Alias != nil {
+			if err := tx.SetLinkAlias(id, alias); err != nil {
+				return err
+			}
+		}
+		if !req.hasDetails() {
+			return nil
+		}
+		link, err := tx.GetLink(id)
+		if err != nil {
+			return err
+		}
+		details, err := req.linkDetails(link.Details())
+		if err != nil {
+			return err
+		}
+		return tx.SetLinkDetails(id, details)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
 			return
 		}
+		if err == models.ErrAliasExists {
+			c.JSON(http.StatusConflict, gin.H{"error": aliasTakenMessage})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update link"})
 		return
 	}
@@ -221,15 +654,29 @@ func UpdateLink(c *gin.Context) {
 }
 
 // DeleteLink handles deleting a link
-func DeleteLink(c *gin.Context) {
+func (h *Handler) DeleteLink(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
 		return
 	}
 
-	err = models.DeleteLink(id)
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireLinkPermission(c, id, userID, models.PermissionWrite) {
+		return
+	}
+
+	err = h.Store.DeleteLink(id)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete link"})
 		return
 	}
@@ -237,33 +684,71 @@ func DeleteLink(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Link deleted successfully"})
 }
 
-// ExportLinkGroups handles exporting all link groups and their links to a JSON file
-func ExportLinkGroups(c *gin.Context) {
-	// Get all link groups with their links
-	groups, err := models.GetAllLinkGroups()
+// ExportLinkGroups handles exporting all link groups and their links to a JSON file,
+// or with format=netscape to a bookmarks.html file for browsers
+func (h *Handler) ExportLinkGroups(c *gin.Context) {
+	format := c.DefaultQuery("format", formatJSON)
+	if format != formatJSON && format != formatNetscape {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or netscape"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Get all of the user's link groups with their links
+	groups, err := h.Store.GetAllLinkGroups(userID)
 	if err != nil {
 		log.Printf("ExportLinkGroups: Error retrieving link groups: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
 		return
 	}
 
-	// Convert to export format (without timestamps)
-	exportGroups := make([]ExportLinkGroup, 0, len(groups))
-	for _, group := range groups {
+	// Convert to export format (without timestamps), parents before their subgroups
+	exportGroups := []ExportLinkGroup{}
+	for _, group := range models.FlattenLinkGroups(groups) {
+		// Groups shared by other users belong to their owners' exports
+		if group.UserID != userID {
+			continue
+		}
+
 		exportGroup := ExportLinkGroup{
-			ID:        group.ID,
-			Name:      group.Name,
-			SortOrder: group.SortOrder,
-			Links:     make([]ExportLink, 0, len(group.Links)),
+			ID:         group.ID,
+			Name:       group.Name,
+			SortOrder:  group.SortOrder,
+			Visibility: group.Visibility,
+			Links:      make([]ExportLink, 0, len(group.Links)),
+		}
+		if group.ParentID != nil {
+			exportGroup.ParentID = *group.ParentID
 		}
 
 		for _, link := range group.Links {
 			exportLink := ExportLink{
-				ID:        link.ID,
-				GroupID:   link.GroupID,
-				Name:      link.Name,
-				URL:       link.URL,
-				SortOrder: link.SortOrder,
+				ID:          link.ID,
+				GroupID:     link.GroupID,
+				Name:        link.Name,
+				URL:         link.URL,
+				SortOrder:   link.SortOrder,
+				Tags:        link.Tags,
+				Description: link.Description,
+				Owner:       link.Owner,
+				Environment: link.Environment,
+				Metadata:    link.Metadata,
+				Icon:        link.Icon,
+				Alias:       link.Alias,
+			}
+			if link.IconUploaded {
+				icon, err := h.Store.GetLinkIcon(link.ID)
+				if err != nil {
+					log.Printf("ExportLinkGroups: Error retrieving icon of link %d: %v", link.ID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+					return
+				}
+				exportLink.IconData = iconDataURL(icon)
 			}
 			exportGroup.Links = append(exportGroup.Links, exportLink)
 		}
@@ -276,6 +761,15 @@ func ExportLinkGroups(c *gin.Context) {
 		LinkGroups: exportGroups,
 	}
 
+	if format == formatNetscape {
+		c.Header("Content-Disposition", "attachment; filename=link-deck-bookmarks.html")
+		c.Header("Content-Type", "text/html; charset=UTF-8")
+		if err := writeNetscapeBookmarks(c.Writer, exportData); err != nil {
+			log.Printf("ExportLinkGroups: Error writing bookmarks: %v", err)
+		}
+		return
+	}
+
 	// Set the response headers for file download
 	c.Header("Content-Disposition", "attachment; filename=link-deck-export.json")
 	c.Header("Content-Type", "application/json")
@@ -284,8 +778,28 @@ func ExportLinkGroups(c *gin.Context) {
 	c.JSON(http.StatusOK, exportData)
 }
 
-// ImportLinkGroups handles importing link groups and links from a JSON file
-func ImportLinkGroups(c *gin.Context) {
+// ImportLinkGroups handles importing link groups and links from a JSON file,
+// or with format=netscape from the bookmarks.html file of a browser. The mode decides
+// what happens to the links already there, and dry_run=true lists the changes without making them.
+func (h *Handler) ImportLinkGroups(c *gin.Context) {
+	format := c.DefaultQuery("format", formatJSON)
+	if format != formatJSON && format != formatNetscape {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or netscape"})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", importReplaceGroup)
+	if mode != importMerge && mode != importReplaceGroup && mode != importReplaceAll {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be merge, replace-group or replace-all"})
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dry run must be true or false"})
+		return
+	}
+
 	// Parse the multipart form
 	if err := c.Request.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
@@ -307,91 +821,221 @@ func ImportLinkGroups(c *gin.Context) {
 		return
 	}
 
-	// Parse the JSON data
+	// Parse the JSON data, or the bookmarks
 	var importData ExportData
-	if err := json.Unmarshal(fileBytes, &importData); err != nil {
+	if format == formatNetscape {
+		importData, err = parseNetscapeBookmarks(fileBytes, h.Icons.MaxBytes())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bookmarks file: " + err.Error()})
+			return
+		}
+	} else if err := json.Unmarshal(fileBytes, &importData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
 		return
 	}
 
-	// Get existing groups to check for duplicates
-	existingGroups, err := models.GetAllLinkGroups()
+	// Check the tags, details and icons before anything is imported
+	uploads := make(map[[2]int]icons.Icon)
+	for i, group := range importData.LinkGroups {
+		for j, link := range group.Links {
+			if !models.IsValidLinkURL(link.URL) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL on link " + link.Name + ": " + models.ErrInvalidLinkURL.Error()})
+				return
+			}
+
+			tags, err := models.NormalizeTags(link.Tags)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tags on link " + link.Name + ": " + err.Error()})
+				return
+			}
+			importData.LinkGroups[i].Links[j].Tags = tags
+
+			details, err := models.NormalizeLinkDetails(link.details())
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid details on link " + link.Name + ": " + err.Error()})
+				return
+			}
+			importData.LinkGroups[i].Links[j].Description = details.Description
+			importData.LinkGroups[i].Links[j].Owner = details.Owner
+			importData.LinkGroups[i].Links[j].Environment = details.Environment
+			importData.LinkGroups[i].Links[j].Metadata = details.Metadata
+			importData.LinkGroups[i].Links[j].Icon = details.Icon
+
+			alias, err := models.NormalizeAlias(link.Alias)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alias on link " + link.Name + ": " + err.Error()})
+				return
+			}
+			importData.LinkGroups[i].Links[j].Alias = alias
+
+			if link.IconData != "" {
+				icon, err := parseIconDataURL(link.IconData, h.Icons.MaxBytes())
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid icon on link " + link.Name + ": " + err.Error()})
+					return
+				}
+				uploads[[2]int{i, j}] = icon
+			}
+		}
+	}
+
+	// Parents are imported before their subgroups
+	order, err := importOrder(importData.LinkGroups)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve existing groups"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group structure: " + err.Error()})
 		return
 	}
 
-	// Create a map of existing groups by name for quick lookup
-	existingGroupsByName := make(map[string]models.LinkGroup)
-	for _, group := range existingGroups {
-		existingGroupsByName[group.Name] = group
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
 	}
 
-	// Process the import data - use a transaction for atomicity
-	tx, err := models.DB.Begin()
+	// Get the user's existing groups to match the imported ones against
+	existingGroups, err := h.Store.GetAllLinkGroups(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve existing groups"})
 		return
 	}
 
-	// Track the mapping between old and new IDs
-	groupIDMap := make(map[int64]int64)
+	// Process the import data - use a transaction for atomicity, rolled back on dry runs
+	im := &linkImport{userID: userID, mode: mode, data: importData, uploads: uploads}
+	err = h.Store.InTx(func(tx models.Store) error {
+		im.tx = tx
+		if err := im.run(existingGroups, order); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		if err == models.ErrAliasExists {
+			// The alias may be another user's, only the imported link is named
+			c.JSON(http.StatusConflict, gin.H{"error": aliasTakenMessage + " for link " + im.failedLink})
+			return
+		}
+		if im.failure == "" {
+			im.failure = "Failed to commit transaction"
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": im.failure})
+		return
+	}
 
-	// Import groups first
-	for _, group := range importData.LinkGroups {
-		var newGroupID int64
+	result := ImportResult{Message: "Data imported successfully", Mode: mode, DryRun: dryRun, Changes: im.changes}
+	if dryRun {
+		result.Message = "Nothing was imported, these are the changes the import would make"
+	}
+	if result.Changes == nil {
+		result.Changes = []ImportChange{}
+	}
+	c.JSON(http.StatusOK, result)
+}
 
-		// Check if a group with this name already exists
-		if existingGroup, exists := existingGroupsByName[group.Name]; exists {
-			// Use the existing group ID
-			newGroupID = existingGroup.ID
+// groupKey identifies a group of a user by its parent, 0 at the top level, and its name
+type groupKey struct {
+	parentID int64
+	name     string
+}
 
-			// Update the existing group's sort order
-			err := models.UpdateLinkGroupTx(tx, newGroupID, group.Name, group.SortOrder)
-			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update existing group"})
-				return
-			}
+// importOrder returns the indexes of imported groups with each parent before its subgroups.
+// It fails if a parent is not part of the import or groups are nested in a loop.
+func importOrder(groups []ExportLinkGroup) ([]int, error) {
+	indexByID := make(map[int64]int, len(groups))
+	for i, group := range groups {
+		indexByID[group.ID] = i
+	}
 
-			// Delete existing links for this group to avoid duplicates
-			err = models.DeleteLinksByGroupIDTx(tx, newGroupID)
-			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove existing links"})
-				return
-			}
-		} else {
-			// Create a new group
-			newGroupID, err = models.CreateLinkGroupTx(tx, group.Name, group.SortOrder)
-			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import groups"})
-				return
-			}
+	depths := make([]int, len(groups))
+	var depth func(i, seen int) (int, error)
+	depth = func(i, seen int) (int, error) {
+		group := groups[i]
+		if group.ParentID == 0 || depths[i] > 0 {
+			return depths[i], nil
+		}
+		if seen > len(groups) {
+			return 0, errors.New("groups are nested in a loop")
 		}
+		parent, ok := indexByID[group.ParentID]
+		if !ok {
+			return 0, fmt.Errorf("the parent of group %s is not part of the import", group.Name)
+		}
+		parentDepth, err := depth(parent, seen+1)
+		if err != nil {
+			return 0, err
+		}
+		depths[i] = parentDepth + 1
+		return depths[i], nil
+	}
 
-		// Map old ID to new ID
-		groupIDMap[group.ID] = newGroupID
+	order := make([]int, len(groups))
+	for i := range groups {
+		if _, err := depth(i, 0); err != nil {
+			return nil, err
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return depths[order[a]] < depths[order[b]]
+	})
 
-		// Import links for this group
-		for _, link := range group.Links {
-			// Use the new group ID
-			_, err := models.CreateLinkTx(tx, newGroupID, link.Name, link.URL, link.SortOrder)
-			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import links"})
-				return
-			}
+	return order, nil
+}
+
+// prepareLinkGroups makes sure every group of the tree has a links list, so it is never null,
+// and sets the icon URLs of the links and their redirect URLs for the user
+func (h *Handler) prepareLinkGroups(groups []models.LinkGroup, userID int64) {
+	for i := range groups {
+		if groups[i].Links == nil {
+			groups[i].Links = []models.Link{}
 		}
+		h.setIconURLs(groups[i].Links)
+		h.setClickURLs(groups[i].Links, userID)
+		h.prepareLinkGroups(groups[i].Subgroups, userID)
 	}
+}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
+// requireGroupPermission writes an error response unless the user holds the needed
+// permission (read, write or owner) on the group
+func (h *Handler) requireGroupPermission(c *gin.Context, groupID, userID int64, need string) bool {
+	permission, err := h.Store.GetLinkGroupPermission(groupID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link group"})
+		return false
+	}
+
+	// Report groups the user cannot see as missing so their IDs are not disclosed
+	if !models.CanReadGroup(permission) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return false
+	}
+
+	switch {
+	case need == models.PermissionWrite && !models.CanEditGroup(permission):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have write access to this group"})
+		return false
+	case need == models.PermissionOwner && permission != models.PermissionOwner:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner of this group can do this"})
+		return false
+	}
+
+	return true
+}
+
+// requireLinkPermission writes an error response unless the user holds the needed
+// permission on the group the link belongs to
+func (h *Handler) requireLinkPermission(c *gin.Context, linkID, userID int64, need string) bool {
+	groupID, err := h.Store.GetLinkGroupIDByLinkID(linkID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link"})
+		return false
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Data imported successfully"})
+	return h.requireGroupPermission(c, groupID, userID, need)
 }
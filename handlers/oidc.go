@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Cookies holding the OIDC state and nonce between the login redirect and the callback
+const (
+	oidcStateCookie = "oidc_state"
+	oidcNonceCookie = "oidc_nonce"
+	oidcCookiePath  = "/api/auth/oidc"
+	oidcCookieAge   = 10 * 60 // 10 minutes to complete the login at the IdP
+)
+
+// LoginMethods tells the login page which ways of signing in are available
+type LoginMethods struct {
+	Password bool `json:"password"`
+	OIDC     bool `json:"oidc"`
+}
+
+// GetLoginMethods handles reporting the enabled login methods
+func (h *Handler) GetLoginMethods(c *gin.Context) {
+	c.JSON(http.StatusOK, LoginMethods{
+		Password: h.Authenticator != nil,
+		OIDC:     h.OIDC != nil,
+	})
+}
+
+// OIDCLogin handles starting single sign-on by redirecting to the identity provider
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	state, err := randomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	// Remember state and nonce so the callback can check them
+	secure := isSecureRequest(c)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, oidcCookieAge, oidcCookiePath, "", secure, true)
+	c.SetCookie(oidcNonceCookie, nonce, oidcCookieAge, oidcCookiePath, "", secure, true)
+
+	c.Redirect(http.StatusFound, h.OIDC.AuthCodeURL(state, nonce))
+}
+
+// OIDCCallback handles the identity provider redirecting back after login.
+// The user is provisioned on first login and sent to the login page with a token.
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	state, _ := c.Cookie(oidcStateCookie)
+	nonce, _ := c.Cookie(oidcNonceCookie)
+
+	// The state and nonce are single use
+	secure := isSecureRequest(c)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", secure, true)
+	c.SetCookie(oidcNonceCookie, "", -1, oidcCookiePath, "", secure, true)
+
+	if errParam := c.Query("error"); errParam != "" {
+		log.Printf("OIDCCallback: Identity provider returned error %s: %s", errParam, c.Query("error_description"))
+		redirectToLogin(c, url.Values{"error": {"Single sign-on was cancelled or failed"}})
+		return
+	}
+
+	if state == "" || nonce == "" || c.Query("state") != state {
+		log.Printf("OIDCCallback: State mismatch")
+		redirectToLogin(c, url.Values{"error": {"Single sign-on session expired, please try again"}})
+		return
+	}
+
+	identity, err := h.OIDC.Exchange(c.Request.Context(), c.Query("code"), nonce)
+	if err != nil {
+		log.Printf("OIDCCallback: %v", err)
+		redirectToLogin(c, url.Values{"error": {"Single sign-on failed"}})
+		return
+	}
+
+	// Provision the user just in time, the IdP groups decide the role
+	role := h.OIDC.RoleFor(identity.Groups)
+	user, err := h.Store.ProvisionExternalUser(models.AuthProviderOIDC, identity.Subject, identity.Username, role)
+	if err != nil {
+		log.Printf("OIDCCallback: Failed to provision user %s: %v", identity.Username, err)
+		if err == models.ErrUserExists {
+			redirectToLogin(c, url.Values{"error": {"Username is already used by another account"}})
+			return
+		}
+		redirectToLogin(c, url.Values{"error": {"Failed to create user"}})
+		return
+	}
+
+	if user.Disabled {
+		redirectToLogin(c, url.Values{"error": {"Account is disabled"}})
+		return
+	}
+
+	response, err := h.startSession(c, user)
+	if err != nil {
+		log.Printf("OIDCCallback: Failed to start session for user %s: %v", user.Username, err)
+		redirectToLogin(c, url.Values{"error": {"Failed to generate token"}})
+		return
+	}
+
+	log.Printf("OIDCCallback: User %s logged in with role %s", user.Username, user.Role)
+	redirectToLogin(c, url.Values{
+		"token":         {response.Token},
+		"refresh_token": {response.RefreshToken},
+		"username":      {response.Username},
+		"role":          {response.Role},
+	})
+}
+
+// redirectToLogin sends the browser to the SPA login page with values in the URL fragment,
+// which is not sent to servers or written to access logs
+func redirectToLogin(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, "/login#"+values.Encode())
+}
+
+// isSecureRequest reports whether the request reached us, or the proxy in front of us, over HTTPS
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// randomToken returns a random URL-safe string
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
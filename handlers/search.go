@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of search results returned by default and at most
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// SearchLinks handles searching the links the user can read
+func (h *Handler) SearchLinks(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if param := c.Query("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be between 1 and 200"})
+			return
+		}
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	results, err := h.Store.SearchLinks(userID, query, limit)
+	if err != nil {
+		log.Printf("SearchLinks: Error searching links of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search links"})
+		return
+	}
+
+	for i := range results {
+		h.setIconURL(&results[i].Link)
+		h.setClickURL(&results[i].Link, userID)
+	}
+	c.JSON(http.StatusOK, results)
+}
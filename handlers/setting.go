@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Settings represents the instance-wide settings admins can change
+type Settings struct {
+	RequireAdminTwoFactor bool `json:"require_admin_2fa"`
+}
+
+// UpdateSettingsRequest represents the update settings request body, omitted settings are unchanged
+type UpdateSettingsRequest struct {
+	RequireAdminTwoFactor *bool `json:"require_admin_2fa"`
+}
+
+// GetSettings handles reading the instance-wide settings
+func (h *Handler) GetSettings(c *gin.Context) {
+	requireAdminTwoFactor, err := h.Store.GetBoolSetting(models.SettingRequireAdminTwoFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Settings{RequireAdminTwoFactor: requireAdminTwoFactor})
+}
+
+// UpdateSettings handles changing the instance-wide settings
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if req.RequireAdminTwoFactor != nil {
+		// Admins cannot lock themselves out of the admin routes
+		if *req.RequireAdminTwoFactor {
+			user, ok := h.currentUser(c)
+			if !ok {
+				return
+			}
+			if !user.TwoFactor && user.AuthProvider != models.AuthProviderOIDC {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Enable two-factor authentication for your own account first"})
+				return
+			}
+		}
+
+		err := h.Store.SetBoolSetting(models.SettingRequireAdminTwoFactor, *req.RequireAdminTwoFactor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+			return
+		}
+	}
+
+	h.GetSettings(c)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// GroupShareRequest represents the share link group request body.
+// Exactly one of Username and Team must be set.
+type GroupShareRequest struct {
+	Username   string `json:"username"`
+	Team       string `json:"team"`
+	Permission string `json:"permission" binding:"required"`
+}
+
+// GetGroupShares handles listing who a link group is shared with
+func (h *Handler) GetGroupShares(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Only the owner manages the shares of a group
+	if !h.requireGroupPermission(c, groupID, userID, models.PermissionOwner) {
+		return
+	}
+
+	shares, err := h.Store.GetGroupShares(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get group shares"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+// CreateGroupShare handles sharing a link group with a user or a team
+func (h *Handler) CreateGroupShare(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req GroupShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Username == "") == (req.Team == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body, set either username or team"})
+		return
+	}
+	if !models.IsValidSharePermission(req.Permission) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission must be read or write"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireGroupPermission(c, groupID, userID, models.PermissionOwner) {
+		return
+	}
+
+	// Resolve the user or team the group is shared with
+	var targetUserID, targetTeamID int64
+	if req.Username != "" {
+		user, err := h.Store.GetUserByUsername(req.Username)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+			return
+		}
+		if user.ID == userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this group"})
+			return
+		}
+		targetUserID = user.ID
+	} else {
+		targetTeamID, err = h.Store.GetTeamIDByName(req.Team)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get team"})
+			return
+		}
+	}
+
+	var id int64
+	if targetUserID != 0 {
+		id, err = h.Store.ShareGroupWithUser(groupID, targetUserID, req.Permission)
+	} else {
+		id, err = h.Store.ShareGroupWithTeam(groupID, targetTeamID, req.Permission)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share link group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "message": "Link group shared successfully"})
+}
+
+// DeleteGroupShare handles removing a share from a link group
+func (h *Handler) DeleteGroupShare(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	shareID, err := strconv.ParseInt(c.Param("shareId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share ID"})
+		return
+	}
+
+	userID, exists := currentUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !h.requireGroupPermission(c, groupID, userID, models.PermissionOwner) {
+		return
+	}
+
+	err = h.Store.DeleteGroupShare(groupID, shareID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group share"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group share deleted successfully"})
+}
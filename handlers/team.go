@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// TeamRequest represents the create team request body
+type TeamRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// TeamMemberRequest represents the add team member request body
+type TeamMemberRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+// GetAllTeams handles listing all teams with their members
+func (h *Handler) GetAllTeams(c *gin.Context) {
+	teams, err := h.Store.GetAllTeams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get teams"})
+		return
+	}
+
+	c.JSON(http.StatusOK, teams)
+}
+
+// CreateTeam handles creating a new team
+func (h *Handler) CreateTeam(c *gin.Context) {
+	var req TeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	id, err := h.Store.CreateTeam(req.Name)
+	if err != nil {
+		if err == models.ErrTeamExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Team already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Team created successfully"})
+}
+
+// DeleteTeam handles deleting a team
+func (h *Handler) DeleteTeam(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	err = h.Store.DeleteTeam(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+}
+
+// AddTeamMember handles adding a user to a team
+func (h *Handler) AddTeamMember(c *gin.Context) {
+	teamID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	var req TeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := h.Store.GetUserByUsername(req.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	err = h.Store.AddTeamMember(teamID, user.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add team member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team member added successfully"})
+}
+
+// RemoveTeamMember handles removing a user from a team
+func (h *Handler) RemoveTeamMember(c *gin.Context) {
+	teamID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+		return
+	}
+
+	user, err := h.Store.GetUserByUsername(c.Param("username"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	err = h.Store.RemoveTeamMember(teamID, user.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Team member not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove team member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Team member removed successfully"})
+}
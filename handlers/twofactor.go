@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// TwoFactorCodeRequest represents a request body carrying a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorStatus describes the two-factor auth state of the current user
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorEnrollment holds a new TOTP secret for the user's authenticator app
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// GetTwoFactorStatus handles reporting whether the current user has two-factor auth
+func (h *Handler) GetTwoFactorStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	status := TwoFactorStatus{Enabled: user.TwoFactor}
+
+	// Admins are told when the instance requires them to use two-factor auth
+	if user.Role == models.RoleAdmin {
+		required, err := h.Store.GetBoolSetting(models.SettingRequireAdminTwoFactor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get settings"})
+			return
+		}
+		status.Required = required
+	}
+
+	if user.TwoFactor {
+		left, err := h.Store.CountRecoveryCodes(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count recovery codes"})
+			return
+		}
+		status.RecoveryCodesLeft = left
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTwoFactor handles generating a TOTP secret for the current user.
+// Two-factor auth is only enabled once a code is confirmed with ActivateTwoFactor.
+func (h *Handler) EnrollTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	// Single sign-on logins are protected by the identity provider
+	if user.AuthProvider == models.AuthProviderOIDC {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is managed by your identity provider"})
+		return
+	}
+
+	key, err := h.Store.StartTOTPEnrollment(user.ID, user.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorEnrollment{Secret: key.Secret(), OTPAuthURI: key.URL()})
+}
+
+// ActivateTwoFactor handles enabling two-factor auth with a code from the enrolled authenticator.
+// It returns the recovery codes, which are shown only this once.
+func (h *Handler) ActivateTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	codes, ok, err := h.Store.EnableTOTP(user.ID, req.Code)
+	if err != nil {
+		log.Printf("ActivateTwoFactor: Failed to enable two-factor auth for user %s: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code or no enrollment in progress"})
+		return
+	}
+
+	log.Printf("ActivateTwoFactor: User %s enabled two-factor auth", user.Username)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor handles turning off two-factor auth for the current user, which needs a current code.
+// Wrong codes count as failed logins for the throttle.
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// A stolen access token must not allow guessing the code, wrong codes count as failed logins
+	failures, ok := h.reserveAttempt(c, user.Username)
+	if !ok {
+		return
+	}
+
+	valid, err := h.Store.VerifyTwoFactorCode(user.ID, req.Code)
+	if err != nil {
+		h.Throttle.Release(user.Username, c.ClientIP())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		log.Printf("DisableTwoFactor: Invalid two-factor code for user %s from %s (%d recent failures)", user.Username, c.ClientIP(), failures)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if err := h.Store.DisableTOTP(user.ID); err != nil {
+		h.Throttle.Release(user.Username, c.ClientIP())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	h.Throttle.Success(user.Username, c.ClientIP())
+	log.Printf("DisableTwoFactor: User %s disabled two-factor auth", user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// ResetUserTwoFactor handles an admin turning off two-factor auth of a user who lost their authenticator
+func (h *Handler) ResetUserTwoFactor(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	err = h.Store.DisableTOTP(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	log.Printf("ResetUserTwoFactor: %s reset two-factor auth of user %d", c.GetString("username"), userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset successfully"})
+}
+
+// currentUser loads the authenticated user, responding with an error if that fails
+func (h *Handler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	user, err := h.Store.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil, false
+	}
+
+	return user, true
+}
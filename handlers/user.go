@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// CreateUserRequest represents the create user request body
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
+}
+
+// UpdateUserRequest represents the update user request body
+type UpdateUserRequest struct {
+	Disabled *bool   `json:"disabled"`
+	Role     *string `json:"role"`
+}
+
+// GetAllUsers handles listing all users
+func (h *Handler) GetAllUsers(c *gin.Context) {
+	users, err := h.Store.GetAllUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateUser handles creating a new user account
+func (h *Handler) CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// New users are editors unless a role is given
+	if req.Role == "" {
+		req.Role = models.RoleEditor
+	}
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	id, err := h.Store.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		if err == models.ErrUserExists {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "User created successfully"})
+}
+
+// UpdateUser handles enabling, disabling or changing the role of a user account
+func (h *Handler) UpdateUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Disabled == nil && req.Role == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.Role != nil && !models.IsValidRole(*req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	// Admins cannot lock themselves out
+	if userID, _ := currentUserID(c); userID == id {
+		if req.Disabled != nil && *req.Disabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable your own account"})
+			return
+		}
+		if req.Role != nil && *req.Role != models.RoleAdmin {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own admin role"})
+			return
+		}
+	}
+
+	if req.Disabled != nil {
+		err = h.Store.SetUserDisabled(id, *req.Disabled)
+	}
+	if err == nil && req.Role != nil {
+		err = h.Store.SetUserRole(id, *req.Role)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+}
+
+// DeleteUser handles deleting a user account and their link deck
+func (h *Handler) DeleteUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// Users cannot delete their own account
+	if userID, _ := currentUserID(c); userID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+
+	err = h.Store.DeleteUser(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
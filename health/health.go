@@ -0,0 +1,201 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Config configures checking the health of links in the background
+type Config struct {
+	// DisableChecks turns off the background checks, e.g. without network access to the linked sites
+	DisableChecks bool `json:"disable_checks"`
+	// IntervalSeconds is the time between two rounds of checking every link
+	IntervalSeconds int `json:"interval_seconds"`
+	// TimeoutSeconds limits each check
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// Concurrency is how many links are checked at the same time
+	Concurrency int `json:"concurrency"`
+}
+
+// DefaultConfig returns the health check settings used unless configured otherwise
+func DefaultConfig() Config {
+	return Config{
+		IntervalSeconds: 15 * 60,
+		TimeoutSeconds:  10,
+		Concurrency:     4,
+	}
+}
+
+// maxErrorLength is how much of the error of a failed check is kept
+const maxErrorLength = 500
+
+// Store is where the checker finds the links to check and records their health
+type Store interface {
+	GetLinkURLs() ([]models.LinkURL, error)
+	SaveLinkHealth(linkID int64, health models.LinkHealth) error
+}
+
+// Checker checks whether links respond
+type Checker struct {
+	config Config
+	client *http.Client
+}
+
+// NewChecker returns a checker with the given settings, zero settings take their defaults
+func NewChecker(config Config) *Checker {
+	defaults := DefaultConfig()
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = defaults.IntervalSeconds
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = defaults.TimeoutSeconds
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+
+	return &Checker{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.TimeoutSeconds) * time.Second},
+	}
+}
+
+// Check requests rawURL and reports how it responded. It sends a HEAD request first and
+// falls back to GET when that fails, as some servers do not handle HEAD.
+func (c *Checker) Check(ctx context.Context, rawURL string) models.LinkHealth {
+	health := c.request(ctx, http.MethodHead, rawURL)
+	if !health.Healthy() && ctx.Err() == nil {
+		health = c.request(ctx, http.MethodGet, rawURL)
+	}
+
+	return health
+}
+
+// request sends one request to rawURL without reading the response body
+func (c *Checker) request(ctx context.Context, method, rawURL string) models.LinkHealth {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return failed(err)
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return failed(err)
+	}
+	resp.Body.Close()
+
+	return models.LinkHealth{StatusCode: resp.StatusCode, LatencyMS: time.Since(start).Milliseconds()}
+}
+
+// failed returns the health of a link whose request failed without a response
+func failed(err error) models.LinkHealth {
+	message := err.Error()
+	if len(message) > maxErrorLength {
+		message = message[:maxErrorLength]
+	}
+
+	return models.LinkHealth{Error: message}
+}
+
+// CheckAll checks every link of store once, running Concurrency checks at a time.
+// Each URL is requested once however many links point to it, and links that are
+// not HTTP or HTTPS URLs, e.g. mailto: links, are left out, as are URL templates of aliases.
+func (c *Checker) CheckAll(ctx context.Context, store Store) error {
+	links, err := store.GetLinkURLs()
+	if err != nil {
+		return err
+	}
+
+	linksByURL := make(map[string][]int64)
+	var urls []string
+	for _, link := range links {
+		parsed, err := url.Parse(link.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			strings.ContainsAny(link.URL, "{}") {
+			continue
+		}
+		if linksByURL[link.URL] == nil {
+			urls = append(urls, link.URL)
+		}
+		linksByURL[link.URL] = append(linksByURL[link.URL], link.ID)
+	}
+
+	type result struct {
+		url    string
+		health models.LinkHealth
+	}
+	pending := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range pending {
+				results <- result{u, c.Check(ctx, u)}
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		for _, u := range urls {
+			select {
+			case pending <- u:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results are saved one at a time, SQLite allows only one writer. A link that cannot
+	// be saved, e.g. because it was just deleted, does not cost the others their results.
+	var saveErrs []error
+	for result := range results {
+		if ctx.Err() != nil {
+			continue
+		}
+		for _, linkID := range linksByURL[result.url] {
+			if err := store.SaveLinkHealth(linkID, result.health); err != nil {
+				saveErrs = append(saveErrs, fmt.Errorf("link %d: %w", linkID, err))
+			}
+		}
+	}
+	if len(saveErrs) > 0 {
+		return fmt.Errorf("failed to save the health of %d links: %w", len(saveErrs), errors.Join(saveErrs...))
+	}
+
+	return ctx.Err()
+}
+
+// Run checks every link of store right away and then every interval until ctx is done
+func (c *Checker) Run(ctx context.Context, store Store) {
+	log.Printf("Checking the health of links every %d seconds", c.config.IntervalSeconds)
+
+	ticker := time.NewTicker(time.Duration(c.config.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := c.CheckAll(ctx, store); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to check the health of links: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yongliucc/link-deck/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newSite returns a local site answering each path with the given status, and counts the requests by method
+func newSite(t *testing.T, statuses map[string]int) (*httptest.Server, func(method string) int) {
+	t.Helper()
+
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method]++
+		mu.Unlock()
+
+		status, ok := statuses[r.URL.Path]
+		if !ok {
+			status = http.StatusNotFound
+		}
+		// Like some servers, /get-only does not support HEAD
+		if r.URL.Path == "/get-only" && r.Method == http.MethodHead {
+			status = http.StatusMethodNotAllowed
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(2 * time.Second)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(site.Close)
+
+	return site, func(method string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[method]
+	}
+}
+
+func TestCheck(t *testing.T) {
+	site, requests := newSite(t, map[string]int{"/up": http.StatusOK, "/get-only": http.StatusOK, "/slow": http.StatusOK})
+	checker := NewChecker(Config{TimeoutSeconds: 1})
+	ctx := context.Background()
+
+	if health := checker.Check(ctx, site.URL+"/up"); health.StatusCode != http.StatusOK || !health.Healthy() || health.Error != "" {
+		t.Errorf("Check of a working link = %+v", health)
+	}
+	if requests(http.MethodGet) != 0 {
+		t.Errorf("sent GET although HEAD worked")
+	}
+
+	if health := checker.Check(ctx, site.URL+"/get-only"); health.StatusCode != http.StatusOK {
+		t.Errorf("Check of a link without HEAD = %+v, want the status of GET", health)
+	}
+	if health := checker.Check(ctx, site.URL+"/gone"); health.StatusCode != http.StatusNotFound || health.Healthy() {
+		t.Errorf("Check of a dead link = %+v", health)
+	}
+	if health := checker.Check(ctx, site.URL+"/slow"); health.StatusCode != 0 || health.Error == "" {
+		t.Errorf("Check of a link slower than the timeout = %+v", health)
+	}
+}
+
+// memoryStore keeps the health of links in memory
+type memoryStore struct {
+	urls   []models.LinkURL
+	health map[int64]models.LinkHealth
+	// failing are the links whose health cannot be saved
+	failing map[int64]bool
+}
+
+func (s *memoryStore) GetLinkURLs() ([]models.LinkURL, error) {
+	return s.urls, nil
+}
+
+func (s *memoryStore) SaveLinkHealth(linkID int64, health models.LinkHealth) error {
+	if s.failing[linkID] {
+		return errors.New("FOREIGN KEY constraint failed")
+	}
+	s.health[linkID] = health
+	return nil
+}
+
+func TestCheckAll(t *testing.T) {
+	site, requests := newSite(t, map[string]int{"/up": http.StatusOK})
+	store := &memoryStore{
+		urls: []models.LinkURL{
+			{ID: 1, URL: site.URL + "/up"},
+			{ID: 2, URL: site.URL + "/up"},
+			{ID: 3, URL: site.URL + "/gone"},
+			{ID: 4, URL: "mailto:oncall@example.com"},
+			{ID: 5, URL: site.URL + "/pull/{n}"},
+		},
+		health: make(map[int64]models.LinkHealth),
+	}
+
+	if err := NewChecker(Config{Concurrency: 2}).CheckAll(context.Background(), store); err != nil {
+		t.Fatalf("CheckAll: %v", err)
+	}
+	if !store.health[1].Healthy() || !store.health[2].Healthy() || store.health[3].StatusCode != http.StatusNotFound {
+		t.Errorf("health after CheckAll %+v", store.health)
+	}
+	if _, ok := store.health[4]; ok {
+		t.Errorf("checked a link that is not an HTTP URL")
+	}
+	if _, ok := store.health[5]; ok {
+		t.Errorf("checked the URL template of an alias")
+	}
+	// /up once with HEAD, /gone with HEAD and then GET
+	if got := requests(http.MethodHead); got != 2 {
+		t.Errorf("sent %d HEAD requests, want each URL checked once", got)
+	}
+}
+
+func TestCheckAllKeepsGoingAfterSaveErrors(t *testing.T) {
+	site, _ := newSite(t, map[string]int{"/up": http.StatusOK, "/a": http.StatusOK, "/b": http.StatusOK})
+	store := &memoryStore{
+		urls: []models.LinkURL{
+			{ID: 1, URL: site.URL + "/up"},
+			{ID: 2, URL: site.URL + "/a"},
+			{ID: 3, URL: site.URL + "/b"},
+		},
+		health:  make(map[int64]models.LinkHealth),
+		failing: map[int64]bool{1: true},
+	}
+
+	err := NewChecker(Config{Concurrency: 1}).CheckAll(context.Background(), store)
+	if err == nil || !strings.Contains(err.Error(), "link 1") {
+		t.Errorf("CheckAll returned %v, want the error of link 1", err)
+	}
+	if !store.health[2].Healthy() || !store.health[3].Healthy() {
+		t.Errorf("health after a failed save %+v, want the other links saved", store.health)
+	}
+}
+
+func TestCheckAllLinkDeletedDuringRound(t *testing.T) {
+	models.BcryptCost = bcrypt.MinCost
+	store, err := models.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("open memory store: %v", err)
+	}
+	defer store.Close()
+	userID, err := store.CreateUser("alice", "password", models.RoleEditor)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	groupID, err := store.CreateLinkGroup(userID, "Ops", 1, models.VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	// The site deletes the link to /deleted while it is being checked
+	var deletedID int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/deleted" {
+			if err := store.DeleteLink(deletedID); err != nil && err != sql.ErrNoRows {
+				t.Errorf("delete link: %v", err)
+			}
+		}
+	}))
+	defer site.Close()
+
+	var ids []int64
+	for i, path := range []string{"/deleted", "/a", "/b"} {
+		id, err := store.CreateLink(groupID, path, site.URL+path, i+1)
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	deletedID = ids[0]
+
+	if err := NewChecker(Config{Concurrency: 1}).CheckAll(context.Background(), store); err != nil {
+		t.Fatalf("CheckAll: %v", err)
+	}
+	for _, id := range ids[1:] {
+		if link, err := store.GetLink(id); err != nil || link.Health == nil || !link.Health.Healthy() {
+			t.Errorf("health of link %d %+v, %v", id, link.Health, err)
+		}
+	}
+}
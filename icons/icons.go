@@ -0,0 +1,318 @@
+package icons
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Config configures fetching the icons of links
+type Config struct {
+	// DisableFetch turns off fetching favicons and icon URLs, e.g. without network access to the linked sites
+	DisableFetch bool `json:"disable_fetch"`
+	// AllowPrivateAddresses lets icons be fetched from loopback, link-local and private addresses,
+	// e.g. for links to intranet sites. Anyone who can edit links can then make the server request them.
+	AllowPrivateAddresses bool `json:"allow_private_addresses"`
+	// TimeoutSeconds limits each fetch
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// MaxBytes is the largest icon accepted, fetched or uploaded
+	MaxBytes int64 `json:"max_bytes"`
+	// CacheSeconds is how long fetched icons are kept before they are fetched again.
+	// Failed fetches are retried after a tenth of it.
+	CacheSeconds int `json:"cache_seconds"`
+}
+
+// DefaultConfig returns the icon settings used unless configured otherwise
+func DefaultConfig() Config {
+	return Config{
+		TimeoutSeconds: 5,
+		MaxBytes:       256 << 10,
+		CacheSeconds:   7 * 24 * 60 * 60,
+	}
+}
+
+// maxPageBytes is how much of a page is read looking for its icon links
+const maxPageBytes = 1 << 20
+
+// Errors returned when no icon can be had
+var (
+	ErrFetchDisabled = errors.New("fetching icons is disabled")
+	ErrNotFound      = errors.New("no icon found")
+	ErrNotImage      = errors.New("icon is not an image")
+	ErrTooLarge      = errors.New("icon is too large")
+	// ErrPrivateAddress is returned for sites that resolve to addresses not reachable from the internet
+	ErrPrivateAddress = errors.New("icon address is not public")
+)
+
+// nonPublicPrefixes are the special-purpose ranges that are neither loopback, link-local nor
+// private but still not reachable from the internet
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// isPublicAddress reports whether addr is an address of the internet, unlike loopback,
+// link-local addresses such as cloud metadata services, and private networks
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Icon is an image with its content type
+type Icon struct {
+	ContentType string
+	Data        []byte
+}
+
+// Parse checks that data is an image of at most maxBytes and returns it with its content type
+func Parse(data []byte, maxBytes int64) (Icon, error) {
+	if int64(len(data)) > maxBytes {
+		return Icon{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		// SVG is XML, which is only recognized as text
+		trimmed := bytes.TrimSpace(data)
+		if !bytes.HasPrefix(trimmed, []byte("<")) || !bytes.Contains(trimmed, []byte("<svg")) {
+			return Icon{}, ErrNotImage
+		}
+		contentType = "image/svg+xml"
+	}
+
+	return Icon{ContentType: contentType, Data: data}, nil
+}
+
+// Fetcher fetches icons over HTTP
+type Fetcher struct {
+	config Config
+	client *http.Client
+	// allowAddress decides which addresses may be connected to
+	allowAddress func(netip.Addr) bool
+}
+
+// NewFetcher returns a fetcher with the given settings, zero settings take their defaults
+func NewFetcher(config Config) *Fetcher {
+	defaults := DefaultConfig()
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = defaults.TimeoutSeconds
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaults.MaxBytes
+	}
+	if config.CacheSeconds <= 0 {
+		config.CacheSeconds = defaults.CacheSeconds
+	}
+
+	f := &Fetcher{config: config, allowAddress: isPublicAddress}
+	if config.AllowPrivateAddresses {
+		f.allowAddress = func(netip.Addr) bool { return true }
+	}
+
+	// Addresses are checked as connections are made, after the names are resolved, so neither
+	// DNS answers nor redirects can lead to internal services. Proxies are not used, the server
+	// would check the address of the proxy instead of the site.
+	dialer := &net.Dialer{Timeout: time.Duration(config.TimeoutSeconds) * time.Second, Control: f.checkAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	f.client = &http.Client{Transport: transport, Timeout: time.Duration(config.TimeoutSeconds) * time.Second}
+
+	return f
+}
+
+// checkAddress refuses connections to addresses that are not allowed
+func (f *Fetcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !f.allowAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addr)
+	}
+
+	return nil
+}
+
+// MaxBytes returns the size limit of icons
+func (f *Fetcher) MaxBytes() int64 {
+	return f.config.MaxBytes
+}
+
+// Expired reports whether an icon fetched at fetchedAt should be fetched again.
+// Failed fetches are retried sooner than icons that were found.
+func (f *Fetcher) Expired(fetchedAt time.Time, failed bool) bool {
+	maxAge := time.Duration(f.config.CacheSeconds) * time.Second
+	if failed {
+		maxAge /= 10
+	}
+
+	return time.Since(fetchedAt) > maxAge
+}
+
+// Fetch downloads the icon at iconURL
+func (f *Fetcher) Fetch(ctx context.Context, iconURL string) (Icon, error) {
+	if f.config.DisableFetch {
+		return Icon{}, ErrFetchDisabled
+	}
+
+	body, err := f.get(ctx, iconURL, f.config.MaxBytes+1)
+	if err != nil {
+		return Icon{}, err
+	}
+
+	return Parse(body, f.config.MaxBytes)
+}
+
+// FetchFavicon finds the icon of the page at pageURL, from the icon links in its head
+// or else the favicon.ico of its site
+func (f *Fetcher) FetchFavicon(ctx context.Context, pageURL string) (Icon, error) {
+	if f.config.DisableFetch {
+		return Icon{}, ErrFetchDisabled
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return Icon{}, ErrNotFound
+	}
+
+	// Icons of the page are tried first, a page that cannot be read may still have a favicon.ico
+	var candidates []string
+	if page, final, err := f.getPage(ctx, pageURL); err == nil {
+		base = final
+		for _, href := range iconLinks(page) {
+			if ref, err := url.Parse(href); err == nil {
+				candidates = append(candidates, base.ResolveReference(ref).String())
+			}
+		}
+	}
+	candidates = append(candidates, base.Scheme+"://"+base.Host+"/favicon.ico")
+
+	err = ErrNotFound
+	for _, candidate := range candidates {
+		var icon Icon
+		if icon, err = f.Fetch(ctx, candidate); err == nil {
+			return icon, nil
+		}
+	}
+
+	return Icon{}, err
+}
+
+// getPage reads the start of the page at pageURL, returning the URL it was read from after redirects
+func (f *Fetcher) getPage(ctx context.Context, pageURL string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, ErrNotFound
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return page, resp.Request.URL, nil
+}
+
+// get reads at most limit bytes of the body at rawURL
+func (f *Fetcher) get(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, ErrNotFound
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch icon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrNotFound
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// iconLinks returns the hrefs of the icon links in the head of an HTML page,
+// icons before apple-touch-icons
+func iconLinks(page []byte) []string {
+	var icons, touchIcons []string
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return append(icons, touchIcons...)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "body":
+				// Icon links belong in the head
+				return append(icons, touchIcons...)
+			case "link":
+				var rel, href string
+				for hasAttr {
+					var key, value []byte
+					key, value, hasAttr = tokenizer.TagAttr()
+					switch string(key) {
+					case "rel":
+						rel = strings.ToLower(string(value))
+					case "href":
+						href = strings.TrimSpace(string(value))
+					}
+				}
+				if href == "" {
+					continue
+				}
+				for _, token := range strings.Fields(rel) {
+					if token == "icon" {
+						icons = append(icons, href)
+						break
+					}
+					if token == "apple-touch-icon" {
+						touchIcons = append(touchIcons, href)
+						break
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package icons
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pngIcon is the start of a PNG file, enough to be recognized as one
+var pngIcon = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// icoIcon is the start of an ICO file
+var icoIcon = []byte("\x00\x00\x01\x00\x01\x00\x10\x10")
+
+// newSite returns a local site serving the given paths, and counts the requests of each path.
+// Fetchers need AllowPrivateAddresses to reach it.
+func newSite(t *testing.T, paths map[string]string) (*httptest.Server, map[string]int) {
+	t.Helper()
+
+	requests := make(map[string]int)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		body, ok := paths[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(site.Close)
+
+	return site, requests
+}
+
+func TestFetchFavicon(t *testing.T) {
+	fetcher := NewFetcher(Config{AllowPrivateAddresses: true})
+	ctx := context.Background()
+
+	t.Run("icon link", func(t *testing.T) {
+		site, requests := newSite(t, map[string]string{
+			"/app/":                `<html><head><link rel="apple-touch-icon" href="/touch.png"><link rel="Shortcut Icon" href="static/icon.png"></head></html>`,
+			"/app/static/icon.png": string(pngIcon),
+			"/touch.png":           string(icoIcon),
+		})
+		icon, err := fetcher.FetchFavicon(ctx, site.URL+"/app/")
+		if err != nil || icon.ContentType != "image/png" || !bytes.Equal(icon.Data, pngIcon) {
+			t.Errorf("FetchFavicon = %+v, %v, want the icon link resolved against the page", icon, err)
+		}
+		if requests["/touch.png"] != 0 || requests["/favicon.ico"] != 0 {
+			t.Errorf("fetched fallbacks although the icon link worked: %v", requests)
+		}
+	})
+
+	t.Run("broken icon link", func(t *testing.T) {
+		site, _ := newSite(t, map[string]string{
+			"/":                 `<link rel="icon" href="/missing.png"><link rel="icon" href="/not-an-image.png">`,
+			"/not-an-image.png": "<html>error page</html>",
+			"/favicon.ico":      string(icoIcon),
+		})
+		icon, err := fetcher.FetchFavicon(ctx, site.URL)
+		if err != nil || icon.ContentType != "image/x-icon" {
+			t.Errorf("FetchFavicon = %+v, %v, want favicon.ico", icon, err)
+		}
+	})
+
+	t.Run("links after the head", func(t *testing.T) {
+		site, _ := newSite(t, map[string]string{
+			"/":         `<html><body><link rel="icon" href="/body.png"></body></html>`,
+			"/body.png": string(pngIcon),
+		})
+		if _, err := fetcher.FetchFavicon(ctx, site.URL); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FetchFavicon error %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("page not found", func(t *testing.T) {
+		site, _ := newSite(t, map[string]string{"/favicon.ico": string(icoIcon)})
+		if _, err := fetcher.FetchFavicon(ctx, site.URL+"/gone"); err != nil {
+			t.Errorf("FetchFavicon error %v, want favicon.ico of the site", err)
+		}
+	})
+
+	t.Run("not HTTP", func(t *testing.T) {
+		if _, err := fetcher.FetchFavicon(ctx, "ftp://example.com/"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FetchFavicon error %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		site, requests := newSite(t, map[string]string{"/favicon.ico": string(icoIcon)})
+		disabled := NewFetcher(Config{DisableFetch: true, AllowPrivateAddresses: true})
+		if _, err := disabled.FetchFavicon(ctx, site.URL); !errors.Is(err, ErrFetchDisabled) || len(requests) != 0 {
+			t.Errorf("FetchFavicon error %v with requests %v, want ErrFetchDisabled", err, requests)
+		}
+	})
+}
+
+func TestFetch(t *testing.T) {
+	site, _ := newSite(t, map[string]string{
+		"/icon.svg":  `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+		"/large.png": string(pngIcon) + string(make([]byte, 200)),
+	})
+	fetcher := NewFetcher(Config{MaxBytes: 128, AllowPrivateAddresses: true})
+	ctx := context.Background()
+
+	if icon, err := fetcher.Fetch(ctx, site.URL+"/icon.svg"); err != nil || icon.ContentType != "image/svg+xml" {
+		t.Errorf("Fetch of an SVG = %+v, %v", icon, err)
+	}
+	if _, err := fetcher.Fetch(ctx, site.URL+"/large.png"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Fetch of a large icon error %v, want ErrTooLarge", err)
+	}
+	if _, err := fetcher.Fetch(ctx, site.URL+"/missing.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fetch of a missing icon error %v, want ErrNotFound", err)
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	site, requests := newSite(t, map[string]string{"/favicon.ico": string(icoIcon)})
+	fetcher := NewFetcher(Config{})
+
+	if _, err := fetcher.Fetch(ctx, site.URL+"/favicon.ico"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Fetch from a loopback address error %v, want ErrPrivateAddress", err)
+	}
+	// Names are checked by the addresses they resolve to
+	if _, err := fetcher.FetchFavicon(ctx, strings.Replace(site.URL, "127.0.0.1", "localhost", 1)); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("FetchFavicon from localhost error %v, want ErrPrivateAddress", err)
+	}
+	if _, err := fetcher.Fetch(ctx, "http://169.254.169.254/latest/meta-data/"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Fetch from the metadata address error %v, want ErrPrivateAddress", err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("site was requested: %v", requests)
+	}
+}
+
+func TestFetchRefusesRedirectsToPrivateAddresses(t *testing.T) {
+	// The internal site listens on another loopback address than the one standing in for the internet
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("no second loopback address: %v", err)
+	}
+	internal := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("internal site was requested: %s", r.URL)
+	}))
+	internal.Listener.Close()
+	internal.Listener = listener
+	internal.Start()
+	t.Cleanup(internal.Close)
+
+	site := httptest.NewServer(http.RedirectHandler(internal.URL+"/secret.png", http.StatusFound))
+	t.Cleanup(site.Close)
+
+	fetcher := NewFetcher(Config{})
+	fetcher.allowAddress = func(addr netip.Addr) bool { return addr == netip.MustParseAddr("127.0.0.1") }
+	if _, err := fetcher.Fetch(context.Background(), site.URL+"/icon.png"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Fetch redirected to an internal address error %v, want ErrPrivateAddress", err)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	for address, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"fd00::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::":               false,
+		"::ffff:127.0.0.1": false,
+		"::ffff:10.0.0.1":  false,
+		"224.0.0.1":        false,
+	} {
+		if got := isPublicAddress(netip.MustParseAddr(address)); got != want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if icon, err := Parse(pngIcon, 1024); err != nil || icon.ContentType != "image/png" {
+		t.Errorf("Parse of a PNG = %+v, %v", icon, err)
+	}
+	if _, err := Parse([]byte("plain text"), 1024); !errors.Is(err, ErrNotImage) {
+		t.Errorf("Parse of text error %v, want ErrNotImage", err)
+	}
+	if _, err := Parse(pngIcon, 4); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Parse of a large icon error %v, want ErrTooLarge", err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	fetcher := NewFetcher(Config{CacheSeconds: 1000})
+	if fetcher.Expired(time.Now().Add(-500*time.Second), false) {
+		t.Error("icon expired before the cache time")
+	}
+	if !fetcher.Expired(time.Now().Add(-500*time.Second), true) {
+		t.Error("failed fetch not retried after a tenth of the cache time")
+	}
+}
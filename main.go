@@ -1,67 +1,23 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/yongliucc/link-deck/handlers"
-	"github.com/yongliucc/link-deck/middleware"
 	"github.com/yongliucc/link-deck/models"
+	"github.com/yongliucc/link-deck/server"
 )
 
-type Config struct {
-	Server struct {
-		Port int `json:"port"`
-		CORS struct {
-			AllowedOrigins []string `json:"allowed_origins"`
-			AllowedMethods []string `json:"allowed_methods"`
-			AllowedHeaders []string `json:"allowed_headers"`
-		} `json:"cors"`
-	} `json:"server"`
-	Database struct {
-		Path string `json:"path"`
-	} `json:"database"`
-	Auth struct {
-		JWTSecret string `json:"jwt_secret"`
-	} `json:"auth"`
-}
-
-func loadConfig(configPath string) (*Config, error) {
-	var config Config
-
-	// Default values
-	config.Server.Port = 8080
-	config.Server.CORS.AllowedOrigins = []string{"*"}
-	config.Server.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.Server.CORS.AllowedHeaders = []string{"Content-Type", "Authorization"}
-
-	// If config path is provided, load from file
-	if configPath != "" {
-		file, err := os.Open(configPath)
-		if err != nil {
-			return nil, err
-		}
-		defer file.Close()
-
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&config); err != nil {
-			return nil, err
-		}
-	}
-
-	return &config, nil
-}
-
 func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "", "Path to config file")
 	devMode := flag.Bool("dev", false, "Run in development mode")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "Show the database migrations that would run and exit")
+	migrateTo := flag.Int("migrate-to", -1, "Migrate the database up or down to this schema version and exit")
 	flag.Parse()
 
 	// If in dev mode and no config specified, use the dev config
@@ -71,22 +27,50 @@ func main() {
 	}
 
 	// Load configuration
-	config, err := loadConfig(*configPath)
+	config, err := server.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Set JWT secret from config
-	if config.Auth.JWTSecret != "" {
-		os.Setenv("JWT_SECRET", config.Auth.JWTSecret)
+	// Open the database
+	dsn := config.DatabaseDSN()
+	if config.Database.Driver == models.DriverSQLite {
+		log.Printf("Using database at: %s", dsn)
 	}
+	store, err := models.OpenStore(config.Database.Driver, dsn)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer store.Close()
+	log.Println("Database connection established")
 
-	// Initialize database
-	if config.Database.Path != "" {
-		os.Setenv("DB_PATH", config.Database.Path)
+	// Migration commands work on the database and exit without starting the server
+	if *migrateDryRun || *migrateTo >= 0 {
+		steps, err := store.Migrate(*migrateTo, *migrateDryRun)
+		if err != nil {
+			store.Close()
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(steps) == 0 {
+			log.Println("Database schema is up to date")
+		}
+		return
+	}
+
+	// Bring the schema up to date and make sure there is an admin.
+	// This refuses to start against a database migrated by a newer version of link-deck.
+	steps, err := store.Migrate(-1, false)
+	if err != nil {
+		store.Close()
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	if len(steps) == 0 {
+		log.Println("Database schema is up to date")
+	}
+	if err := models.SeedAdmin(store); err != nil {
+		store.Close()
+		log.Fatalf("Failed to create admin user: %v", err)
 	}
-	models.InitDB()
-	defer models.CloseDB()
 
 	// Set the server mode based on environment variable or dev flag
 	if *devMode {
@@ -100,125 +84,15 @@ func main() {
 		}
 	}
 
-	// Create a default gin router
-	router := gin.Default()
-
-	// Log middleware (only in debug mode)
-	if gin.Mode() == gin.DebugMode {
-		router.Use(func(c *gin.Context) {
-			// Log request details
-			log.Printf("Request: %s %s", c.Request.Method, c.Request.URL.Path)
-
-			// Log headers in debug mode
-			log.Printf("Headers:")
-			for key, values := range c.Request.Header {
-				log.Printf("  %s: %v", key, values)
-			}
-
-			// Proceed with request
-			c.Next()
-
-			// Log response status
-			log.Printf("Response: %d", c.Writer.Status())
-
-			// Log response headers
-			log.Printf("Response Headers:")
-			for key, values := range c.Writer.Header() {
-				log.Printf("  %s: %v", key, values)
-			}
-		})
-	}
-
-	// Enable CORS
-	router.Use(func(c *gin.Context) {
-		// Get origin
-		origin := c.Request.Header.Get("Origin")
-
-		// Check if origin is allowed
-		allowedOrigin := "*"
-		if len(config.Server.CORS.AllowedOrigins) > 0 {
-			if origin != "" {
-				allowed := false
-				for _, allowedOrigin := range config.Server.CORS.AllowedOrigins {
-					if allowedOrigin == "*" || allowedOrigin == origin {
-						allowed = true
-						break
-					}
-				}
-
-				if allowed {
-					allowedOrigin = origin
-				} else {
-					allowedOrigin = config.Server.CORS.AllowedOrigins[0]
-				}
-			}
-		}
-
-		c.Writer.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-		c.Writer.Header().Set("Access-Control-Allow-Methods", strings.Join(config.Server.CORS.AllowedMethods, ", "))
-		c.Writer.Header().Set("Access-Control-Allow-Headers", strings.Join(config.Server.CORS.AllowedHeaders, ", "))
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-
-		c.Next()
-	})
-
-	// API routes
-	api := router.Group("/api")
-	{
-		// Public routes - only login is public now
-		api.POST("/login", handlers.Login)
-
-		// All other routes are protected
-		protected := api.Group("")
-		protected.Use(middleware.AuthMiddleware())
-		{
-			// Links route - now protected
-			protected.GET("/links", handlers.GetAllLinkGroups)
-
-			// Admin routes
-			admin := protected.Group("/admin")
-			{
-				// User routes
-				admin.POST("/change-password", handlers.ChangePassword)
-
-				// Link group routes
-				admin.GET("/link-groups", handlers.GetAllLinkGroups)
-				admin.POST("/link-groups", handlers.CreateLinkGroup)
-				admin.PUT("/link-groups/:id", handlers.UpdateLinkGroup)
-				admin.DELETE("/link-groups/:id", handlers.DeleteLinkGroup)
-
-				// Link routes
-				admin.GET("/link-groups/:id/links", handlers.GetLinksByGroupID)
-				admin.POST("/links", handlers.CreateLink)
-				admin.PUT("/links/:id", handlers.UpdateLink)
-				admin.DELETE("/links/:id", handlers.DeleteLink)
-
-				// Import/Export routes
-				admin.GET("/export", handlers.ExportLinkGroups)
-				admin.POST("/import", handlers.ImportLinkGroups)
-			}
-		}
+	srv, err := server.New(config, store)
+	if err != nil {
+		store.Close()
+		log.Fatalf("Failed to set up server: %v", err)
 	}
 
 	// In production or combined mode, serve static files from the UI build directory
 	if !*devMode {
-		// Serve static files from the UI build directory
-		router.StaticFS("/assets", http.Dir("./ui/dist/assets"))
-		router.StaticFile("/favicon.ico", "./ui/dist/favicon.ico")
-
-		// Handle any routes that don't match static files
-		router.NoRoute(func(c *gin.Context) {
-			if gin.Mode() == gin.DebugMode {
-				log.Printf("No route found for %s, serving index.html", c.Request.URL.Path)
-			}
-			// Serve the index.html for any unmatched routes (for SPA routing)
-			c.File("./ui/dist/index.html")
-		})
+		srv.ServeUI("./ui/dist")
 	}
 
 	// Get port from environment variable, config, or use default
@@ -234,7 +108,7 @@ func main() {
 
 	// Start the server
 	log.Printf("Server starting on port %s in %s mode...\n", port, gin.Mode())
-	if err := router.Run(":" + port); err != nil {
+	if err := srv.Run(":" + port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
@@ -2,36 +2,61 @@ package middleware
 
 import (
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/yongliucc/link-deck/models"
 	"log"
 )
 
+// Token lifetimes. Access tokens are short lived, clients use their refresh token
+// (see models.Session) to get a new one.
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
 // JWTClaims represents the claims in the JWT
 type JWTClaims struct {
-	UserID   int64  `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID int64  `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token
-func GenerateToken(userID int64, username string) (string, error) {
-	// Get JWT secret from environment variable or use default
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key" // Default secret key (change in production)
+// DefaultJWTSecret signs tokens when no secret is configured (change in production)
+const DefaultJWTSecret = "your-secret-key"
+
+// Auth issues and checks the tokens of one server
+type Auth struct {
+	secret []byte
+	store  models.Store
+}
+
+// NewAuth returns an Auth signing tokens with secret and looking up sessions,
+// users and API tokens in store. An empty secret means DefaultJWTSecret.
+func NewAuth(secret string, store models.Store) *Auth {
+	if secret == "" {
+		secret = DefaultJWTSecret
 	}
 
+	return &Auth{secret: []byte(secret), store: store}
+}
+
+// GenerateToken generates a new JWT access token for a session
+func (a *Auth) GenerateToken(userID int64, username, role string, sessionID int64) (string, error) {
 	// Create the claims
 	claims := JWTClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(100 * 24 * time.Hour)), // Token expires in 1000 days
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -41,11 +66,43 @@ func GenerateToken(userID int64, username string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Generate encoded token
-	return token.SignedString([]byte(jwtSecret))
+	return token.SignedString(a.secret)
+}
+
+// ChallengeTokenTTL is how long a user has to enter their two-factor code after the password
+const ChallengeTokenTTL = 5 * time.Minute
+
+// challengeAudience marks tokens that only prove the password step of a two-factor login
+const challengeAudience = "2fa"
+
+// GenerateChallengeToken generates a token proving that a user passed the password step of login.
+// It is exchanged for a session together with a two-factor code and is not accepted by AuthMiddleware.
+func (a *Auth) GenerateChallengeToken(userID int64) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatInt(userID, 10),
+		Audience:  jwt.ClaimStrings{challengeAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ChallengeTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.secret)
+}
+
+// ParseChallengeToken returns the user ID of a valid challenge token
+func (a *Auth) ParseChallengeToken(tokenString string) (int64, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithAudience(challengeAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(claims.Subject, 10, 64)
 }
 
 // AuthMiddleware is a middleware to check if the user is authenticated
-func AuthMiddleware() gin.HandlerFunc {
+func (a *Auth) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -67,16 +124,22 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// Get the token
 		tokenString := parts[1]
-		log.Printf("AuthMiddleware: Received token: %s... for %s %s", tokenString[:10]+"...", c.Request.Method, c.Request.URL.Path)
+		// Only log the start of the token, which may be shorter than that
+		tokenPrefix := tokenString
+		if len(tokenPrefix) > 10 {
+			tokenPrefix = tokenPrefix[:10]
+		}
+		log.Printf("AuthMiddleware: Received token: %s... for %s %s", tokenPrefix+"...", c.Request.Method, c.Request.URL.Path)
+
+		// Personal access tokens are looked up in the database instead of parsed
+		if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+			a.authenticateAPIToken(c, tokenString)
+			return
+		}
 
 		// Parse the token
 		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// Get JWT secret from environment variable or use default
-			jwtSecret := os.Getenv("JWT_SECRET")
-			if jwtSecret == "" {
-				jwtSecret = "your-secret-key" // Default secret key (change in production)
-			}
-			return []byte(jwtSecret), nil
+			return a.secret, nil
 		})
 
 		if err != nil {
@@ -103,12 +166,146 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Set the user ID and username in the context
+		// Tokens of revoked or expired sessions are no longer accepted
+		session, err := a.store.GetSessionByID(claims.SessionID)
+		if err != nil || session.UserID != claims.UserID || !session.Active() {
+			log.Printf("AuthMiddleware: Session %d is missing, revoked or expired for %s %s", claims.SessionID, c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, please log in again"})
+			c.Abort()
+			return
+		}
+
+		// Tokens of deleted or disabled users are no longer accepted
+		user, err := a.store.GetUserByID(claims.UserID)
+		if err != nil || user.Disabled {
+			log.Printf("AuthMiddleware: User %d is missing or disabled for %s %s", claims.UserID, c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User is disabled or no longer exists"})
+			c.Abort()
+			return
+		}
+
+		// A role change invalidates tokens issued with the previous role
+		if user.Role != claims.Role {
+			log.Printf("AuthMiddleware: Role of user %d changed from %s to %s for %s %s", claims.UserID, claims.Role, user.Role, c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role has changed, please log in again"})
+			c.Abort()
+			return
+		}
+
+		// Set the user ID, username and role in the context
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("sessionID", claims.SessionID)
 		log.Printf("AuthMiddleware: Authentication successful for user %s (ID: %d) for %s %s", 
 			claims.Username, claims.UserID, c.Request.Method, c.Request.URL.Path)
 
 		c.Next()
 	}
 }
+
+// authenticateAPIToken authenticates a request made with a personal access token.
+// The request gets the role of the token's scopes, capped by the role of its user.
+func (a *Auth) authenticateAPIToken(c *gin.Context, tokenString string) {
+	apiToken, err := a.store.GetAPITokenByToken(tokenString)
+	if err != nil || apiToken.Expired() {
+		log.Printf("AuthMiddleware: API token is unknown or expired for %s %s", c.Request.Method, c.Request.URL.Path)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+		c.Abort()
+		return
+	}
+
+	// Tokens of disabled users are no longer accepted
+	user, err := a.store.GetUserByID(apiToken.UserID)
+	if err != nil || user.Disabled {
+		log.Printf("AuthMiddleware: User %d is missing or disabled for %s %s", apiToken.UserID, c.Request.Method, c.Request.URL.Path)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is disabled or no longer exists"})
+		c.Abort()
+		return
+	}
+
+	if err := a.store.TouchAPIToken(apiToken.ID); err != nil {
+		log.Printf("AuthMiddleware: Failed to update last use of API token %d: %v", apiToken.ID, err)
+	}
+
+	// Set the user ID, username and role in the context
+	c.Set("userID", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", apiToken.Role(user.Role))
+	c.Set("apiTokenID", apiToken.ID)
+	log.Printf("AuthMiddleware: Authentication with API token %d successful for user %s (ID: %d) for %s %s",
+		apiToken.ID, user.Username, user.ID, c.Request.Method, c.Request.URL.Path)
+
+	c.Next()
+}
+
+// RequireSession is a middleware that rejects requests made with a personal access token,
+// for actions that need an interactive login. It must run after AuthMiddleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt64("apiTokenID") != 0 {
+			log.Printf("RequireSession: API token used by %s for %s %s",
+				c.GetString("username"), c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is not available with an API token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAdminTwoFactor is a middleware that blocks admins without two-factor auth when
+// the require_admin_2fa setting is on. Single sign-on users are left to their identity provider.
+// It must run after AuthMiddleware.
+func (a *Auth) RequireAdminTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		required, err := a.store.GetBoolSetting(models.SettingRequireAdminTwoFactor)
+		if err != nil {
+			log.Printf("RequireAdminTwoFactor: Failed to read setting: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor requirement"})
+			c.Abort()
+			return
+		}
+		if !required || c.GetString("role") != models.RoleAdmin {
+			c.Next()
+			return
+		}
+
+		user, err := a.store.GetUserByID(c.GetInt64("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+			c.Abort()
+			return
+		}
+		if !user.TwoFactor && user.AuthProvider != models.AuthProviderOIDC {
+			log.Printf("RequireAdminTwoFactor: Admin %s has no two-factor auth for %s %s",
+				user.Username, c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                     "Admins must enable two-factor authentication",
+				"two_factor_setup_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRole is a middleware that only lets users with at least the given role through.
+// It must run after AuthMiddleware.
+func RequireRole(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if !models.HasRole(role, required) {
+			log.Printf("RequireRole: User %s with role %q needs role %q for %s %s",
+				c.GetString("username"), role, required, c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,357 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yongliucc/link-deck/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testSecret = "test-secret"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// Hashing at the production cost would make the tests slow
+	models.BcryptCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+// newTestStore returns a store in a temporary SQLite file
+func newTestStore(t *testing.T) models.Store {
+	t.Helper()
+
+	store, err := models.NewSQLiteStore(filepath.Join(t.TempDir(), "linkdeck.db"))
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.Migrate(-1, false); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return store
+}
+
+// newTestRouter returns a router with one route behind AuthMiddleware echoing the authenticated user
+func newTestRouter(auth *Auth) *gin.Engine {
+	router := gin.New()
+	router.GET("/protected", auth.AuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"username": c.GetString("username"), "role": c.GetString("role")})
+	})
+
+	return router
+}
+
+// signClaims signs claims the way GenerateToken does, with any secret
+func signClaims(t *testing.T, claims JWTClaims, secret string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	return token
+}
+
+func TestGenerateTokenClaims(t *testing.T) {
+	auth := NewAuth(testSecret, newTestStore(t))
+
+	before := time.Now().Add(-time.Second)
+	tokenString, err := auth.GenerateToken(7, "alice", models.RoleEditor, 3)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	claims := &JWTClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testSecret), nil
+	})
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if claims.UserID != 7 || claims.Username != "alice" || claims.Role != models.RoleEditor || claims.SessionID != 3 {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// Access tokens live for AccessTokenTTL
+	expiresIn := claims.ExpiresAt.Sub(before)
+	if expiresIn < AccessTokenTTL || expiresIn > AccessTokenTTL+2*time.Second {
+		t.Errorf("token expires in %v, want %v", expiresIn, AccessTokenTTL)
+	}
+}
+
+func TestNewAuthDefaultSecret(t *testing.T) {
+	auth := NewAuth("", newTestStore(t))
+
+	tokenString, err := auth.GenerateToken(1, "admin", models.RoleAdmin, 1)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	_, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(DefaultJWTSecret), nil
+	})
+	if err != nil {
+		t.Errorf("token is not signed with the default secret: %v", err)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	store := newTestStore(t)
+	auth := NewAuth(testSecret, store)
+	router := newTestRouter(auth)
+
+	userID, err := store.CreateUser("alice", "password", models.RoleEditor)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session, _, err := store.CreateSession(userID, "test", "127.0.0.1", RefreshTokenTTL)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	revoked, _, err := store.CreateSession(userID, "test", "127.0.0.1", RefreshTokenTTL)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if err := store.RevokeSession(revoked.ID); err != nil {
+		t.Fatalf("revoke session: %v", err)
+	}
+	_, apiToken, err := store.CreateAPIToken(userID, "script", []string{models.ScopeRead}, nil)
+	if err != nil {
+		t.Fatalf("create API token: %v", err)
+	}
+
+	valid, err := auth.GenerateToken(userID, "alice", models.RoleEditor, session.ID)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	// claims returns valid claims for alice's session changed by fn
+	claims := func(fn func(*JWTClaims)) JWTClaims {
+		c := JWTClaims{
+			UserID:    userID,
+			Username:  "alice",
+			Role:      models.RoleEditor,
+			SessionID: session.ID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				NotBefore: jwt.NewNumericDate(time.Now()),
+			},
+		}
+		fn(&c)
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+		wantRole string
+	}{
+		{"valid token", "Bearer " + valid, http.StatusOK, models.RoleEditor},
+		{"API token", "Bearer " + apiToken, http.StatusOK, models.RoleViewer},
+		{"missing header", "", http.StatusUnauthorized, ""},
+		{"wrong scheme", "Basic " + valid, http.StatusUnauthorized, ""},
+		{"missing token", "Bearer", http.StatusUnauthorized, ""},
+		{"short token", "Bearer abc", http.StatusUnauthorized, ""},
+		{"malformed token", "Bearer not.a.jsonwebtoken", http.StatusUnauthorized, ""},
+		{"unknown API token", "Bearer " + models.APITokenPrefix + "unknown", http.StatusUnauthorized, ""},
+		{
+			"expired token",
+			"Bearer " + signClaims(t, claims(func(c *JWTClaims) {
+				c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * AccessTokenTTL))
+				c.NotBefore = c.IssuedAt
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			}), testSecret),
+			http.StatusUnauthorized, "",
+		},
+		{
+			"token not valid yet",
+			"Bearer " + signClaims(t, claims(func(c *JWTClaims) {
+				c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+			}), testSecret),
+			http.StatusUnauthorized, "",
+		},
+		{
+			"signed with another secret",
+			"Bearer " + signClaims(t, claims(func(*JWTClaims) {}), "another-secret"),
+			http.StatusUnauthorized, "",
+		},
+		{"tampered signature", "Bearer " + valid[:len(valid)-4] + "AAAA", http.StatusUnauthorized, ""},
+		{
+			"unsigned token",
+			"Bearer " + func() string {
+				token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims(func(*JWTClaims) {})).
+					SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Fatalf("sign token: %v", err)
+				}
+				return token
+			}(),
+			http.StatusUnauthorized, "",
+		},
+		{
+			"revoked session",
+			"Bearer " + signClaims(t, claims(func(c *JWTClaims) { c.SessionID = revoked.ID }), testSecret),
+			http.StatusUnauthorized, "",
+		},
+		{
+			"unknown session",
+			"Bearer " + signClaims(t, claims(func(c *JWTClaims) { c.SessionID = 999 }), testSecret),
+			http.StatusUnauthorized, "",
+		},
+		{
+			"session of another user",
+			"Bearer " + signClaims(t, claims(func(c *JWTClaims) { c.UserID = userID + 1 }), testSecret),
+			http.StatusUnauthorized, "",
+		},
+		{
+			"changed role",
+			"Bearer " + signClaims(t, claims(func(c *JWTClaims) { c.Role = models.RoleAdmin }), testSecret),
+			http.StatusUnauthorized, "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantRole != "" && !strings.Contains(rec.Body.String(), `"role":"`+tt.wantRole+`"`) {
+				t.Errorf("response %s does not have role %s", rec.Body.String(), tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareDisabledUser(t *testing.T) {
+	store := newTestStore(t)
+	auth := NewAuth(testSecret, store)
+	router := newTestRouter(auth)
+
+	userID, err := store.CreateUser("alice", "password", models.RoleEditor)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	session, _, err := store.CreateSession(userID, "test", "127.0.0.1", RefreshTokenTTL)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	token, err := auth.GenerateToken(userID, "alice", models.RoleEditor, session.ID)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	// A token issued before the account was disabled stops working
+	if err := store.SetUserDisabled(userID, true); err != nil {
+		t.Fatalf("disable user: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("token of a disabled user returned %d, want 401", rec.Code)
+	}
+}
+
+func TestChallengeToken(t *testing.T) {
+	store := newTestStore(t)
+	auth := NewAuth(testSecret, store)
+
+	challenge, err := auth.GenerateChallengeToken(42)
+	if err != nil {
+		t.Fatalf("generate challenge token: %v", err)
+	}
+	if userID, err := auth.ParseChallengeToken(challenge); err != nil || userID != 42 {
+		t.Errorf("parse challenge token = %d, %v, want 42", userID, err)
+	}
+	if _, err := NewAuth("another-secret", store).ParseChallengeToken(challenge); err == nil {
+		t.Error("challenge token signed with another secret was accepted")
+	}
+
+	// Challenge tokens only prove the password step and are no access tokens
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+challenge)
+	rec := httptest.NewRecorder()
+	newTestRouter(auth).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("challenge token as access token returned %d, want 401", rec.Code)
+	}
+
+	// Access tokens are not challenge tokens either
+	access, err := auth.GenerateToken(42, "alice", models.RoleEditor, 1)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := auth.ParseChallengeToken(access); err == nil {
+		t.Error("access token was accepted as challenge token")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		wantCode int
+	}{
+		{models.RoleAdmin, models.RoleAdmin, http.StatusOK},
+		{models.RoleAdmin, models.RoleEditor, http.StatusOK},
+		{models.RoleEditor, models.RoleEditor, http.StatusOK},
+		{models.RoleEditor, models.RoleAdmin, http.StatusForbidden},
+		{models.RoleViewer, models.RoleEditor, http.StatusForbidden},
+		{"", models.RoleViewer, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+" needs "+tt.required, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				c.Set("role", tt.role)
+			}, RequireRole(tt.required), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("got %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	store := newTestStore(t)
+	auth := NewAuth("secret", store)
+
+	signature := auth.Sign("icon:1")
+	if !auth.VerifySignature("icon:1", signature) {
+		t.Error("signature is not valid for the signed value")
+	}
+	if auth.VerifySignature("icon:2", signature) {
+		t.Error("signature is valid for another value")
+	}
+	if NewAuth("other-secret", store).VerifySignature("icon:1", signature) {
+		t.Error("signature is valid with another secret")
+	}
+	if auth.VerifySignature("icon:1", "") {
+		t.Error("empty signature is valid")
+	}
+}
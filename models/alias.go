@@ -0,0 +1,265 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxAliasLength is the longest alias a link can have
+const MaxAliasLength = 100
+
+// Errors returned for aliases that cannot be set
+var (
+	ErrInvalidAlias = errors.New("alias must be up to 100 characters of path segments made of a-z, 0-9, '-', '_' and '.', " +
+		"starting with a fixed segment, where segments like {n} are parameters")
+	ErrAliasExists = errors.New("alias already exists")
+)
+
+var (
+	aliasSegmentPattern   = regexp.MustCompile(`^[a-z0-9._-]+$`)
+	aliasParameterPattern = regexp.MustCompile(`^\{([a-z0-9_]+)\}$`)
+)
+
+// NormalizeAlias trims and lowercases an alias and checks it, dropping a leading go/ and slashes.
+// Aliases are paths like wiki or pr/{n}, where {n} takes any one segment for the link's URL template.
+func NormalizeAlias(alias string) (string, error) {
+	alias = strings.Trim(strings.ToLower(strings.TrimSpace(alias)), "/")
+	alias = strings.TrimPrefix(alias, "go/")
+	if alias == "" {
+		return "", nil
+	}
+	if len(alias) > MaxAliasLength {
+		return "", ErrInvalidAlias
+	}
+
+	parameters := make(map[string]bool)
+	for i, segment := range strings.Split(alias, "/") {
+		if match := aliasParameterPattern.FindStringSubmatch(segment); match != nil && i > 0 && !parameters[match[1]] {
+			parameters[match[1]] = true
+			continue
+		}
+		// Segments of dots only would look like relative paths
+		if !aliasSegmentPattern.MatchString(segment) || strings.Trim(segment, ".") == "" {
+			return "", ErrInvalidAlias
+		}
+	}
+
+	return alias, nil
+}
+
+// aliasShape returns the alias with the names of its parameters left out. Aliases
+// of the same shape, like pr/{n} and pr/{id}, would match the same paths.
+func aliasShape(alias string) string {
+	segments := strings.Split(alias, "/")
+	for i, segment := range segments {
+		if aliasParameterPattern.MatchString(segment) {
+			segments[i] = "{}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// MatchAlias reports whether path, e.g. pr/123, is matched by alias, e.g. pr/{n},
+// and returns the values of its parameters
+func MatchAlias(alias, path string) (map[string]string, bool) {
+	aliasSegments := strings.Split(alias, "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(aliasSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	parameters := make(map[string]string)
+	for i, segment := range aliasSegments {
+		if match := aliasParameterPattern.FindStringSubmatch(segment); match != nil {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			parameters[match[1]] = pathSegments[i]
+		} else if segment != strings.ToLower(pathSegments[i]) {
+			return nil, false
+		}
+	}
+
+	return parameters, true
+}
+
+// ExpandAliasURL replaces the parameters in a link's URL template, e.g. {n} in
+// https://github.com/org/repo/pull/{n}, with their escaped values
+func ExpandAliasURL(template string, parameters map[string]string) string {
+	pairs := make([]string, 0, 2*len(parameters))
+	for name, value := range parameters {
+		pairs = append(pairs, "{"+name+"}", url.PathEscape(value))
+	}
+
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// aliasSpecificity ranks the aliases matching a path, fixed segments beat parameters
+func aliasSpecificity(alias string) int {
+	fixed := 0
+	for _, segment := range strings.Split(alias, "/") {
+		if !aliasParameterPattern.MatchString(segment) {
+			fixed++
+		}
+	}
+
+	return fixed
+}
+
+// ResolveAlias returns the link among links whose alias matches path best, with the values of the parameters.
+// It returns false if no alias matches.
+func ResolveAlias(links []Link, path string) (Link, map[string]string, bool) {
+	var (
+		best           Link
+		bestParameters map[string]string
+		found          bool
+	)
+	for _, link := range links {
+		if link.Alias == "" {
+			continue
+		}
+		parameters, ok := MatchAlias(link.Alias, path)
+		if ok && (!found || aliasSpecificity(link.Alias) > aliasSpecificity(best.Alias)) {
+			best, bestParameters, found = link, parameters, true
+		}
+	}
+
+	return best, bestParameters, found
+}
+
+// SuggestAliases returns up to limit of the aliases of links closest to path, for paths
+// that match none. Aliases starting with the path come first, then those a few edits away.
+func SuggestAliases(links []Link, path string, limit int) []string {
+	path = strings.ToLower(strings.Trim(path, "/"))
+	maxDistance := max(2, len(path)/3)
+
+	type suggestion struct {
+		alias    string
+		distance int
+	}
+	var suggestions []suggestion
+	for _, link := range links {
+		if link.Alias == "" {
+			continue
+		}
+		distance := editDistance(path, link.Alias)
+		if strings.HasPrefix(link.Alias, path) || strings.HasPrefix(path, link.Alias+"/") {
+			distance = 0
+		}
+		if distance <= maxDistance {
+			suggestions = append(suggestions, suggestion{link.Alias, distance})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].alias < suggestions[j].alias
+	})
+
+	// Initialize as empty slice instead of nil
+	aliases := []string{}
+	for _, s := range suggestions {
+		if len(aliases) == limit {
+			break
+		}
+		aliases = append(aliases, s.alias)
+	}
+
+	return aliases
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// SetLinkAlias sets the alias of a link, empty to remove it. It returns ErrAliasExists if another link
+// has an alias of the same shape. The alias must be normalized with NormalizeAlias.
+func (s *sqlStore) SetLinkAlias(linkID int64, alias string) error {
+	return s.inTx(func(tx *sqlStore) error {
+		if alias != "" {
+			taken, err := tx.aliasTaken(linkID, alias)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrAliasExists
+			}
+		}
+
+		result, err := tx.exec(`
+			UPDATE links SET alias = NULLIF(?, ''), alias_shape = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, alias, aliasShape(alias), linkID)
+		if err != nil {
+			return err
+		}
+
+		return requireRowsAffected(result)
+	})
+}
+
+// aliasTaken reports whether a link other than linkID has an alias of the same shape as alias.
+// Aliases are unique across all links, whoever can read them.
+func (s *sqlStore) aliasTaken(linkID int64, alias string) (bool, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM links WHERE alias_shape = ? AND id <> ?", aliasShape(alias), linkID).Scan(&count)
+	return count > 0, err
+}
+
+// fillAliasShapes sets the shapes of aliases set before links had them
+func (s *sqlStore) fillAliasShapes() error {
+	rows, err := s.query("SELECT id, alias FROM links WHERE alias IS NOT NULL AND alias_shape IS NULL")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	shapes := make(map[int64]string)
+	for rows.Next() {
+		var (
+			id    int64
+			alias string
+		)
+		if err := rows.Scan(&id, &alias); err != nil {
+			return err
+		}
+		shapes[id] = aliasShape(alias)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return s.inTx(func(tx *sqlStore) error {
+		for id, shape := range shapes {
+			if _, err := tx.exec("UPDATE links SET alias_shape = ? WHERE id = ?", shape, id); err != nil {
+				return fmt.Errorf("failed to set the alias shape of link %d: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every personal access token, so they can be told apart from JWTs
+const APITokenPrefix = "ldk_"
+
+// API token scopes, each grants at most the permissions of a role
+const (
+	ScopeRead  = "read"  // Read the link deck, like a viewer
+	ScopeWrite = "write" // Change link groups and links, like an editor
+	ScopeAdmin = "admin" // Manage users, imports and exports, like an admin
+)
+
+// scopeRoles maps each scope to the role it grants
+var scopeRoles = map[string]string{
+	ScopeRead:  RoleViewer,
+	ScopeWrite: RoleEditor,
+	ScopeAdmin: RoleAdmin,
+}
+
+// IsValidScope reports whether scope is a known API token scope
+func IsValidScope(scope string) bool {
+	_, ok := scopeRoles[scope]
+	return ok
+}
+
+// ScopeRole returns the role granted by a scope
+func ScopeRole(scope string) string {
+	return scopeRoles[scope]
+}
+
+// APIToken represents a named personal access token of a user
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the token has an expiry that has passed
+func (t *APIToken) Expired() bool {
+	return t.ExpiresAt != nil && !time.Now().Before(*t.ExpiresAt)
+}
+
+// Role returns the role a request made with the token gets.
+// That is the highest role of its scopes, but never more than the role of its user.
+func (t *APIToken) Role(userRole string) string {
+	role := ""
+	for _, scope := range t.Scopes {
+		if scopeRole := ScopeRole(scope); role == "" || HasRole(scopeRole, role) {
+			role = scopeRole
+		}
+	}
+	if role == "" || HasRole(role, userRole) {
+		return userRole
+	}
+
+	return role
+}
+
+// apiTokenColumns lists the api_tokens columns read by scanAPIToken, in order
+const apiTokenColumns = "id, user_id, name, scopes, created_at, last_used_at, expires_at"
+
+// scanAPIToken scans a row selected with apiTokenColumns into an API token
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var (
+		token      APIToken
+		scopes     string
+		lastUsedAt sql.NullTime
+		expiresAt  sql.NullTime
+	)
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&scopes,
+		&token.CreatedAt,
+		&lastUsedAt,
+		&expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Split(scopes, ",")
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+
+	return &token, nil
+}
+
+// CreateAPIToken creates a personal access token for a user and returns it with the plain token,
+// which is only stored hashed and cannot be retrieved later
+func (s *sqlStore) CreateAPIToken(userID int64, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	plain := APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	var expires sql.NullTime
+	if expiresAt != nil {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+
+	id, err := s.insert(`
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, name, hashToken(plain), strings.Join(scopes, ","), time.Now().UTC(), expires)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := scanAPIToken(s.queryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = ?", id))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, plain, nil
+}
+
+// GetAPITokenByToken looks up a personal access token by its plain value
+func (s *sqlStore) GetAPITokenByToken(plain string) (*APIToken, error) {
+	return scanAPIToken(s.queryRow(
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = ?", hashToken(plain),
+	))
+}
+
+// GetAPITokensByUserID retrieves the personal access tokens of a user
+func (s *sqlStore) GetAPITokensByUserID(userID int64) ([]APIToken, error) {
+	rows, err := s.query(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	tokens := []APIToken{}
+
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// TouchAPIToken records that a personal access token was just used
+func (s *sqlStore) TouchAPIToken(id int64) error {
+	_, err := s.exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
+
+// DeleteAPIToken deletes a personal access token of a user
+func (s *sqlStore) DeleteAPIToken(id, userID int64) error {
+	result, err := s.exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// RecordClick records that a user opened a link through its redirect URL. userID is 0
+// for visitors of public links, referrer may be empty.
+func (s *sqlStore) RecordClick(linkID, userID int64, referrer string) error {
+	_, err := s.exec(`
+		INSERT INTO link_clicks (link_id, user_id, referrer, clicked_at)
+		VALUES (?, NULLIF(?, 0), ?, ?)
+	`, linkID, userID, referrer, time.Now().UTC())
+	return err
+}
+
+// CountLinkClicks counts the clicks on each link since a time, leaving out links without any
+func (s *sqlStore) CountLinkClicks(since time.Time) (map[int64]int64, error) {
+	rows, err := s.query(`
+		SELECT link_id, COUNT(*)
+		FROM link_clicks
+		WHERE clicked_at >= ?
+		GROUP BY link_id
+	`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int64)
+	for rows.Next() {
+		var linkID, count int64
+		if err := rows.Scan(&linkID, &count); err != nil {
+			return nil, err
+		}
+		counts[linkID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetLinkClickTimes retrieves when a link was clicked since a time, oldest first
+func (s *sqlStore) GetLinkClickTimes(linkID int64, since time.Time) ([]time.Time, error) {
+	rows, err := s.query(`
+		SELECT clicked_at
+		FROM link_clicks
+		WHERE link_id = ? AND clicked_at >= ?
+		ORDER BY clicked_at ASC
+	`, linkID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	times := []time.Time{}
+
+	for rows.Next() {
+		var clickedAt time.Time
+		if err := rows.Scan(&clickedAt); err != nil {
+			return nil, err
+		}
+		times = append(times, clickedAt)
+	}
+
+	return times, rows.Err()
+}
@@ -2,128 +2,75 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
-	"os"
-	"path/filepath"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
-
-// InitDB initializes the database connection
-func InitDB() {
-	// Get database path from environment variable or use default
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		// Create data directory if it doesn't exist
-		dataDir := "./data"
-		if _, err := os.Stat(dataDir); os.IsNotExist(err) {
-			if err := os.MkdirAll(dataDir, 0755); err != nil {
-				log.Fatalf("Failed to create data directory: %v", err)
-			}
-		}
-		dbPath = filepath.Join(dataDir, "linkdeck.db")
-	} else {
-		// Ensure directory exists for custom DB path
-		dbDir := filepath.Dir(dbPath)
-		if _, err := os.Stat(dbDir); os.IsNotExist(err) {
-			if err := os.MkdirAll(dbDir, 0755); err != nil {
-				log.Fatalf("Failed to create database directory: %v", err)
-			}
-		}
-	}
+// DefaultSQLitePath is where the SQLite database is kept unless configured otherwise
+const DefaultSQLitePath = "./data/linkdeck.db"
 
-	log.Printf("Using database at: %s", dbPath)
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+// SeedAdmin creates the default admin user on first start
+func SeedAdmin(store Store) error {
+	// Check if admin user exists, create if not
+	_, err := store.GetUserByUsername("admin")
+	if err != sql.ErrNoRows {
+		return err
 	}
 
-	// Test the connection
-	if err = db.Ping(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	// Create default admin user with password 'admin'
+	// In production, you should use a more secure password
+	if _, err := store.CreateUser("admin", "admin", RoleAdmin); err != nil {
+		return err
 	}
-
-	DB = db
-	log.Println("Database connection established")
-
-	// Create tables if they don't exist
-	createTables()
+	log.Println("Default admin user created")
+	return nil
 }
 
-// createTables creates the necessary tables if they don't exist
-func createTables() {
-	// Create users table
-	_, err := DB.Exec(`
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT NOT NULL UNIQUE,
-		password TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`)
-	if err != nil {
-		log.Fatalf("Failed to create users table: %v", err)
-	}
-
-	// Create link_groups table
-	_, err = DB.Exec(`
-	CREATE TABLE IF NOT EXISTS link_groups (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		sort_order INTEGER NOT NULL DEFAULT 0,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`)
+// addColumnIfMissing adds a column to an existing table if it is not there yet,
+// reporting whether the column was added
+func (s *sqlStore) addColumnIfMissing(table, column, definition string) (bool, error) {
+	rows, err := s.query("PRAGMA table_info(" + table + ")")
 	if err != nil {
-		log.Fatalf("Failed to create link_groups table: %v", err)
+		return false, fmt.Errorf("failed to inspect %s table: %w", table, err)
 	}
+	defer rows.Close()
 
-	// Create links table
-	_, err = DB.Exec(`
-	CREATE TABLE IF NOT EXISTS links (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		group_id INTEGER NOT NULL,
-		name TEXT NOT NULL,
-		url TEXT NOT NULL,
-		icon TEXT,
-		sort_order INTEGER NOT NULL DEFAULT 0,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (group_id) REFERENCES link_groups(id) ON DELETE CASCADE
-	)`)
-	if err != nil {
-		log.Fatalf("Failed to create links table: %v", err)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("failed to inspect %s table: %w", table, err)
+		}
+		if name == column {
+			return false, nil
+		}
 	}
-
-	// Check if admin user exists, create if not
-	var count int
-	err = DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = 'admin'").Scan(&count)
-	if err != nil {
-		log.Fatalf("Failed to check admin user: %v", err)
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to inspect %s table: %w", table, err)
 	}
+	rows.Close()
 
-	if count == 0 {
-		// Create default admin user with password 'admin'
-		// In production, you should use a more secure password
-		hashedPassword, err := HashPassword("admin")
-		if err != nil {
-			log.Fatalf("Failed to hash password: %v", err)
-		}
-
-		_, err = DB.Exec("INSERT INTO users (username, password) VALUES (?, ?)", "admin", hashedPassword)
-		if err != nil {
-			log.Fatalf("Failed to create admin user: %v", err)
-		}
-		log.Println("Default admin user created")
+	if _, err := s.exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		return false, fmt.Errorf("failed to add %s.%s column: %w", table, column, err)
 	}
+	log.Printf("Added %s column to %s table", column, table)
+	return true, nil
 }
 
-// CloseDB closes the database connection
-func CloseDB() {
-	if DB != nil {
-		DB.Close()
-		log.Println("Database connection closed")
+// requireRowsAffected returns sql.ErrNoRows if a statement did not touch any row
+func requireRowsAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
 	}
+	return nil
 }
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Link environments, a link may also have none
+const (
+	EnvironmentProd    = "prod"
+	EnvironmentStaging = "staging"
+	EnvironmentDev     = "dev"
+)
+
+// Limits of the details of a link
+const (
+	MaxDescriptionLength   = 2000
+	MaxOwnerLength         = 100
+	MaxMetadataEntries     = 20
+	MaxMetadataKeyLength   = 50
+	MaxMetadataValueLength = 500
+)
+
+// Errors returned for link details that break the limits
+var (
+	ErrDescriptionTooLong = errors.New("description must be at most 2000 characters")
+	ErrOwnerTooLong       = errors.New("owner must be at most 100 characters")
+	ErrInvalidEnvironment = errors.New("environment must be prod, staging or dev")
+	ErrInvalidMetadata    = errors.New("metadata can have at most 20 entries with non-empty keys of up to 50 characters and values of up to 500 characters")
+)
+
+// IsValidEnvironment reports whether environment is a known link environment or empty
+func IsValidEnvironment(environment string) bool {
+	switch environment {
+	case "", EnvironmentProd, EnvironmentStaging, EnvironmentDev:
+		return true
+	}
+
+	return false
+}
+
+// LinkDetails describe what a link is for beyond its name and URL
+type LinkDetails struct {
+	Description string            `json:"description"`
+	Owner       string            `json:"owner"`
+	Environment string            `json:"environment"`
+	Metadata    map[string]string `json:"metadata"`
+	Icon        string            `json:"icon"`
+}
+
+// Details returns the details of the link
+func (l Link) Details() LinkDetails {
+	return LinkDetails{
+		Description: l.Description,
+		Owner:       l.Owner,
+		Environment: l.Environment,
+		Metadata:    l.Metadata,
+		Icon:        l.Icon,
+	}
+}
+
+// NormalizeLinkDetails trims the details, lowercases the environment and checks them against the limits.
+// The icon must be empty or an icon URL.
+func NormalizeLinkDetails(details LinkDetails) (LinkDetails, error) {
+	normalized := LinkDetails{
+		Description: strings.TrimSpace(details.Description),
+		Owner:       strings.TrimSpace(details.Owner),
+		Environment: strings.ToLower(strings.TrimSpace(details.Environment)),
+		Metadata:    make(map[string]string, len(details.Metadata)),
+		Icon:        strings.TrimSpace(details.Icon),
+	}
+	if len(normalized.Description) > MaxDescriptionLength {
+		return LinkDetails{}, ErrDescriptionTooLong
+	}
+	if len(normalized.Owner) > MaxOwnerLength {
+		return LinkDetails{}, ErrOwnerTooLong
+	}
+	if !IsValidEnvironment(normalized.Environment) {
+		return LinkDetails{}, ErrInvalidEnvironment
+	}
+	if !IsValidIconURL(normalized.Icon) {
+		return LinkDetails{}, ErrInvalidIcon
+	}
+
+	if len(details.Metadata) > MaxMetadataEntries {
+		return LinkDetails{}, ErrInvalidMetadata
+	}
+	for key, value := range details.Metadata {
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "" || len(key) > MaxMetadataKeyLength || len(value) > MaxMetadataValueLength {
+			return LinkDetails{}, ErrInvalidMetadata
+		}
+		normalized.Metadata[key] = value
+	}
+
+	return normalized, nil
+}
+
+// searchText returns the owner, environment and metadata of the link as one text for searching
+func (d LinkDetails) searchText() string {
+	keys := make([]string, 0, len(d.Metadata))
+	for key := range d.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{d.Owner, d.Environment}
+	for _, key := range keys {
+		parts = append(parts, key, d.Metadata[key])
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// SetLinkDetails replaces the details of a link. Changing the icon URL drops the stored icon,
+// uploaded or fetched, so the new one is used. The details must be normalized with NormalizeLinkDetails.
+func (s *sqlStore) SetLinkDetails(linkID int64, details LinkDetails) error {
+	return s.inTx(func(tx *sqlStore) error {
+		_, err := tx.exec(`
+			DELETE FROM link_icons
+			WHERE link_id = ? AND EXISTS (SELECT 1 FROM links WHERE id = ? AND COALESCE(icon, '') <> ?)
+		`, linkID, linkID, details.Icon)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.exec(`
+			UPDATE links
+			SET description = ?, owner = ?, environment = ?, icon = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, details.Description, details.Owner, details.Environment, details.Icon, linkID)
+		if err != nil {
+			return err
+		}
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+
+		if _, err := tx.exec("DELETE FROM link_metadata WHERE link_id = ?", linkID); err != nil {
+			return err
+		}
+		for key, value := range details.Metadata {
+			_, err := tx.exec("INSERT INTO link_metadata (link_id, key, value) VALUES (?, ?, ?)", linkID, key, value)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.indexLink(linkID)
+	})
+}
+
+// loadLinkMetadata fills in the metadata of links
+func (s *sqlStore) loadLinkMetadata(links []Link) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+	}
+	rows, err := s.query(`
+		SELECT link_id, key, value
+		FROM link_metadata
+		WHERE link_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+	`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	metadataByLink := make(map[int64]map[string]string)
+	for rows.Next() {
+		var (
+			linkID     int64
+			key, value string
+		)
+		if err := rows.Scan(&linkID, &key, &value); err != nil {
+			return err
+		}
+		if metadataByLink[linkID] == nil {
+			metadataByLink[linkID] = make(map[string]string)
+		}
+		metadataByLink[linkID][key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Initialize as empty map instead of nil
+	for i := range links {
+		links[i].Metadata = metadataByLink[links[i].ID]
+		if links[i].Metadata == nil {
+			links[i].Metadata = map[string]string{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// LinkHealth is the result of the last health check of a link
+type LinkHealth struct {
+	// StatusCode is the HTTP status the link responded with, 0 if the request failed
+	StatusCode int       `json:"status_code"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Healthy reports whether the link responded with a success or redirect status
+func (h LinkHealth) Healthy() bool {
+	return h.StatusCode >= 200 && h.StatusCode < 400
+}
+
+// LinkURL is the URL of a link
+type LinkURL struct {
+	ID  int64
+	URL string
+}
+
+// GetLinkURLs retrieves the URLs of all links, for checking their health
+func (s *sqlStore) GetLinkURLs() ([]LinkURL, error) {
+	rows, err := s.query("SELECT id, url FROM links ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	urls := []LinkURL{}
+
+	for rows.Next() {
+		var url LinkURL
+		if err := rows.Scan(&url.ID, &url.URL); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+// SaveLinkHealth records the result of checking a link, replacing the previous one.
+// The check time is the time it is saved. Links deleted since they were checked are skipped.
+func (s *sqlStore) SaveLinkHealth(linkID int64, health LinkHealth) error {
+	// The WHERE also keeps SQLite from reading ON CONFLICT as part of the SELECT
+	_, err := s.exec(`
+		INSERT INTO link_health (link_id, status_code, latency_ms, error, checked_at)
+		SELECT id, ?, ?, ?, CURRENT_TIMESTAMP FROM links WHERE id = ?
+		ON CONFLICT (link_id) DO UPDATE SET status_code = excluded.status_code, latency_ms = excluded.latency_ms,
+			error = excluded.error, checked_at = excluded.checked_at
+	`, health.StatusCode, health.LatencyMS, health.Error, linkID)
+	return err
+}
+
+// loadLinkHealth fills in the last health check of links, leaving it nil for links not checked yet
+func (s *sqlStore) loadLinkHealth(links []Link) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+	}
+	rows, err := s.query(`
+		SELECT link_id, status_code, latency_ms, error, checked_at
+		FROM link_health
+		WHERE link_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+	`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	healthByLink := make(map[int64]*LinkHealth)
+	for rows.Next() {
+		var (
+			linkID int64
+			health LinkHealth
+		)
+		if err := rows.Scan(&linkID, &health.StatusCode, &health.LatencyMS, &health.Error, &health.CheckedAt); err != nil {
+			return err
+		}
+		healthByLink[linkID] = &health
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range links {
+		links[i].Health = healthByLink[links[i].ID]
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import "errors"
+
+// ErrGroupCycle is returned when a group would be moved below itself or one of its subgroups
+var ErrGroupCycle = errors.New("a group cannot be moved into itself or its subgroups")
+
+// subtreeQuery selects the IDs of a group and of all groups nested below it. It takes the group ID.
+const subtreeQuery = `
+	WITH RECURSIVE subtree (id) AS (
+		SELECT id FROM link_groups WHERE id = ?
+		UNION ALL
+		SELECT g.id FROM link_groups g JOIN subtree t ON g.parent_id = t.id
+	)
+	SELECT id FROM subtree
+`
+
+// buildLinkGroupTree nests groups below their parents, keeping their order. Groups whose parent
+// is not among them, e.g. a subgroup shared without its parent, are returned at the top level.
+func buildLinkGroupTree(groups []LinkGroup) []LinkGroup {
+	present := make(map[int64]bool, len(groups))
+	for _, group := range groups {
+		present[group.ID] = true
+	}
+
+	var roots []int
+	children := make(map[int64][]int)
+	for i, group := range groups {
+		if group.ParentID != nil && present[*group.ParentID] {
+			children[*group.ParentID] = append(children[*group.ParentID], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	var build func(i int) LinkGroup
+	build = func(i int) LinkGroup {
+		group := groups[i]
+		for _, child := range children[group.ID] {
+			group.Subgroups = append(group.Subgroups, build(child))
+		}
+		return group
+	}
+
+	// Initialize as empty slice instead of nil
+	tree := []LinkGroup{}
+	for _, i := range roots {
+		tree = append(tree, build(i))
+	}
+
+	return tree
+}
+
+// FlattenLinkGroups lists the groups of a tree with each parent before its subgroups,
+// leaving out the subgroups of the listed groups
+func FlattenLinkGroups(groups []LinkGroup) []LinkGroup {
+	flat := []LinkGroup{}
+	for _, group := range groups {
+		subgroups := group.Subgroups
+		group.Subgroups = nil
+		flat = append(flat, group)
+		flat = append(flat, FlattenLinkGroups(subgroups)...)
+	}
+
+	return flat
+}
+
+// MoveLinkGroup moves a link group with all its subgroups below another group, or to the top level
+// if parentID is 0. Callers check that the parent belongs to the owner of the group.
+func (s *sqlStore) MoveLinkGroup(id, parentID int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		if parentID != 0 {
+			var inSubtree bool
+			err := tx.queryRow("SELECT EXISTS (SELECT 1 FROM ("+subtreeQuery+") t WHERE t.id = ?)", id, parentID).Scan(&inSubtree)
+			if err != nil {
+				return err
+			}
+			if inSubtree {
+				return ErrGroupCycle
+			}
+		}
+
+		result, err := tx.exec(`
+			UPDATE link_groups
+			SET parent_id = NULLIF(?, 0), updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, parentID, id)
+		if err != nil {
+			return err
+		}
+
+		return requireRowsAffected(result)
+	})
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// MaxIconURLLength is the longest icon URL allowed
+const MaxIconURLLength = 2000
+
+// ErrInvalidIcon is returned for icon URLs that are not absolute HTTP or HTTPS URLs
+var ErrInvalidIcon = errors.New("icon must be an http or https URL of at most 2000 characters")
+
+// IsValidIconURL reports whether icon can be set as the icon URL of a link, which may be empty
+func IsValidIconURL(icon string) bool {
+	if icon == "" {
+		return true
+	}
+	if len(icon) > MaxIconURLLength {
+		return false
+	}
+
+	parsed, err := url.Parse(icon)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// LinkIcon is the icon image of a link, uploaded or fetched from its site
+type LinkIcon struct {
+	ContentType string
+	// Data is empty when fetching found no icon
+	Data []byte
+	// Uploaded icons take precedence over icon URLs and favicons, and are never fetched again
+	Uploaded  bool
+	UpdatedAt time.Time
+}
+
+// IconSum returns a short sum of icon data, which changes with the data
+func IconSum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// IconVersion identifies the icon served for a link: the sum of its uploaded icon, or else
+// of the URL the icon is fetched from. Unlike the update time of the link, it stays the same
+// when the link is only renamed, moved or reordered.
+func (l *Link) IconVersion() string {
+	switch {
+	case l.IconUploaded:
+		return l.IconSum
+	case l.Icon != "":
+		return IconSum([]byte(l.Icon))
+	default:
+		return IconSum([]byte(l.URL))
+	}
+}
+
+// GetLinkIcon retrieves the stored icon of a link
+func (s *sqlStore) GetLinkIcon(linkID int64) (LinkIcon, error) {
+	var icon LinkIcon
+	err := s.queryRow(`
+		SELECT content_type, data, uploaded, updated_at
+		FROM link_icons
+		WHERE link_id = ?
+	`, linkID).Scan(&icon.ContentType, &icon.Data, &icon.Uploaded, &icon.UpdatedAt)
+	if err != nil {
+		return LinkIcon{}, err
+	}
+
+	return icon, nil
+}
+
+// SaveLinkIcon stores the icon of a link, replacing the one it had. Uploads count as a change of the link.
+func (s *sqlStore) SaveLinkIcon(linkID int64, icon LinkIcon) error {
+	return s.inTx(func(tx *sqlStore) error {
+		_, err := tx.exec(`
+			INSERT INTO link_icons (link_id, content_type, data, data_sum, uploaded, updated_at)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT (link_id) DO UPDATE SET content_type = excluded.content_type, data = excluded.data,
+				data_sum = excluded.data_sum, uploaded = excluded.uploaded, updated_at = excluded.updated_at
+		`, linkID, icon.ContentType, icon.Data, IconSum(icon.Data), icon.Uploaded)
+		if err != nil {
+			return err
+		}
+		if !icon.Uploaded {
+			return nil
+		}
+
+		_, err = tx.exec("UPDATE links SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", linkID)
+		return err
+	})
+}
+
+// DeleteLinkIcon removes the stored icon of a link, so it is fetched again
+func (s *sqlStore) DeleteLinkIcon(linkID int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		result, err := tx.exec("DELETE FROM link_icons WHERE link_id = ?", linkID)
+		if err != nil {
+			return err
+		}
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+
+		_, err = tx.exec("UPDATE links SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", linkID)
+		return err
+	})
+}
+
+// fillIconSums sets the sums of icons stored before icons had them
+func (s *sqlStore) fillIconSums() error {
+	rows, err := s.query("SELECT link_id, data FROM link_icons WHERE data_sum IS NULL")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sums := make(map[int64]string)
+	for rows.Next() {
+		var (
+			linkID int64
+			data   []byte
+		)
+		if err := rows.Scan(&linkID, &data); err != nil {
+			return err
+		}
+		sums[linkID] = IconSum(data)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return s.inTx(func(tx *sqlStore) error {
+		for linkID, sum := range sums {
+			if _, err := tx.exec("UPDATE link_icons SET data_sum = ? WHERE link_id = ?", sum, linkID); err != nil {
+				return fmt.Errorf("failed to set the icon sum of link %d: %w", linkID, err)
+			}
+		}
+		return nil
+	})
+}
@@ -2,37 +2,124 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
 	"time"
 )
 
-// LinkGroup represents a group of links
+// Link group visibilities
+const (
+	VisibilityPrivate = "private" // Only the owner and users the group is shared with see it
+	VisibilityPublic  = "public"  // Also served without login when public mode is enabled
+)
+
+// IsValidVisibility reports whether visibility is a known link group visibility
+func IsValidVisibility(visibility string) bool {
+	return visibility == VisibilityPrivate || visibility == VisibilityPublic
+}
+
+// ErrInvalidLinkURL is returned for link URLs that are not absolute HTTP or HTTPS URLs
+var ErrInvalidLinkURL = errors.New("URL must be an absolute http or https URL")
+
+// urlParameterPattern matches the parameters of URL templates, like {n}, that go-links put values into
+var urlParameterPattern = regexp.MustCompile(`\{[a-z0-9_]+\}`)
+
+// IsValidLinkURL reports whether rawURL is an absolute HTTP or HTTPS URL, with any parameters
+// of go-links filled in. Other schemes, like javascript: and data:, would run in the app when opened.
+func IsValidLinkURL(rawURL string) bool {
+	parsed, err := url.Parse(urlParameterPattern.ReplaceAllString(rawURL, "x"))
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// LinkGroup represents a group of links, which may be nested below another group
 type LinkGroup struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	SortOrder int       `json:"sort_order"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Links     []Link    `json:"links,omitempty"`
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// ParentID is the group this one is nested below, nil at the top level
+	ParentID   *int64      `json:"parent_id"`
+	Owner      string      `json:"owner"`
+	Name       string      `json:"name"`
+	SortOrder  int         `json:"sort_order"`
+	Visibility string      `json:"visibility"`
+	Permission string      `json:"permission"`
+	Shared     bool        `json:"shared"`
+	CanEdit    bool        `json:"can_edit"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Links      []Link      `json:"links,omitempty"`
+	Subgroups  []LinkGroup `json:"subgroups,omitempty"`
 }
 
 // Link represents a link in the system
 type Link struct {
-	ID        int64     `json:"id"`
-	GroupID   int64     `json:"group_id"`
-	Name      string    `json:"name"`
-	URL       string    `json:"url"`
-	SortOrder int       `json:"sort_order"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
-// GetAllLinkGroups retrieves all link groups with their links
-func GetAllLinkGroups() ([]LinkGroup, error) {
-	rows, err := DB.Query(`
-		SELECT id, name, sort_order, created_at, updated_at 
-		FROM link_groups 
-		ORDER BY sort_order ASC
-	`)
+	ID          int64             `json:"id"`
+	GroupID     int64             `json:"group_id"`
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	SortOrder   int               `json:"sort_order"`
+	Description string            `json:"description"`
+	Owner       string            `json:"owner"`
+	Environment string            `json:"environment"`
+	Metadata    map[string]string `json:"metadata"`
+	// Alias opens the link at /go/<alias>, parameters like {n} in it are put into the URL
+	Alias string `json:"alias"`
+	// Icon is the URL of the icon set on the link, without one the favicon of its site is used
+	Icon         string `json:"icon"`
+	IconUploaded bool   `json:"icon_uploaded"`
+	// IconSum is the sum of the uploaded icon, see IconVersion
+	IconSum string `json:"-"`
+	// IconURL is where the icon is served, it is set by the handlers
+	IconURL string `json:"icon_url,omitempty"`
+	// ClickURL opens the link through the redirect endpoint, counting the click. It is set by the handlers.
+	ClickURL string   `json:"click_url,omitempty"`
+	Tags     []string `json:"tags"`
+	// Health is the last health check of the link, nil until it is checked
+	Health    *LinkHealth `json:"health"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// linkColumns are the columns of the links table l that scanLink reads
+const linkColumns = `l.id, l.group_id, l.name, l.url, l.sort_order, l.description, l.owner, l.environment,
+	COALESCE(l.alias, ''), COALESCE(l.icon, ''), EXISTS (SELECT 1 FROM link_icons i WHERE i.link_id = l.id AND i.uploaded),
+	COALESCE((SELECT i.data_sum FROM link_icons i WHERE i.link_id = l.id AND i.uploaded), ''),
+	l.created_at, l.updated_at`
+
+// scanLink reads the linkColumns of a row into link, followed by the extra columns
+func scanLink(scan func(dest ...any) error, link *Link, extra ...any) error {
+	dest := []any{
+		&link.ID,
+		&link.GroupID,
+		&link.Name,
+		&link.URL,
+		&link.SortOrder,
+		&link.Description,
+		&link.Owner,
+		&link.Environment,
+		&link.Alias,
+		&link.Icon,
+		&link.IconUploaded,
+		&link.IconSum,
+		&link.CreatedAt,
+		&link.UpdatedAt,
+	}
+
+	return scan(append(dest, extra...)...)
+}
+
+// GetAllLinkGroups retrieves all link groups owned by or shared with a user with their links,
+// as a tree of groups and their subgroups
+func (s *sqlStore) GetAllLinkGroups(userID int64) ([]LinkGroup, error) {
+	rows, err := s.query(`
+		SELECT g.id, COALESCE(g.user_id, 0), g.parent_id, COALESCE(u.username, ''), g.name, g.sort_order,
+			g.visibility, s.level, g.created_at, g.updated_at 
+		FROM link_groups g
+		LEFT JOIN users u ON u.id = g.user_id
+		LEFT JOIN (`+shareLevelsQuery+`) s ON s.group_id = g.id
+		WHERE g.user_id = ? OR s.level IS NOT NULL
+		ORDER BY g.sort_order ASC, g.id ASC
+	`, userID, userID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -42,11 +129,20 @@ func GetAllLinkGroups() ([]LinkGroup, error) {
 	groups := []LinkGroup{}
 
 	for rows.Next() {
-		var group LinkGroup
+		var (
+			group    LinkGroup
+			parentID sql.NullInt64
+			level    sql.NullInt64
+		)
 		err := rows.Scan(
 			&group.ID,
+			&group.UserID,
+			&parentID,
+			&group.Owner,
 			&group.Name,
 			&group.SortOrder,
+			&group.Visibility,
+			&level,
 			&group.CreatedAt,
 			&group.UpdatedAt,
 		)
@@ -54,26 +150,101 @@ func GetAllLinkGroups() ([]LinkGroup, error) {
 			return nil, err
 		}
 
-		// Get links for this group
-		links, err := GetLinksByGroupID(group.ID)
+		// Mark how the group is accessible to the user
+		group.Permission = permissionFor(group.UserID == userID, level)
+		group.Shared = group.Permission != PermissionOwner
+		group.CanEdit = CanEditGroup(group.Permission)
+		if parentID.Valid {
+			group.ParentID = &parentID.Int64
+		}
+
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Get links for each group once the groups are read, Postgres cannot run
+	// a query while another one is still returning rows on the same connection
+	for i := range groups {
+		links, err := s.GetLinksByGroupID(groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].Links = links
+	}
+
+	return buildLinkGroupTree(groups), nil
+}
+
+// GetPublicLinkGroups retrieves all public link groups with their links as a tree.
+// Subgroups are only public if they are marked so themselves.
+func (s *sqlStore) GetPublicLinkGroups() ([]LinkGroup, error) {
+	rows, err := s.query(`
+		SELECT id, parent_id, name, sort_order, visibility, created_at, updated_at
+		FROM link_groups
+		WHERE visibility = ?
+		ORDER BY sort_order ASC, id ASC
+	`, VisibilityPublic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	groups := []LinkGroup{}
+
+	for rows.Next() {
+		var (
+			group    LinkGroup
+			parentID sql.NullInt64
+		)
+		err := rows.Scan(
+			&group.ID,
+			&parentID,
+			&group.Name,
+			&group.SortOrder,
+			&group.Visibility,
+			&group.CreatedAt,
+			&group.UpdatedAt,
+		)
 		if err != nil {
 			return nil, err
 		}
-		group.Links = links
+
+		// Anonymous visitors can only read public groups, owners are not disclosed
+		group.Permission = PermissionRead
+		if parentID.Valid {
+			group.ParentID = &parentID.Int64
+		}
 
 		groups = append(groups, group)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-	return groups, nil
+	// Get links for each group
+	for i := range groups {
+		links, err := s.GetLinksByGroupID(groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].Links = links
+	}
+
+	return buildLinkGroupTree(groups), nil
 }
 
-// GetLinksByGroupID retrieves all links for a specific group
-func GetLinksByGroupID(groupID int64) ([]Link, error) {
-	rows, err := DB.Query(`
-		SELECT id, group_id, name, url, sort_order, created_at, updated_at 
-		FROM links 
-		WHERE group_id = ? 
-		ORDER BY sort_order ASC
+// GetLinksByGroupID retrieves all links for a specific group with their tags, metadata and health
+func (s *sqlStore) GetLinksByGroupID(groupID int64) ([]Link, error) {
+	rows, err := s.query(`
+		SELECT `+linkColumns+`
+		FROM links l
+		WHERE l.group_id = ? 
+		ORDER BY l.sort_order ASC
 	`, groupID)
 	if err != nil {
 		return nil, err
@@ -85,124 +256,235 @@ func GetLinksByGroupID(groupID int64) ([]Link, error) {
 
 	for rows.Next() {
 		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.GroupID,
-			&link.Name,
-			&link.URL,
-			&link.SortOrder,
-			&link.CreatedAt,
-			&link.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanLink(rows.Scan, &link); err != nil {
 			return nil, err
 		}
 
 		links = append(links, link)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := s.loadLinkRelations(links); err != nil {
+		return nil, err
+	}
 
 	return links, nil
 }
 
-// CreateLinkGroup creates a new link group
-func CreateLinkGroup(name string, sortOrder int) (int64, error) {
-	result, err := DB.Exec(`
-		INSERT INTO link_groups (name, sort_order) 
-		VALUES (?, ?)
-	`, name, sortOrder)
+// GetLink retrieves a link by ID with its tags, metadata and health
+func (s *sqlStore) GetLink(id int64) (Link, error) {
+	var link Link
+	err := scanLink(s.queryRow("SELECT "+linkColumns+" FROM links l WHERE l.id = ?", id).Scan, &link)
 	if err != nil {
-		return 0, err
+		return Link{}, err
 	}
 
-	return result.LastInsertId()
-}
-
-// UpdateLinkGroup updates an existing link group
-func UpdateLinkGroup(id int64, name string, sortOrder int) error {
-	_, err := DB.Exec(`
-		UPDATE link_groups 
-		SET name = ?, sort_order = ?, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = ?
-	`, name, sortOrder, id)
+	links := []Link{link}
+	if err := s.loadLinkRelations(links); err != nil {
+		return Link{}, err
+	}
 
-	return err
+	return links[0], nil
 }
 
-// DeleteLinkGroup deletes a link group and all its links
-func DeleteLinkGroup(id int64) error {
-	_, err := DB.Exec("DELETE FROM link_groups WHERE id = ?", id)
-	return err
+// loadLinkRelations fills in the tags, metadata and health of links
+func (s *sqlStore) loadLinkRelations(links []Link) error {
+	if err := s.loadLinkTags(links); err != nil {
+		return err
+	}
+	if err := s.loadLinkMetadata(links); err != nil {
+		return err
+	}
+
+	return s.loadLinkHealth(links)
 }
 
-// CreateLink creates a new link
-func CreateLink(groupID int64, name, url string, sortOrder int) (int64, error) {
-	result, err := DB.Exec(`
-		INSERT INTO links (group_id, name, url, sort_order) 
-		VALUES (?, ?, ?, ?)
-	`, groupID, name, url, sortOrder)
+// GetLinkGroupIDByLinkID returns the ID of the group a link belongs to
+func (s *sqlStore) GetLinkGroupIDByLinkID(linkID int64) (int64, error) {
+	var groupID int64
+	err := s.queryRow("SELECT group_id FROM links WHERE id = ?", linkID).Scan(&groupID)
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return groupID, nil
 }
 
-// UpdateLink updates an existing link
-func UpdateLink(id int64, groupID int64, name, url string, sortOrder int) error {
-	_, err := DB.Exec(`
-		UPDATE links 
-		SET group_id = ?, name = ?, url = ?, sort_order = ?, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = ?
-	`, groupID, name, url, sortOrder, id)
+// GetLinkGroupVisibility returns whether a link group is private or public
+func (s *sqlStore) GetLinkGroupVisibility(groupID int64) (string, error) {
+	var visibility string
+	err := s.queryRow("SELECT visibility FROM link_groups WHERE id = ?", groupID).Scan(&visibility)
+	if err != nil {
+		return "", err
+	}
 
-	return err
+	return visibility, nil
 }
 
-// DeleteLink deletes a link
-func DeleteLink(id int64) error {
-	_, err := DB.Exec("DELETE FROM links WHERE id = ?", id)
-	return err
+// CreateLinkGroup creates a new link group owned by a user
+func (s *sqlStore) CreateLinkGroup(userID int64, name string, sortOrder int, visibility string) (int64, error) {
+	return s.insert(`
+		INSERT INTO link_groups (user_id, name, sort_order, visibility) 
+		VALUES (?, ?, ?, ?)
+	`, userID, name, sortOrder, visibility)
 }
 
-// CreateLinkGroupTx creates a new link group within a transaction
-func CreateLinkGroupTx(tx *sql.Tx, name string, sortOrder int) (int64, error) {
-	result, err := tx.Exec(`
-		INSERT INTO link_groups (name, sort_order) 
-		VALUES (?, ?)
-	`, name, sortOrder)
+// UpdateLinkGroup updates an existing link group, keeping its visibility if none is given
+func (s *sqlStore) UpdateLinkGroup(id int64, name string, sortOrder int, visibility string) error {
+	result, err := s.exec(`
+		UPDATE link_groups 
+		SET name = ?, sort_order = ?, visibility = COALESCE(NULLIF(?, ''), visibility),
+			updated_at = CURRENT_TIMESTAMP 
+		WHERE id = ?
+	`, name, sortOrder, visibility, id)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return result.LastInsertId()
+	return requireRowsAffected(result)
 }
 
-// CreateLinkTx creates a new link within a transaction
-func CreateLinkTx(tx *sql.Tx, groupID int64, name, url string, sortOrder int) (int64, error) {
-	result, err := tx.Exec(`
-		INSERT INTO links (group_id, name, url, sort_order) 
-		VALUES (?, ?, ?, ?)
-	`, groupID, name, url, sortOrder)
-	if err != nil {
-		return 0, err
-	}
+// ReorderLinkGroups sets the sort order of link groups to their position in ids, starting at 0.
+// Groups that are not listed keep their sort order.
+func (s *sqlStore) ReorderLinkGroups(ids []int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		for position, id := range ids {
+			result, err := tx.exec(`
+				UPDATE link_groups
+				SET sort_order = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ?
+			`, position, id)
+			if err != nil {
+				return err
+			}
+			if err := requireRowsAffected(result); err != nil {
+				return err
+			}
+		}
 
-	return result.LastInsertId()
+		return nil
+	})
 }
 
-// UpdateLinkGroupTx updates an existing link group within a transaction
-func UpdateLinkGroupTx(tx *sql.Tx, id int64, name string, sortOrder int) error {
-	_, err := tx.Exec(`
-		UPDATE link_groups 
-		SET name = ?, sort_order = ?, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = ?
-	`, name, sortOrder, id)
+// DeleteLinkGroup deletes a link group owned by a user with all its subgroups and their links
+func (s *sqlStore) DeleteLinkGroup(id int64, userID int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		var ownerID sql.NullInt64
+		if err := tx.queryRow("SELECT user_id FROM link_groups WHERE id = ?", id).Scan(&ownerID); err != nil {
+			return err
+		}
+		if ownerID.Int64 != userID {
+			return sql.ErrNoRows
+		}
 
-	return err
+		if err := tx.unindexGroupLinks(subtreeQuery, id); err != nil {
+			return err
+		}
+		_, err := tx.exec("DELETE FROM link_groups WHERE id IN ("+subtreeQuery+")", id)
+		return err
+	})
 }
 
-// DeleteLinksByGroupIDTx deletes all links for a specific group within a transaction
-func DeleteLinksByGroupIDTx(tx *sql.Tx, groupID int64) error {
-	_, err := tx.Exec("DELETE FROM links WHERE group_id = ?", groupID)
-	return err
+// CreateLink creates a new link
+func (s *sqlStore) CreateLink(groupID int64, name, url string, sortOrder int) (int64, error) {
+	var id int64
+	err := s.inTx(func(tx *sqlStore) error {
+		var err error
+		id, err = tx.insert(`
+			INSERT INTO links (group_id, name, url, sort_order) 
+			VALUES (?, ?, ?, ?)
+		`, groupID, name, url, sortOrder)
+		if err != nil {
+			return err
+		}
+
+		return tx.indexLink(id)
+	})
+
+	return id, err
+}
+
+// UpdateLink updates an existing link. A fetched icon and the health check are dropped when the URL changes.
+func (s *sqlStore) UpdateLink(id int64, groupID int64, name, url string, sortOrder int) error {
+	return s.inTx(func(tx *sqlStore) error {
+		_, err := tx.exec(`
+			DELETE FROM link_icons
+			WHERE link_id = ? AND NOT uploaded AND EXISTS (SELECT 1 FROM links WHERE id = ? AND url <> ?)
+		`, id, id, url)
+		if err != nil {
+			return err
+		}
+		_, err = tx.exec(`
+			DELETE FROM link_health
+			WHERE link_id = ? AND EXISTS (SELECT 1 FROM links WHERE id = ? AND url <> ?)
+		`, id, id, url)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.exec(`
+			UPDATE links 
+			SET group_id = ?, name = ?, url = ?, sort_order = ?, updated_at = CURRENT_TIMESTAMP 
+			WHERE id = ?
+		`, groupID, name, url, sortOrder, id)
+		if err != nil {
+			return err
+		}
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+
+		return tx.indexLink(id)
+	})
+}
+
+// ReorderLinks sets the sort order of links of a group to their position in ids, starting at 0.
+// It returns sql.ErrNoRows, changing nothing, if a link is not in the group.
+func (s *sqlStore) ReorderLinks(groupID int64, ids []int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		for position, id := range ids {
+			result, err := tx.exec(`
+				UPDATE links
+				SET sort_order = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ? AND group_id = ?
+			`, position, id, groupID)
+			if err != nil {
+				return err
+			}
+			if err := requireRowsAffected(result); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteLink deletes a link
+func (s *sqlStore) DeleteLink(id int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		result, err := tx.exec("DELETE FROM links WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+
+		return tx.unindexLink(id)
+	})
+}
+
+// DeleteLinksByGroupID deletes all links for a specific group
+func (s *sqlStore) DeleteLinksByGroupID(groupID int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		if err := tx.unindexGroupLinks("SELECT id FROM link_groups WHERE id = ?", groupID); err != nil {
+			return err
+		}
+		_, err := tx.exec("DELETE FROM links WHERE group_id = ?", groupID)
+		return err
+	})
 }
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// migrationFiles holds the numbered migrations of each database in its own directory,
+// named like 0001_initial.up.sql and 0001_initial.down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFileName matches migration file names and captures version, name and direction
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with the SQL to apply and to revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String returns the migration's file name without direction, e.g. 0001_initial
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer version of link-deck
+type ErrSchemaTooNew struct {
+	Current int
+	Latest  int
+}
+
+func (e *ErrSchemaTooNew) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the latest version %d known to this binary, upgrade link-deck", e.Current, e.Latest)
+}
+
+// Migrations returns the migrations embedded in the binary for a database driver, ordered by version
+func Migrations(driver string) ([]Migration, error) {
+	d, err := dialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadMigrations(d.migrations)
+}
+
+// loadMigrations reads the migrations in a directory of migrationFiles
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	// Versions must be 1, 2, 3, ... so that a gap is noticed before it reaches a database
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %s is out of sequence, expected version %d", migration, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// LatestSchemaVersion returns the schema version this binary migrates databases to
+func (s *sqlStore) LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations(s.dialect.migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(migrations), nil
+}
+
+// SchemaVersion returns the version of the database schema, 0 for an empty or unversioned database
+func (s *sqlStore) SchemaVersion() (int, error) {
+	exists, err := s.tableExists("schema_migrations")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	err = s.queryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Migrate applies or reverts migrations until the database schema is at version target,
+// or at the latest version if target is negative. At the latest version it also fills in missing alias shapes
+// and icon sums, and rebuilds the search index.
+// With dryRun the planned steps are only logged.
+// It returns the names of the migrations applied or reverted.
+func (s *sqlStore) Migrate(target int, dryRun bool) ([]string, error) {
+	migrations, err := loadMigrations(s.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+	latest := len(migrations)
+	if target < 0 {
+		target = latest
+	}
+	if target > latest {
+		return nil, fmt.Errorf("cannot migrate to version %d, the latest version is %d", target, latest)
+	}
+
+	// Databases from before migrations existed need to catch up first
+	legacy, err := s.isLegacySchema()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > latest {
+		return nil, &ErrSchemaTooNew{Current: current, Latest: latest}
+	}
+
+	if legacy {
+		if dryRun {
+			log.Printf("Migrate: would upgrade the unversioned schema before migrating")
+		} else if err := s.upgradeLegacySchema(); err != nil {
+			return nil, fmt.Errorf("failed to upgrade unversioned schema: %w", err)
+		}
+	}
+	if !dryRun {
+		if err := s.ensureMigrationsTable(); err != nil {
+			return nil, err
+		}
+	}
+
+	var steps []string
+	for current < target {
+		migration := migrations[current]
+		steps = append(steps, "up "+migration.String())
+		if dryRun {
+			log.Printf("Migrate: would apply %s", migration)
+		} else if err := s.runMigration(migration, migration.Up, true); err != nil {
+			return steps, fmt.Errorf("failed to apply migration %s: %w", migration, err)
+		}
+		current++
+	}
+	for current > target {
+		migration := migrations[current-1]
+		steps = append(steps, "down "+migration.String())
+		if dryRun {
+			log.Printf("Migrate: would revert %s", migration)
+		} else if err := s.runMigration(migration, migration.Down, false); err != nil {
+			return steps, fmt.Errorf("failed to revert migration %s: %w", migration, err)
+		}
+		current--
+	}
+
+	if legacy && !dryRun {
+		if err := s.finishLegacyUpgrade(); err != nil {
+			return steps, fmt.Errorf("failed to upgrade unversioned schema: %w", err)
+		}
+	}
+
+	// Alias shapes and icon sums are computed in Go and the search index is rebuilt at startup
+	// rather than migrated
+	if !dryRun && current == latest {
+		if err := s.fillAliasShapes(); err != nil {
+			return steps, err
+		}
+		if err := s.fillIconSums(); err != nil {
+			return steps, err
+		}
+		if err := s.rebuildSearchIndex(); err != nil {
+			return steps, err
+		}
+	}
+
+	return steps, nil
+}
+
+// runMigration runs the SQL of one migration and records it in schema_migrations, all in one transaction
+func (s *sqlStore) runMigration(migration Migration, statements string, up bool) error {
+	err := s.inTx(func(tx *sqlStore) error {
+		// The statements are run as they are, Postgres only accepts several at once without parameters
+		if _, err := tx.q.Exec(statements); err != nil {
+			return err
+		}
+
+		var err error
+		if up {
+			_, err = tx.exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name)
+		} else {
+			_, err = tx.exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if up {
+		log.Printf("Applied migration %s", migration)
+	} else {
+		log.Printf("Reverted migration %s", migration)
+	}
+	return nil
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func (s *sqlStore) ensureMigrationsTable() error {
+	_, err := s.exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	return err
+}
+
+// tableExists reports whether the database has a table with the given name
+func (s *sqlStore) tableExists(name string) (bool, error) {
+	var count int
+	err := s.queryRow(s.dialect.tableExistsQuery, name).Scan(&count)
+	return count > 0, err
+}
+
+// isLegacySchema reports whether the database has tables but no record of migrations,
+// meaning it was created by a version of link-deck from before migrations existed.
+// Those versions only supported SQLite.
+func (s *sqlStore) isLegacySchema() (bool, error) {
+	if s.dialect.driver != sqliteDialect.driver {
+		return false, nil
+	}
+
+	hasUsers, err := s.tableExists("users")
+	if err != nil || !hasUsers {
+		return false, err
+	}
+
+	hasMigrations, err := s.tableExists("schema_migrations")
+	return !hasMigrations, err
+}
+
+// legacyColumns are the columns that unversioned databases may lack, in the order they are added
+var legacyColumns = []struct{ table, column, definition string }{
+	{"users", "disabled", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'editor'"},
+	{"users", "auth_provider", "TEXT NOT NULL DEFAULT 'local'"},
+	{"users", "external_id", "TEXT"},
+	{"users", "totp_secret", "TEXT"},
+	{"users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"users", "totp_last_counter", "INTEGER NOT NULL DEFAULT 0"},
+	{"link_groups", "user_id", "INTEGER REFERENCES users(id) ON DELETE CASCADE"},
+	{"link_groups", "visibility", "TEXT NOT NULL DEFAULT 'private'"},
+}
+
+// upgradeLegacySchema adds the columns that unversioned databases may lack, so that the
+// idempotent initial migration can bring the rest of the schema up to date
+func (s *sqlStore) upgradeLegacySchema() error {
+	log.Println("Upgrading unversioned database schema")
+
+	for _, c := range legacyColumns {
+		added, err := s.addColumnIfMissing(c.table, c.column, c.definition)
+		if err != nil {
+			return err
+		}
+		if !added || c.column != "role" {
+			continue
+		}
+
+		// Accounts created before roles existed could edit everything; the seeded admin becomes an admin
+		if _, err := s.exec("UPDATE users SET role = ? WHERE username = 'admin'", RoleAdmin); err != nil {
+			return fmt.Errorf("failed to set admin role: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// finishLegacyUpgrade fixes up data of unversioned databases once the schema is migrated
+func (s *sqlStore) finishLegacyUpgrade() error {
+	// Groups created before per-user decks existed belong to the admin user
+	_, err := s.exec(`
+		UPDATE link_groups
+		SET user_id = (SELECT id FROM users WHERE username = 'admin')
+		WHERE user_id IS NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to assign existing link groups to admin: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+-- Drop everything created by the initial schema, dependent tables first
+DROP INDEX IF EXISTS idx_users_external_id;
+DROP TABLE IF EXISTS settings;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS group_shares;
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS links;
+DROP TABLE IF EXISTS link_groups;
+DROP TABLE IF EXISTS users;
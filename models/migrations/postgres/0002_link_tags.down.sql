@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_link_tags_tag_id;
+DROP TABLE IF EXISTS link_tags;
+DROP TABLE IF EXISTS tags;
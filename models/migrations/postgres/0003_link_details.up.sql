@@ -0,0 +1,13 @@
+-- Links can say what they are for, who owns them and where they point
+
+ALTER TABLE links ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE links ADD COLUMN environment TEXT NOT NULL DEFAULT '';
+
+-- link_metadata table, free-form key/value pairs of each link
+CREATE TABLE link_metadata (
+	link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (link_id, key)
+);
@@ -0,0 +1,6 @@
+-- Link groups can be nested below another group of the same owner.
+-- Deleting a group deletes its subgroups with their links.
+
+ALTER TABLE link_groups ADD COLUMN parent_id BIGINT REFERENCES link_groups (id) ON DELETE CASCADE;
+
+CREATE INDEX idx_link_groups_parent_id ON link_groups (parent_id);
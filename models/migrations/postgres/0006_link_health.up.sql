@@ -0,0 +1,11 @@
+-- Results of the background health checks of links
+
+-- link_health table, the last check of each link. status_code is 0 when the
+-- request failed without a response, error then says why.
+CREATE TABLE link_health (
+	link_id BIGINT PRIMARY KEY REFERENCES links(id) ON DELETE CASCADE,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	latency_ms INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	checked_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+-- Clicks on links opened through their redirect URL, for usage analytics
+
+-- link_clicks table, one row per click. user_id is NULL for visitors of public
+-- links and for users deleted since, referrer is empty if the browser sent none.
+CREATE TABLE link_clicks (
+	id BIGSERIAL PRIMARY KEY,
+	link_id BIGINT NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+	user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+	referrer TEXT NOT NULL DEFAULT '',
+	clicked_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_link_clicks_link_id ON link_clicks (link_id, clicked_at);
+CREATE INDEX idx_link_clicks_clicked_at ON link_clicks (clicked_at);
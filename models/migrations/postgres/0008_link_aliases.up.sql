@@ -0,0 +1,6 @@
+-- Links can have a short alias to open them with, like go-links
+
+-- alias is NULL for links without one, aliases like pr/{n} take parameters for the URL
+ALTER TABLE links ADD COLUMN alias TEXT;
+
+CREATE UNIQUE INDEX idx_links_alias ON links (alias);
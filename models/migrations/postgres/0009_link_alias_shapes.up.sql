@@ -0,0 +1,7 @@
+-- The shape of an alias leaves out the names of its parameters, pr/{} for pr/{n}.
+-- Aliases of the same shape match the same paths, so no two links can have one.
+-- The shapes of existing aliases are filled in on startup, see fillAliasShapes.
+
+ALTER TABLE links ADD COLUMN alias_shape TEXT;
+
+CREATE UNIQUE INDEX idx_links_alias_shape ON links (alias_shape);
@@ -0,0 +1 @@
+ALTER TABLE link_icons DROP COLUMN data_sum;
@@ -0,0 +1,114 @@
+-- Initial schema. Every statement is idempotent, so databases created before
+-- migrations existed can be brought under version control by applying it.
+
+-- users table
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'editor',
+	disabled BOOLEAN NOT NULL DEFAULT 0,
+	auth_provider TEXT NOT NULL DEFAULT 'local',
+	external_id TEXT,
+	totp_secret TEXT,
+	totp_enabled BOOLEAN NOT NULL DEFAULT 0,
+	totp_last_counter INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- link_groups table
+CREATE TABLE IF NOT EXISTS link_groups (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	visibility TEXT NOT NULL DEFAULT 'private',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- links table
+CREATE TABLE IF NOT EXISTS links (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	icon TEXT,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (group_id) REFERENCES link_groups(id) ON DELETE CASCADE
+);
+
+-- teams table
+CREATE TABLE IF NOT EXISTS teams (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- team_members table
+CREATE TABLE IF NOT EXISTS team_members (
+	team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (team_id, user_id)
+);
+
+-- group_shares table, each share targets either a user or a team
+CREATE TABLE IF NOT EXISTS group_shares (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_id INTEGER NOT NULL REFERENCES link_groups(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	team_id INTEGER REFERENCES teams(id) ON DELETE CASCADE,
+	permission TEXT NOT NULL DEFAULT 'read',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	CHECK ((user_id IS NULL) <> (team_id IS NULL))
+);
+
+-- sessions table, one row per login holding the hash of its current refresh token
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	refresh_token_hash TEXT NOT NULL UNIQUE,
+	previous_token_hash TEXT,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+-- api_tokens table, personal access tokens used by scripts instead of a login
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP,
+	expires_at TIMESTAMP
+);
+
+-- recovery_codes table, one-time codes for users who lost their authenticator
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	used_at TIMESTAMP
+);
+
+-- settings table, instance-wide settings changed by admins at runtime
+CREATE TABLE IF NOT EXISTS settings (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+-- External accounts are identified by their subject at the provider
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id
+ON users (auth_provider, external_id) WHERE external_id IS NOT NULL;
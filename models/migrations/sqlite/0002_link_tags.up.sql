@@ -0,0 +1,17 @@
+-- Tags let a link show up under several topics without being duplicated
+
+-- tags table, names are lowercase and unique across the instance
+CREATE TABLE tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- link_tags table, which tags each link has
+CREATE TABLE link_tags (
+	link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+	PRIMARY KEY (link_id, tag_id)
+);
+
+CREATE INDEX idx_link_tags_tag_id ON link_tags (tag_id);
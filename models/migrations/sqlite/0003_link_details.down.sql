@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS link_metadata;
+ALTER TABLE links DROP COLUMN environment;
+ALTER TABLE links DROP COLUMN owner;
+ALTER TABLE links DROP COLUMN description;
@@ -0,0 +1,11 @@
+-- Icons of links, uploaded ones and those fetched from the linked sites.
+-- links.icon holds an icon URL set on the link.
+
+-- link_icons table, a fetch that found no icon is kept without data so it is not retried at once
+CREATE TABLE link_icons (
+	link_id INTEGER PRIMARY KEY REFERENCES links(id) ON DELETE CASCADE,
+	content_type TEXT NOT NULL DEFAULT '',
+	data BLOB,
+	uploaded BOOLEAN NOT NULL DEFAULT FALSE,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_link_groups_parent_id;
+ALTER TABLE link_groups DROP COLUMN parent_id;
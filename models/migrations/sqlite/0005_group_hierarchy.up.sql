@@ -0,0 +1,7 @@
+-- Link groups can be nested below another group of the same owner.
+-- Deleting a group deletes its subgroups, which the application does as the
+-- column cannot be dropped again in SQLite if it were a foreign key.
+
+ALTER TABLE link_groups ADD COLUMN parent_id INTEGER;
+
+CREATE INDEX idx_link_groups_parent_id ON link_groups (parent_id);
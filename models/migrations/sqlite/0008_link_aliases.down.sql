@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_links_alias;
+ALTER TABLE links DROP COLUMN alias;
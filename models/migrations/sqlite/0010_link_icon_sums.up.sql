@@ -0,0 +1,4 @@
+-- The sum of an icon identifies its data, uploaded icons version their icon URLs with it.
+-- The sums of existing icons are filled in on startup, see fillIconSums.
+
+ALTER TABLE link_icons ADD COLUMN data_sum TEXT;
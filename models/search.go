@@ -0,0 +1,318 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MaxSearchTerms is the most words of a search query that are used, the rest are ignored
+const MaxSearchTerms = 10
+
+// SearchResult is a link matching a search, with the group it is in
+type SearchResult struct {
+	Link
+	GroupName string `json:"group_name"`
+	// Rank orders the results, higher is a better match
+	Rank float64 `json:"rank"`
+}
+
+// Weights of where a search term matched. Names count most, then tags and descriptions,
+// the owner, environment and metadata least.
+const (
+	searchWeightName        = 10.0
+	searchWeightTags        = 5.0
+	searchWeightDescription = 3.0
+	searchWeightURL         = 2.0
+	searchWeightDetails     = 1.0
+)
+
+// searchTerms splits a search query into lowercase words, dropping punctuation
+func searchTerms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > MaxSearchTerms {
+		terms = terms[:MaxSearchTerms]
+	}
+
+	return terms
+}
+
+// SearchLinks returns up to limit links in groups the user can read that match every word
+// of the query, as a prefix of a word in their name, URL, tags, description or other details,
+// best matches first
+func (s *sqlStore) SearchLinks(userID int64, query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	var (
+		results []SearchResult
+		err     error
+	)
+	switch {
+	case s.dialect.fts5:
+		results, err = s.searchFTS5(userID, terms, limit)
+	case s.dialect.driver == postgresDialect.driver:
+		results, err = s.searchPostgres(userID, terms, limit)
+	default:
+		results, err = s.searchScan(userID, terms, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]Link, len(results))
+	for i := range results {
+		links[i] = results[i].Link
+	}
+	if err := s.loadLinkRelations(links); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Link = links[i]
+	}
+
+	return results, nil
+}
+
+// searchFTS5 searches the link_search index of SQLite
+func (s *sqlStore) searchFTS5(userID int64, terms []string, limit int) ([]SearchResult, error) {
+	// Quote every term so it is not read as query syntax, and match it as a prefix
+	match := make([]string, len(terms))
+	for i, term := range terms {
+		match[i] = `"` + term + `"*`
+	}
+
+	// bm25 is lower for better matches, its weights follow the order of searchDocumentsColumns
+	weights := fmt.Sprintf("%g, %g, %g, %g, %g",
+		searchWeightName, searchWeightURL, searchWeightTags, searchWeightDescription, searchWeightDetails)
+	return s.scanSearchResults(`
+		SELECT `+linkColumns+`, g.name, -bm25(link_search, `+weights+`) AS rank
+		FROM link_search
+		JOIN links l ON l.id = link_search.rowid
+		JOIN link_groups g ON g.id = l.group_id
+		LEFT JOIN (`+shareLevelsQuery+`) s ON s.group_id = g.id
+		WHERE link_search MATCH ? AND (g.user_id = ? OR s.level IS NOT NULL)
+		ORDER BY rank DESC, l.name ASC
+		LIMIT ?
+	`, userID, userID, strings.Join(match, " "), userID, limit)
+}
+
+// searchPostgres searches with the full-text search of PostgreSQL
+func (s *sqlStore) searchPostgres(userID int64, terms []string, limit int) ([]SearchResult, error) {
+	match := make([]string, len(terms))
+	for i, term := range terms {
+		match[i] = term + ":*"
+	}
+
+	// Punctuation is replaced by spaces so the parts of URLs are words of their own.
+	// Postgres has four weights, so the owner, environment and metadata share the lowest with the URL.
+	return s.scanSearchResults(`
+		SELECT `+linkColumns+`, g.name, ts_rank(d.document, q.query) AS rank
+		FROM links l
+		JOIN link_groups g ON g.id = l.group_id
+		LEFT JOIN (`+shareLevelsQuery+`) s ON s.group_id = g.id,
+		LATERAL (
+			SELECT
+				setweight(to_tsvector('simple', regexp_replace(l.name, '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+				setweight(to_tsvector('simple', COALESCE((
+					SELECT string_agg(t.name, ' ') FROM link_tags lt JOIN tags t ON t.id = lt.tag_id WHERE lt.link_id = l.id
+				), '')), 'B') ||
+				setweight(to_tsvector('simple', regexp_replace(l.description, '[^[:alnum:]]+', ' ', 'g')), 'C') ||
+				setweight(to_tsvector('simple', regexp_replace(l.url || ' ' || l.owner || ' ' || l.environment || ' ' || COALESCE((
+					SELECT string_agg(m.key || ' ' || m.value, ' ') FROM link_metadata m WHERE m.link_id = l.id
+				), ''), '[^[:alnum:]]+', ' ', 'g')), 'D') AS document
+		) d,
+		to_tsquery('simple', ?) q(query)
+		WHERE d.document @@ q.query AND (g.user_id = ? OR s.level IS NOT NULL)
+		ORDER BY rank DESC, l.name ASC
+		LIMIT ?
+	`, userID, userID, strings.Join(match, " & "), userID, limit)
+}
+
+// scanSearchResults runs a search query and reads its results
+func (s *sqlStore) scanSearchResults(query string, args ...any) ([]SearchResult, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		if err := scanLink(rows.Scan, &result.Link, &result.GroupName, &result.Rank); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// searchScan searches by reading every link the user can read, for SQLite builds without FTS5
+func (s *sqlStore) searchScan(userID int64, terms []string, limit int) ([]SearchResult, error) {
+	groups, err := s.GetAllLinkGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for _, group := range FlattenLinkGroups(groups) {
+		for _, link := range group.Links {
+			if rank := scanRank(link, terms); rank > 0 {
+				results = append(results, SearchResult{Link: link, GroupName: group.Name, Rank: rank})
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Name < results[j].Name
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// scanRank scores a link by where each term starts a word, 0 if any term matches nowhere
+func scanRank(link Link, terms []string) float64 {
+	name := searchTerms(link.Name)
+	url := searchTerms(link.URL)
+	tags := searchTerms(strings.Join(link.Tags, " "))
+	description := searchTerms(link.Description)
+	details := searchTerms(link.Details().searchText())
+
+	var rank float64
+	for _, term := range terms {
+		var termRank float64
+		if hasPrefixWord(name, term) {
+			termRank += searchWeightName
+		}
+		if hasPrefixWord(tags, term) {
+			termRank += searchWeightTags
+		}
+		if hasPrefixWord(description, term) {
+			termRank += searchWeightDescription
+		}
+		if hasPrefixWord(url, term) {
+			termRank += searchWeightURL
+		}
+		if hasPrefixWord(details, term) {
+			termRank += searchWeightDetails
+		}
+		if termRank == 0 {
+			return 0
+		}
+		rank += termRank
+	}
+
+	return rank
+}
+
+// hasPrefixWord reports whether one of the words starts with prefix
+func hasPrefixWord(words []string, prefix string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasFTS5 reports whether the SQLite library was built with FTS5,
+// which needs the sqlite_fts5 build tag of go-sqlite3
+func hasFTS5(db *sql.DB) bool {
+	var used bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used); err != nil {
+		return false
+	}
+
+	return used
+}
+
+// searchDocumentsColumns are the columns of the SQLite index, in the order of their bm25 weights
+const searchDocumentsColumns = "name, url, tags, description, details"
+
+// searchDocumentsQuery selects the ID and searchDocumentsColumns of links for the SQLite index,
+// with the tags separated by spaces and the owner, environment and metadata as details
+const searchDocumentsQuery = `
+	SELECT l.id, l.name, l.url, COALESCE((
+		SELECT group_concat(t.name, ' ') FROM link_tags lt JOIN tags t ON t.id = lt.tag_id WHERE lt.link_id = l.id
+	), ''), l.description, l.owner || ' ' || l.environment || ' ' || COALESCE((
+		SELECT group_concat(m.key || ' ' || m.value, ' ') FROM link_metadata m WHERE m.link_id = l.id
+	), '')
+	FROM links l
+`
+
+// rebuildSearchIndex recreates the link_search index, so it picks up new columns, and fills it from the links.
+// The index is not part of the migrations, databases must stay usable by builds without FTS5.
+func (s *sqlStore) rebuildSearchIndex() error {
+	if !s.dialect.fts5 {
+		return nil
+	}
+
+	err := s.inTx(func(tx *sqlStore) error {
+		if _, err := tx.exec("DROP TABLE IF EXISTS link_search"); err != nil {
+			return err
+		}
+		if _, err := tx.exec("CREATE VIRTUAL TABLE link_search USING fts5(" + searchDocumentsColumns + ")"); err != nil {
+			return err
+		}
+		_, err := tx.exec("INSERT INTO link_search (rowid, " + searchDocumentsColumns + ") " + searchDocumentsQuery)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+
+	log.Printf("Rebuilt the full-text search index")
+	return nil
+}
+
+// indexLink updates the search index entry of a link after it changed
+func (s *sqlStore) indexLink(linkID int64) error {
+	if !s.dialect.fts5 {
+		return nil
+	}
+
+	if err := s.unindexLink(linkID); err != nil {
+		return err
+	}
+	_, err := s.exec("INSERT INTO link_search (rowid, "+searchDocumentsColumns+") "+searchDocumentsQuery+" WHERE l.id = ?", linkID)
+	return err
+}
+
+// unindexLink removes a link from the search index
+func (s *sqlStore) unindexLink(linkID int64) error {
+	if !s.dialect.fts5 {
+		return nil
+	}
+
+	_, err := s.exec("DELETE FROM link_search WHERE rowid = ?", linkID)
+	return err
+}
+
+// unindexGroupLinks removes the links of the groups selected by groupsQuery from the search index.
+// Deleting groups cascades to their links, which the virtual table of the index knows nothing of,
+// so this must run before.
+func (s *sqlStore) unindexGroupLinks(groupsQuery string, args ...any) error {
+	if !s.dialect.fts5 {
+		return nil
+	}
+
+	_, err := s.exec("DELETE FROM link_search WHERE rowid IN (SELECT id FROM links WHERE group_id IN ("+groupsQuery+"))", args...)
+	return err
+}
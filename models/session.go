@@ -0,0 +1,233 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that was already rotated is used again.
+// The session is revoked because the token has most likely been stolen.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// Session represents a login of a user, kept alive by rotating refresh tokens
+type Session struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the session is neither revoked nor expired
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// sessionColumns lists the sessions columns read by scanSession, in order
+const sessionColumns = "id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at"
+
+// scanSession scans a row selected with sessionColumns into a session
+func scanSession(row rowScanner) (*Session, error) {
+	var (
+		session   Session
+		revokedAt sql.NullTime
+	)
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+
+	return &session, nil
+}
+
+// newRefreshToken returns a random refresh token and the hash stored for it
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	return token, hashToken(token), nil
+}
+
+// hashToken hashes a random token for storage, it has enough entropy to not need a slow hash
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for a user and returns it with its first refresh token
+func (s *sqlStore) CreateSession(userID int64, userAgent, ipAddress string, ttl time.Duration) (*Session, string, error) {
+	token, tokenHash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	id, err := s.insert(`
+		INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, userID, tokenHash, userAgent, ipAddress, now, now, now.Add(ttl))
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := s.GetSessionByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, token, nil
+}
+
+// GetSessionByID retrieves a session by ID
+func (s *sqlStore) GetSessionByID(id int64) (*Session, error) {
+	return scanSession(s.queryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one, returning the session.
+// It returns sql.ErrNoRows if the token is unknown, revoked or expired.
+func (s *sqlStore) RotateRefreshToken(token string) (*Session, string, error) {
+	tokenHash := hashToken(token)
+
+	session, err := scanSession(s.queryRow(
+		"SELECT "+sessionColumns+" FROM sessions WHERE refresh_token_hash = ?", tokenHash,
+	))
+	if err == sql.ErrNoRows {
+		// A rotated token being replayed means it leaked, end the session for everyone
+		var id int64
+		err := s.queryRow("SELECT id FROM sessions WHERE previous_token_hash = ?", tokenHash).Scan(&id)
+		if err == nil {
+			if err := s.RevokeSession(id); err != nil {
+				return nil, "", err
+			}
+			return nil, "", ErrRefreshTokenReused
+		}
+		if err != sql.ErrNoRows {
+			return nil, "", err
+		}
+		return nil, "", sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !session.Active() {
+		return nil, "", sql.ErrNoRows
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Only rotate if nobody else rotated the token in the meantime
+	now := time.Now().UTC()
+	result, err := s.exec(`
+		UPDATE sessions
+		SET refresh_token_hash = ?, previous_token_hash = ?, last_used_at = ?
+		WHERE id = ? AND refresh_token_hash = ?
+	`, newHash, tokenHash, now, session.ID, tokenHash)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return nil, "", err
+	}
+	session.LastUsedAt = now
+
+	return session, newToken, nil
+}
+
+// GetActiveSessionsByUserID retrieves the sessions of a user that are neither revoked nor expired
+func (s *sqlStore) GetActiveSessionsByUserID(userID int64) ([]Session, error) {
+	rows, err := s.query(`
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	sessions := []Session{}
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes a session so its tokens are no longer accepted
+func (s *sqlStore) RevokeSession(id int64) error {
+	result, err := s.exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// RevokeUserSession revokes a session of a specific user
+func (s *sqlStore) RevokeUserSession(userID, sessionID int64) error {
+	result, err := s.exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), sessionID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// RevokeUserSessions revokes all sessions of a user except the one with exceptID, which may be 0
+func (s *sqlStore) RevokeUserSessions(userID, exceptID int64) (int64, error) {
+	result, err := s.exec(
+		"UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID, exceptID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteExpiredSessions removes sessions that can no longer be used
+func (s *sqlStore) DeleteExpiredSessions() error {
+	_, err := s.exec("DELETE FROM sessions WHERE expires_at < ?", time.Now().UTC())
+	return err
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// Setting keys
+const (
+	// SettingRequireAdminTwoFactor makes two-factor auth mandatory for admins
+	SettingRequireAdminTwoFactor = "require_admin_2fa"
+)
+
+// GetSetting returns the value of a setting, or def if it was never set
+func (s *sqlStore) GetSetting(key, def string) (string, error) {
+	var value string
+	err := s.queryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return def, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// SetSetting stores the value of a setting
+func (s *sqlStore) SetSetting(key, value string) error {
+	_, err := s.exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value
+	`, key, value)
+
+	return err
+}
+
+// GetBoolSetting returns the value of a boolean setting, or false if it was never set
+func (s *sqlStore) GetBoolSetting(key string) (bool, error) {
+	value, err := s.GetSetting(key, "false")
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(value)
+}
+
+// SetBoolSetting stores the value of a boolean setting
+func (s *sqlStore) SetBoolSetting(key string, value bool) error {
+	return s.SetSetting(key, strconv.FormatBool(value))
+}
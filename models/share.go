@@ -0,0 +1,245 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Permissions a user can hold on a link group
+const (
+	PermissionOwner = "owner" // Owns the group and manages its shares
+	PermissionWrite = "write" // Edits the group and its links
+	PermissionRead  = "read"  // Only sees the group and its links
+)
+
+// GroupShare represents a link group shared with a user or a team
+type GroupShare struct {
+	ID         int64     `json:"id"`
+	GroupID    int64     `json:"group_id"`
+	UserID     *int64    `json:"user_id,omitempty"`
+	Username   string    `json:"username,omitempty"`
+	TeamID     *int64    `json:"team_id,omitempty"`
+	TeamName   string    `json:"team,omitempty"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// IsValidSharePermission reports whether permission can be granted through a share
+func IsValidSharePermission(permission string) bool {
+	return permission == PermissionRead || permission == PermissionWrite
+}
+
+// shareLevelsFor returns a query selecting the highest share level (2 for write, 1 for
+// read) per group for a user, either shared directly or through one of their teams.
+// Sharing a group also shares its subgroups. The recursion starts from the groups whose
+// IDs the groupIDs SQL lists, so the query takes the parameters of groupIDs first and
+// then the user ID twice.
+func shareLevelsFor(groupIDs string) string {
+	return `
+	WITH RECURSIVE ancestors (group_id, ancestor_id) AS (
+		SELECT id, id FROM link_groups WHERE id IN (` + groupIDs + `)
+		UNION ALL
+		SELECT a.group_id, g.parent_id
+		FROM ancestors a
+		JOIN link_groups g ON g.id = a.ancestor_id
+		WHERE g.parent_id IS NOT NULL
+	)
+	SELECT a.group_id, MAX(CASE sh.permission WHEN 'write' THEN 2 ELSE 1 END) AS level
+	FROM ancestors a
+	JOIN group_shares sh ON sh.group_id = a.ancestor_id
+	WHERE sh.user_id = ?
+		OR sh.team_id IN (SELECT team_id FROM team_members WHERE user_id = ?)
+	GROUP BY a.group_id
+`
+}
+
+// shareLevelsQuery is shareLevelsFor every group. It takes the user ID twice.
+var shareLevelsQuery = shareLevelsFor("SELECT id FROM link_groups")
+
+// GetLinkGroupPermission returns the permission a user holds on a link group,
+// or an empty string if the group is neither owned by nor shared with the user
+func (s *sqlStore) GetLinkGroupPermission(groupID, userID int64) (string, error) {
+	var (
+		ownerID sql.NullInt64
+		level   sql.NullInt64
+	)
+	err := s.queryRow(`
+		SELECT g.user_id, s.level
+		FROM link_groups g
+		LEFT JOIN (`+shareLevelsFor("?")+`) s ON s.group_id = g.id
+		WHERE g.id = ?
+	`, groupID, userID, userID, groupID).Scan(&ownerID, &level)
+	if err != nil {
+		return "", err
+	}
+
+	return permissionFor(ownerID.Int64 == userID, level), nil
+}
+
+// GetLinkGroupPermissions returns the permissions a user holds on several link groups
+// at once, keyed by group ID. Groups that don't exist are left out of the map.
+func (s *sqlStore) GetLinkGroupPermissions(groupIDs []int64, userID int64) (map[int64]string, error) {
+	permissions := make(map[int64]string, len(groupIDs))
+	if len(groupIDs) == 0 {
+		return permissions, nil
+	}
+
+	in := "?" + strings.Repeat(", ?", len(groupIDs)-1)
+	args := make([]any, 0, 2*len(groupIDs)+2)
+	for _, id := range groupIDs {
+		args = append(args, id)
+	}
+	args = append(args, userID, userID)
+	for _, id := range groupIDs {
+		args = append(args, id)
+	}
+
+	rows, err := s.query(`
+		SELECT g.id, g.user_id, s.level
+		FROM link_groups g
+		LEFT JOIN (`+shareLevelsFor(in)+`) s ON s.group_id = g.id
+		WHERE g.id IN (`+in+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id      int64
+			ownerID sql.NullInt64
+			level   sql.NullInt64
+		)
+		if err := rows.Scan(&id, &ownerID, &level); err != nil {
+			return nil, err
+		}
+		permissions[id] = permissionFor(ownerID.Int64 == userID, level)
+	}
+
+	return permissions, rows.Err()
+}
+
+// permissionFor converts ownership and a share level into a permission
+func permissionFor(owner bool, level sql.NullInt64) string {
+	switch {
+	case owner:
+		return PermissionOwner
+	case level.Valid && level.Int64 >= 2:
+		return PermissionWrite
+	case level.Valid:
+		return PermissionRead
+	default:
+		return ""
+	}
+}
+
+// CanReadGroup reports whether a permission allows reading a group
+func CanReadGroup(permission string) bool {
+	return permission != ""
+}
+
+// CanEditGroup reports whether a permission allows editing a group and its links
+func CanEditGroup(permission string) bool {
+	return permission == PermissionOwner || permission == PermissionWrite
+}
+
+// GetGroupShares retrieves all shares of a link group
+func (s *sqlStore) GetGroupShares(groupID int64) ([]GroupShare, error) {
+	rows, err := s.query(`
+		SELECT s.id, s.group_id, s.user_id, COALESCE(u.username, ''), s.team_id, COALESCE(t.name, ''),
+			s.permission, s.created_at, s.updated_at
+		FROM group_shares s
+		LEFT JOIN users u ON u.id = s.user_id
+		LEFT JOIN teams t ON t.id = s.team_id
+		WHERE s.group_id = ?
+		ORDER BY s.id ASC
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	shares := []GroupShare{}
+
+	for rows.Next() {
+		var (
+			share  GroupShare
+			userID sql.NullInt64
+			teamID sql.NullInt64
+		)
+		err := rows.Scan(
+			&share.ID,
+			&share.GroupID,
+			&userID,
+			&share.Username,
+			&teamID,
+			&share.TeamName,
+			&share.Permission,
+			&share.CreatedAt,
+			&share.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			share.UserID = &userID.Int64
+		}
+		if teamID.Valid {
+			share.TeamID = &teamID.Int64
+		}
+
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// ShareGroupWithUser shares a link group with a user, replacing any previous permission
+func (s *sqlStore) ShareGroupWithUser(groupID, userID int64, permission string) (int64, error) {
+	return s.upsertGroupShare(groupID, "user_id", userID, permission)
+}
+
+// ShareGroupWithTeam shares a link group with a team, replacing any previous permission
+func (s *sqlStore) ShareGroupWithTeam(groupID, teamID int64, permission string) (int64, error) {
+	return s.upsertGroupShare(groupID, "team_id", teamID, permission)
+}
+
+// upsertGroupShare updates the share of a group with a user or team, creating it if missing
+func (s *sqlStore) upsertGroupShare(groupID int64, column string, targetID int64, permission string) (int64, error) {
+	var id int64
+	err := s.queryRow(
+		"SELECT id FROM group_shares WHERE group_id = ? AND "+column+" = ?",
+		groupID, targetID,
+	).Scan(&id)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return s.insert(
+			"INSERT INTO group_shares (group_id, "+column+", permission) VALUES (?, ?, ?)",
+			groupID, targetID, permission,
+		)
+	case err != nil:
+		return 0, err
+	}
+
+	_, err = s.exec(
+		"UPDATE group_shares SET permission = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		permission, id,
+	)
+
+	return id, err
+}
+
+// DeleteGroupShare removes a share from a link group
+func (s *sqlStore) DeleteGroupShare(groupID, shareID int64) error {
+	result, err := s.exec("DELETE FROM group_shares WHERE id = ? AND group_id = ?", shareID, groupID)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
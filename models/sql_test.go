@@ -0,0 +1,1527 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// postgresDSNEnv names the environment variable with the Postgres database the tests may use.
+// The tests drop and recreate the link-deck tables in it.
+const postgresDSNEnv = "LINKDECK_TEST_POSTGRES_DSN"
+
+func TestMain(m *testing.M) {
+	// Hashing at the production cost would make the tests slow
+	BcryptCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) Store {
+		store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "linkdeck.db"))
+		if err != nil {
+			t.Fatalf("open SQLite: %v", err)
+		}
+		return store
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) Store {
+		store, err := NewMemoryStore()
+		if err != nil {
+			t.Fatalf("open memory store: %v", err)
+		}
+		return store
+	})
+}
+
+func TestMemoryStoresAreSeparate(t *testing.T) {
+	first, err := NewMemoryStore()
+	if err != nil {
+		t.Fatalf("open memory store: %v", err)
+	}
+	defer first.Close()
+	second, err := NewMemoryStore()
+	if err != nil {
+		t.Fatalf("open memory store: %v", err)
+	}
+	defer second.Close()
+
+	mustCreateUser(t, first, "alice", RoleViewer)
+	if _, err := second.GetUserByUsername("alice"); err != sql.ErrNoRows {
+		t.Errorf("user of one memory store found in another: %v", err)
+	}
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("set %s to run the store tests against Postgres", postgresDSNEnv)
+	}
+
+	runStoreTests(t, func(t *testing.T) Store {
+		store, err := NewPostgresStore(dsn)
+		if err != nil {
+			t.Fatalf("open Postgres: %v", err)
+		}
+		// Start from an empty schema, left behind by the previous test
+		if _, err := store.Migrate(0, false); err != nil {
+			t.Fatalf("reset Postgres schema: %v", err)
+		}
+		return store
+	})
+}
+
+// runStoreTests runs the same tests against every store implementation.
+// newStore returns a store with an empty database.
+func runStoreTests(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{"Users", testUsers},
+		{"ExternalUsers", testExternalUsers},
+		{"LinkGroups", testLinkGroups},
+		{"LinkGroupTree", testLinkGroupTree},
+		{"Reorder", testReorder},
+		{"Tags", testTags},
+		{"LinkDetails", testLinkDetails},
+		{"LinkIcons", testLinkIcons},
+		{"LinkHealth", testLinkHealth},
+		{"LinkClicks", testLinkClicks},
+		{"LinkAliases", testLinkAliases},
+		{"Search", testSearch},
+		{"Sharing", testSharing},
+		{"Sessions", testSessions},
+		{"APITokens", testAPITokens},
+		{"TwoFactor", testTwoFactor},
+		{"Settings", testSettings},
+		{"Transactions", testTransactions},
+		{"Migrations", testMigrations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			t.Cleanup(func() { store.Close() })
+
+			if _, err := store.Migrate(-1, false); err != nil {
+				t.Fatalf("migrate: %v", err)
+			}
+			tt.test(t, store)
+		})
+	}
+}
+
+// mustCreateUser creates a user or fails the test
+func mustCreateUser(t *testing.T, store Store, username, role string) int64 {
+	t.Helper()
+	id, err := store.CreateUser(username, "secret", role)
+	if err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return id
+}
+
+func testUsers(t *testing.T, store Store) {
+	id := mustCreateUser(t, store, "alice", RoleEditor)
+
+	if _, err := store.CreateUser("alice", "other", RoleViewer); err != ErrUserExists {
+		t.Errorf("creating a duplicate user returned %v, want ErrUserExists", err)
+	}
+
+	user, err := store.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.ID != id || user.Role != RoleEditor || user.AuthProvider != AuthProviderLocal || user.Disabled {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if !CheckPasswordHash("secret", user.Password) {
+		t.Error("password hash does not match")
+	}
+
+	if err := store.SetUserRole(id, RoleAdmin); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	if err := store.SetUserDisabled(id, true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if err := store.UpdatePassword(id, "changed"); err != nil {
+		t.Fatalf("update password: %v", err)
+	}
+	user, err = store.GetUserByID(id)
+	if err != nil {
+		t.Fatalf("get user by ID: %v", err)
+	}
+	if user.Role != RoleAdmin || !user.Disabled || !CheckPasswordHash("changed", user.Password) {
+		t.Errorf("user not updated: %+v", user)
+	}
+
+	users, err := store.GetAllUsers()
+	if err != nil || len(users) != 1 {
+		t.Errorf("GetAllUsers returned %d users, %v", len(users), err)
+	}
+
+	if err := store.DeleteUser(id); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if err := store.DeleteUser(id); err != sql.ErrNoRows {
+		t.Errorf("deleting a missing user returned %v, want sql.ErrNoRows", err)
+	}
+	if _, err := store.GetUserByID(id); err != sql.ErrNoRows {
+		t.Errorf("getting a deleted user returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testExternalUsers(t *testing.T, store Store) {
+	user, err := store.ProvisionExternalUser(AuthProviderOIDC, "sub-1", "carol", RoleViewer)
+	if err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+
+	// Later logins update the username and role from the provider
+	again, err := store.ProvisionExternalUser(AuthProviderOIDC, "sub-1", "caroline", RoleEditor)
+	if err != nil {
+		t.Fatalf("provision again: %v", err)
+	}
+	if again.ID != user.ID || again.Username != "caroline" || again.Role != RoleEditor {
+		t.Errorf("unexpected user %+v", again)
+	}
+
+	mustCreateUser(t, store, "dave", RoleViewer)
+	if _, err := store.ProvisionExternalUser(AuthProviderOIDC, "sub-2", "dave", RoleViewer); err != ErrUserExists {
+		t.Errorf("provisioning a taken username returned %v, want ErrUserExists", err)
+	}
+}
+
+func testLinkGroups(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	other := mustCreateUser(t, store, "bob", RoleEditor)
+
+	groupID, err := store.CreateLinkGroup(owner, "Work", 2, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if _, err := store.CreateLinkGroup(owner, "Home", 1, VisibilityPublic); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	linkID, err := store.CreateLink(groupID, "Docs", "https://example.com/docs", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if _, err := store.CreateLink(groupID, "Wiki", "https://example.com/wiki", 0); err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	groups, err := store.GetAllLinkGroups(owner)
+	if err != nil {
+		t.Fatalf("get groups: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "Home" || groups[1].Name != "Work" {
+		t.Fatalf("groups not ordered by sort order: %+v", groups)
+	}
+	work := groups[1]
+	if work.Permission != PermissionOwner || work.Owner != "alice" || len(work.Links) != 2 || work.Links[0].Name != "Wiki" {
+		t.Errorf("unexpected group %+v", work)
+	}
+
+	public, err := store.GetPublicLinkGroups()
+	if err != nil || len(public) != 1 || public[0].Name != "Home" {
+		t.Errorf("GetPublicLinkGroups returned %+v, %v", public, err)
+	}
+
+	// An empty visibility keeps the current one
+	if err := store.UpdateLinkGroup(groupID, "Office", 3, ""); err != nil {
+		t.Fatalf("update group: %v", err)
+	}
+	if err := store.UpdateLink(linkID, groupID, "Manual", "https://example.com/manual", 5); err != nil {
+		t.Fatalf("update link: %v", err)
+	}
+	if got, err := store.GetLinkGroupIDByLinkID(linkID); err != nil || got != groupID {
+		t.Errorf("GetLinkGroupIDByLinkID returned %d, %v", got, err)
+	}
+	if got, err := store.GetLinkGroupVisibility(groupID); err != nil || got != VisibilityPrivate {
+		t.Errorf("GetLinkGroupVisibility returned %q, %v", got, err)
+	}
+	if _, err := store.GetLinkGroupVisibility(9999); err != sql.ErrNoRows {
+		t.Errorf("GetLinkGroupVisibility of a missing group returned %v", err)
+	}
+	groups, _ = store.GetAllLinkGroups(owner)
+	if office := groups[1]; office.Name != "Office" || office.Visibility != VisibilityPrivate || office.Links[1].URL != "https://example.com/manual" {
+		t.Errorf("group not updated: %+v", office)
+	}
+
+	// Other users neither see nor delete the group
+	if groups, _ := store.GetAllLinkGroups(other); len(groups) != 0 {
+		t.Errorf("other user sees %d groups", len(groups))
+	}
+	if err := store.DeleteLinkGroup(groupID, other); err != sql.ErrNoRows {
+		t.Errorf("deleting another user's group returned %v, want sql.ErrNoRows", err)
+	}
+
+	if err := store.DeleteLink(linkID); err != nil {
+		t.Fatalf("delete link: %v", err)
+	}
+	if err := store.DeleteLinkGroup(groupID, owner); err != nil {
+		t.Fatalf("delete group: %v", err)
+	}
+	if links, _ := store.GetLinksByGroupID(groupID); len(links) != 0 {
+		t.Errorf("links of a deleted group remain: %+v", links)
+	}
+}
+
+func testLinkGroupTree(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	other := mustCreateUser(t, store, "bob", RoleEditor)
+
+	ids := make(map[string]int64)
+	for i, name := range []string{"Prod", "Staging", "Databases", "Postgres"} {
+		id, err := store.CreateLinkGroup(owner, name, i, VisibilityPrivate)
+		if err != nil {
+			t.Fatalf("create group: %v", err)
+		}
+		ids[name] = id
+	}
+	// Prod > Databases > Postgres
+	if err := store.MoveLinkGroup(ids["Databases"], ids["Prod"]); err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	if err := store.MoveLinkGroup(ids["Postgres"], ids["Databases"]); err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	linkID, err := store.CreateLink(ids["Postgres"], "Primary", "https://pg.example.com", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if err := store.SetLinkTags(linkID, []string{"database"}); err != nil {
+		t.Fatalf("set link tags: %v", err)
+	}
+
+	groups, err := store.GetAllLinkGroups(owner)
+	if err != nil {
+		t.Fatalf("get groups: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != "Prod" || groups[1].Name != "Staging" {
+		t.Fatalf("top level groups %+v", groups)
+	}
+	prod := groups[0]
+	if len(prod.Subgroups) != 1 || prod.Subgroups[0].Name != "Databases" || *prod.Subgroups[0].ParentID != ids["Prod"] ||
+		len(prod.Subgroups[0].Subgroups) != 1 || len(prod.Subgroups[0].Subgroups[0].Links) != 1 {
+		t.Errorf("Prod is not Prod > Databases > Postgres: %+v", prod)
+	}
+	if flat := FlattenLinkGroups(groups); len(flat) != 4 || flat[2].Name != "Postgres" || flat[1].Subgroups != nil {
+		t.Errorf("FlattenLinkGroups returned %+v", flat)
+	}
+	if filtered := FilterLinkGroupsByTag(groups, "database"); len(filtered) != 1 || len(filtered[0].Subgroups) != 1 {
+		t.Errorf("FilterLinkGroupsByTag dropped the parents of a tagged link: %+v", filtered)
+	}
+
+	// Groups cannot be moved below themselves
+	for _, parent := range []string{"Databases", "Postgres"} {
+		if err := store.MoveLinkGroup(ids["Databases"], ids[parent]); err != ErrGroupCycle {
+			t.Errorf("moving Databases below %s returned %v, want ErrGroupCycle", parent, err)
+		}
+	}
+
+	// Moving a group takes its subgroups along
+	if err := store.MoveLinkGroup(ids["Databases"], ids["Staging"]); err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	groups, _ = store.GetAllLinkGroups(owner)
+	if len(groups[0].Subgroups) != 0 || len(groups[1].Subgroups) != 1 || len(groups[1].Subgroups[0].Subgroups) != 1 {
+		t.Errorf("subtree not moved along: %+v", groups)
+	}
+
+	// Sharing a group shares its subgroups, a subgroup shared on its own is at the top level
+	if _, err := store.ShareGroupWithUser(ids["Staging"], other, PermissionWrite); err != nil {
+		t.Fatalf("share group: %v", err)
+	}
+	if permission, err := store.GetLinkGroupPermission(ids["Postgres"], other); err != nil || permission != PermissionWrite {
+		t.Errorf("permission on a subgroup of a shared group is %q, %v", permission, err)
+	}
+	reader := mustCreateUser(t, store, "carol", RoleViewer)
+	if _, err := store.ShareGroupWithUser(ids["Databases"], reader, PermissionRead); err != nil {
+		t.Fatalf("share group: %v", err)
+	}
+	if groups, _ := store.GetAllLinkGroups(reader); len(groups) != 1 || groups[0].Name != "Databases" || len(groups[0].Subgroups) != 1 {
+		t.Errorf("groups shared with reader %+v", groups)
+	}
+
+	// Moving to the top level, then deleting removes the whole subtree
+	if err := store.MoveLinkGroup(ids["Databases"], 0); err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	if groups, _ := store.GetAllLinkGroups(owner); len(groups) != 3 || groups[2].ParentID != nil {
+		t.Errorf("groups after moving to the top level %+v", groups)
+	}
+	if err := store.DeleteLinkGroup(ids["Databases"], owner); err != nil {
+		t.Fatalf("delete group: %v", err)
+	}
+	if _, err := store.GetLinkGroupPermission(ids["Postgres"], owner); err != sql.ErrNoRows {
+		t.Errorf("subgroup of a deleted group remains: %v", err)
+	}
+	if _, err := store.GetLink(linkID); err != sql.ErrNoRows {
+		t.Errorf("link in a subgroup of a deleted group remains: %v", err)
+	}
+}
+
+func testReorder(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	var groupIDs, linkIDs []int64
+	for i, name := range []string{"Work", "Home"} {
+		id, err := store.CreateLinkGroup(owner, name, i, VisibilityPrivate)
+		if err != nil {
+			t.Fatalf("create group: %v", err)
+		}
+		groupIDs = append(groupIDs, id)
+	}
+	for i, name := range []string{"Mail", "Wiki", "Docs"} {
+		id, err := store.CreateLink(groupIDs[0], name, "https://example.com/"+name, i)
+		if err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+		linkIDs = append(linkIDs, id)
+	}
+	otherLinkID, err := store.CreateLink(groupIDs[1], "Photos", "https://example.com/photos", 0)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	if err := store.ReorderLinkGroups([]int64{groupIDs[1], groupIDs[0]}); err != nil {
+		t.Fatalf("reorder groups: %v", err)
+	}
+	if groups, _ := store.GetAllLinkGroups(owner); len(groups) != 2 || groups[0].Name != "Home" {
+		t.Errorf("groups after reordering %+v", groups)
+	}
+
+	if err := store.ReorderLinks(groupIDs[0], []int64{linkIDs[2], linkIDs[0], linkIDs[1]}); err != nil {
+		t.Fatalf("reorder links: %v", err)
+	}
+	names := func() string {
+		links, _ := store.GetLinksByGroupID(groupIDs[0])
+		var names []string
+		for _, link := range links {
+			names = append(names, link.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	if got := names(); got != "Docs,Mail,Wiki" {
+		t.Errorf("links after reordering %s, want Docs,Mail,Wiki", got)
+	}
+
+	// A link of another group fails the whole reorder
+	if err := store.ReorderLinks(groupIDs[0], []int64{linkIDs[0], linkIDs[1], otherLinkID}); err != sql.ErrNoRows {
+		t.Errorf("reorder with a link of another group returned %v, want sql.ErrNoRows", err)
+	}
+	if got := names(); got != "Docs,Mail,Wiki" {
+		t.Errorf("links after a failed reorder %s, want Docs,Mail,Wiki", got)
+	}
+}
+
+func testTags(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	groupID, err := store.CreateLinkGroup(owner, "Ops", 1, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	grafana, err := store.CreateLink(groupID, "Grafana", "https://grafana.example.com", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	pager, err := store.CreateLink(groupID, "Pager", "https://pager.example.com", 2)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	if err := store.SetLinkTags(grafana, []string{"monitoring", "oncall"}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+	// Tags are shared between links
+	if err := store.SetLinkTags(pager, []string{"oncall"}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+
+	links, err := store.GetLinksByGroupID(groupID)
+	if err != nil {
+		t.Fatalf("get links: %v", err)
+	}
+	if got := strings.Join(links[0].Tags, ","); got != "monitoring,oncall" {
+		t.Errorf("Grafana has tags %q", got)
+	}
+	if got := strings.Join(links[1].Tags, ","); got != "oncall" {
+		t.Errorf("Pager has tags %q", got)
+	}
+
+	groups, err := store.GetAllLinkGroups(owner)
+	if err != nil {
+		t.Fatalf("get groups: %v", err)
+	}
+	if filtered := FilterLinkGroupsByTag(groups, "Monitoring"); len(filtered) != 1 || len(filtered[0].Links) != 1 || filtered[0].Links[0].ID != grafana {
+		t.Errorf("filtering by monitoring returned %+v", filtered)
+	}
+	if filtered := FilterLinkGroupsByTag(groups, "unknown"); len(filtered) != 0 {
+		t.Errorf("filtering by an unknown tag returned %+v", filtered)
+	}
+
+	// Replacing the tags removes the old ones, and untagged links have no tags
+	if err := store.SetLinkTags(pager, nil); err != nil {
+		t.Fatalf("clear tags: %v", err)
+	}
+	links, _ = store.GetLinksByGroupID(groupID)
+	if links[1].Tags == nil || len(links[1].Tags) != 0 {
+		t.Errorf("Pager has tags %#v after clearing them", links[1].Tags)
+	}
+
+	// Deleting a link removes its tags
+	if err := store.DeleteLink(grafana); err != nil {
+		t.Fatalf("delete link: %v", err)
+	}
+	if err := store.SetLinkTags(pager, []string{"oncall"}); err != nil {
+		t.Fatalf("set tags after delete: %v", err)
+	}
+	links, _ = store.GetLinksByGroupID(groupID)
+	if len(links) != 1 || strings.Join(links[0].Tags, ",") != "oncall" {
+		t.Errorf("links after delete %+v", links)
+	}
+}
+
+func testLinkDetails(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	groupID, err := store.CreateLinkGroup(owner, "Ops", 1, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	linkID, err := store.CreateLink(groupID, "Grafana", "https://grafana.example.com", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	// New links have no details
+	link, err := store.GetLink(linkID)
+	if err != nil {
+		t.Fatalf("get link: %v", err)
+	}
+	if link.Name != "Grafana" || link.Description != "" || link.Metadata == nil || len(link.Metadata) != 0 {
+		t.Errorf("new link %+v", link)
+	}
+
+	details := LinkDetails{
+		Description: "Dashboards of the production cluster",
+		Owner:       "SRE",
+		Environment: EnvironmentProd,
+		Metadata:    map[string]string{"runbook": "https://wiki.example.com/grafana", "team": "sre"},
+	}
+	if err := store.SetLinkDetails(linkID, details); err != nil {
+		t.Fatalf("set details: %v", err)
+	}
+	links, err := store.GetLinksByGroupID(groupID)
+	if err != nil || len(links) != 1 {
+		t.Fatalf("get links: %+v, %v", links, err)
+	}
+	if !reflect.DeepEqual(links[0].Details(), details) {
+		t.Errorf("details %+v, want %+v", links[0].Details(), details)
+	}
+
+	// Replacing the metadata drops keys that are not given
+	details.Metadata = map[string]string{"team": "platform"}
+	if err := store.SetLinkDetails(linkID, details); err != nil {
+		t.Fatalf("set details: %v", err)
+	}
+	if link, _ := store.GetLink(linkID); !reflect.DeepEqual(link.Metadata, details.Metadata) {
+		t.Errorf("metadata %v, want %v", link.Metadata, details.Metadata)
+	}
+
+	if _, err := store.GetLink(9999); err != sql.ErrNoRows {
+		t.Errorf("get missing link returned %v, want sql.ErrNoRows", err)
+	}
+	if err := store.SetLinkDetails(9999, details); err != sql.ErrNoRows {
+		t.Errorf("set details of missing link returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testLinkIcons(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	groupID, err := store.CreateLinkGroup(owner, "Ops", 1, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	linkID, err := store.CreateLink(groupID, "Grafana", "https://grafana.example.com", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	if _, err := store.GetLinkIcon(linkID); err != sql.ErrNoRows {
+		t.Errorf("icon of a new link returned %v, want sql.ErrNoRows", err)
+	}
+
+	// A fetched icon is kept while the URL stays the same
+	fetched := LinkIcon{ContentType: "image/x-icon", Data: []byte{0, 0, 1, 0}}
+	if err := store.SaveLinkIcon(linkID, fetched); err != nil {
+		t.Fatalf("save icon: %v", err)
+	}
+	icon, err := store.GetLinkIcon(linkID)
+	if err != nil || icon.ContentType != fetched.ContentType || !bytes.Equal(icon.Data, fetched.Data) || icon.Uploaded || icon.UpdatedAt.IsZero() {
+		t.Fatalf("get icon %+v, %v", icon, err)
+	}
+	if err := store.UpdateLink(linkID, groupID, "Dashboards", "https://grafana.example.com", 2); err != nil {
+		t.Fatalf("update link: %v", err)
+	}
+	if _, err := store.GetLinkIcon(linkID); err != nil {
+		t.Errorf("fetched icon dropped although the URL did not change: %v", err)
+	}
+	if err := store.UpdateLink(linkID, groupID, "Dashboards", "https://metrics.example.com", 2); err != nil {
+		t.Fatalf("update link: %v", err)
+	}
+	if _, err := store.GetLinkIcon(linkID); err != sql.ErrNoRows {
+		t.Errorf("fetched icon kept after the URL changed: %v", err)
+	}
+
+	// Uploaded icons stay when the URL changes, but not when an icon URL is set
+	uploaded := LinkIcon{ContentType: "image/png", Data: []byte("\x89PNG"), Uploaded: true}
+	if err := store.SaveLinkIcon(linkID, uploaded); err != nil {
+		t.Fatalf("save icon: %v", err)
+	}
+	if err := store.UpdateLink(linkID, groupID, "Dashboards", "https://grafana.example.com", 2); err != nil {
+		t.Fatalf("update link: %v", err)
+	}
+	link, err := store.GetLink(linkID)
+	if err != nil || !link.IconUploaded || link.Icon != "" {
+		t.Errorf("link with uploaded icon %+v, %v", link, err)
+	}
+	if link.IconVersion() != IconSum(uploaded.Data) {
+		t.Errorf("icon version %q is not the sum of the uploaded icon", link.IconVersion())
+	}
+
+	// Icons stored before they had sums get them on the next start
+	if s, ok := store.(*sqlStore); ok {
+		if _, err := s.exec("UPDATE link_icons SET data_sum = NULL"); err != nil {
+			t.Fatalf("clear icon sums: %v", err)
+		}
+		if _, err := store.Migrate(-1, false); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		if link, _ := store.GetLink(linkID); link.IconVersion() != IconSum(uploaded.Data) {
+			t.Errorf("icon version %q after filling in sums, want the sum of the uploaded icon", link.IconVersion())
+		}
+	}
+	if err := store.SetLinkDetails(linkID, LinkDetails{}); err != nil {
+		t.Fatalf("set details: %v", err)
+	}
+	if _, err := store.GetLinkIcon(linkID); err != nil {
+		t.Errorf("uploaded icon dropped although the icon URL did not change: %v", err)
+	}
+	if err := store.SetLinkDetails(linkID, LinkDetails{Icon: "https://grafana.example.com/logo.png"}); err != nil {
+		t.Fatalf("set details: %v", err)
+	}
+	link, err = store.GetLink(linkID)
+	if err != nil || link.IconUploaded || link.Icon != "https://grafana.example.com/logo.png" {
+		t.Errorf("link after setting an icon URL %+v, %v", link, err)
+	}
+
+	if err := store.DeleteLinkIcon(linkID); err != sql.ErrNoRows {
+		t.Errorf("delete of a missing icon returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testLinkHealth(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	groupID, err := store.CreateLinkGroup(owner, "Ops", 1, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	linkID, err := store.CreateLink(groupID, "Grafana", "https://grafana.example.com", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	urls, err := store.GetLinkURLs()
+	if err != nil || len(urls) != 1 || urls[0] != (LinkURL{ID: linkID, URL: "https://grafana.example.com"}) {
+		t.Fatalf("GetLinkURLs returned %+v, %v", urls, err)
+	}
+	if link, _ := store.GetLink(linkID); link.Health != nil {
+		t.Errorf("unchecked link has health %+v", link.Health)
+	}
+
+	// A later check replaces the earlier one
+	if err := store.SaveLinkHealth(linkID, LinkHealth{StatusCode: 200, LatencyMS: 12}); err != nil {
+		t.Fatalf("save health: %v", err)
+	}
+	if err := store.SaveLinkHealth(linkID, LinkHealth{Error: "connection refused"}); err != nil {
+		t.Fatalf("save health: %v", err)
+	}
+	link, err := store.GetLink(linkID)
+	if err != nil || link.Health == nil || link.Health.StatusCode != 0 || link.Health.Error != "connection refused" ||
+		link.Health.Healthy() || link.Health.CheckedAt.IsZero() {
+		t.Fatalf("link health %+v, %v", link.Health, err)
+	}
+
+	// The check is dropped when the URL changes
+	if err := store.UpdateLink(linkID, groupID, "Dashboards", "https://grafana.example.com", 1); err != nil {
+		t.Fatalf("update link: %v", err)
+	}
+	if link, _ := store.GetLink(linkID); link.Health == nil {
+		t.Errorf("health dropped although the URL did not change")
+	}
+	if err := store.UpdateLink(linkID, groupID, "Dashboards", "https://metrics.example.com", 1); err != nil {
+		t.Fatalf("update link: %v", err)
+	}
+	if link, _ := store.GetLink(linkID); link.Health != nil {
+		t.Errorf("health of the old URL kept %+v", link.Health)
+	}
+
+	// Checks of links deleted in the meantime are skipped
+	if err := store.DeleteLink(linkID); err != nil {
+		t.Fatalf("delete link: %v", err)
+	}
+	if err := store.SaveLinkHealth(linkID, LinkHealth{StatusCode: 200}); err != nil {
+		t.Errorf("save health of a deleted link: %v", err)
+	}
+}
+
+func testLinkClicks(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	visitor := mustCreateUser(t, store, "bob", RoleViewer)
+	groupID, err := store.CreateLinkGroup(owner, "Ops", 1, VisibilityPublic)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	grafana, _ := store.CreateLink(groupID, "Grafana", "https://grafana.example.com", 1)
+	wiki, _ := store.CreateLink(groupID, "Wiki", "https://wiki.example.com", 2)
+
+	start := time.Now().Add(-time.Minute)
+	for _, click := range []struct{ linkID, userID int64 }{{grafana, owner}, {grafana, visitor}, {grafana, 0}, {wiki, owner}} {
+		if err := store.RecordClick(click.linkID, click.userID, "https://intranet.example.com"); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	counts, err := store.CountLinkClicks(start)
+	if err != nil || counts[grafana] != 3 || counts[wiki] != 1 {
+		t.Fatalf("CountLinkClicks returned %v, %v", counts, err)
+	}
+	if counts, _ := store.CountLinkClicks(time.Now().Add(time.Minute)); len(counts) != 0 {
+		t.Errorf("clicks counted before they happened %v", counts)
+	}
+	times, err := store.GetLinkClickTimes(wiki, start)
+	if err != nil || len(times) != 1 || times[0].Before(start) {
+		t.Fatalf("GetLinkClickTimes returned %v, %v", times, err)
+	}
+
+	// Clicks outlive the users who made them, but not their links
+	if err := store.DeleteUser(visitor); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if err := store.DeleteLink(wiki); err != nil {
+		t.Fatalf("delete link: %v", err)
+	}
+	if counts, _ := store.CountLinkClicks(start); counts[grafana] != 3 || counts[wiki] != 0 {
+		t.Errorf("clicks after deletes %v", counts)
+	}
+}
+
+func testLinkAliases(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	groupID, err := store.CreateLinkGroup(owner, "Dev", 1, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	wiki, _ := store.CreateLink(groupID, "Wiki", "https://wiki.example.com", 1)
+	pulls, _ := store.CreateLink(groupID, "Pull requests", "https://git.example.com/pull/{n}", 2)
+	newPull, _ := store.CreateLink(groupID, "New pull request", "https://git.example.com/compare", 3)
+
+	if err := store.SetLinkAlias(wiki, "wiki"); err != nil {
+		t.Fatalf("set alias: %v", err)
+	}
+	if err := store.SetLinkAlias(pulls, "pr/{n}"); err != nil {
+		t.Fatalf("set alias: %v", err)
+	}
+	// A fixed segment does not clash with a parameter, an alias of the same shape does
+	if err := store.SetLinkAlias(newPull, "pr/new"); err != nil {
+		t.Fatalf("set alias next to a parameterized one: %v", err)
+	}
+	if err := store.SetLinkAlias(newPull, "pr/{id}"); err != ErrAliasExists {
+		t.Errorf("alias of the same shape as another returned %v, want ErrAliasExists", err)
+	}
+	if err := store.SetLinkAlias(wiki, "wiki"); err != nil {
+		t.Errorf("keeping the alias of a link: %v", err)
+	}
+
+	links, err := store.GetLinksByGroupID(groupID)
+	if err != nil || links[0].Alias != "wiki" || links[1].Alias != "pr/{n}" {
+		t.Fatalf("links %+v, %v", links, err)
+	}
+	link, parameters, ok := ResolveAlias(links, "PR/123")
+	if !ok || link.ID != pulls || ExpandAliasURL(link.URL, parameters) != "https://git.example.com/pull/123" {
+		t.Errorf("ResolveAlias(pr/123) = %v %v %v", link.ID, parameters, ok)
+	}
+	if link, _, ok := ResolveAlias(links, "pr/new"); !ok || link.ID != newPull {
+		t.Errorf("ResolveAlias(pr/new) = %v, want the fixed alias over the parameter", link.ID)
+	}
+	if _, _, ok := ResolveAlias(links, "pr"); ok {
+		t.Errorf("ResolveAlias(pr) matched without the parameter")
+	}
+	if got := SuggestAliases(links, "wikki", 5); len(got) != 1 || got[0] != "wiki" {
+		t.Errorf("SuggestAliases(wikki) = %v", got)
+	}
+
+	// Removing an alias frees it
+	if err := store.SetLinkAlias(wiki, ""); err != nil {
+		t.Fatalf("remove alias: %v", err)
+	}
+	if err := store.SetLinkAlias(newPull, "wiki"); err != nil {
+		t.Errorf("reuse removed alias: %v", err)
+	}
+
+	// Aliases set before links had shapes get them on the next start
+	if s, ok := store.(*sqlStore); ok {
+		if _, err := s.exec("UPDATE links SET alias_shape = NULL"); err != nil {
+			t.Fatalf("clear alias shapes: %v", err)
+		}
+		if _, err := store.Migrate(-1, false); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		if err := store.SetLinkAlias(wiki, "pr/{number}"); err != ErrAliasExists {
+			t.Errorf("alias of the same shape as a filled in one returned %v, want ErrAliasExists", err)
+		}
+	}
+
+	for alias, want := range map[string]string{
+		" go/Wiki/ ":   "wiki",
+		"pr/{n}":       "pr/{n}",
+		"":             "",
+		"{n}":          "",
+		"pr/{n}/{n}":   "",
+		"pr/{N-1}":     "",
+		"team wiki":    "",
+		"docs/../wiki": "",
+		"v1.2/notes":   "v1.2/notes",
+	} {
+		got, err := NormalizeAlias(alias)
+		if got != want || (want == "" && alias != "" && err == nil) {
+			t.Errorf("NormalizeAlias(%q) = %q, %v, want %q", alias, got, err, want)
+		}
+	}
+}
+
+func testSearch(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	reader := mustCreateUser(t, store, "bob", RoleViewer)
+	other := mustCreateUser(t, store, "carol", RoleEditor)
+	groupID, err := store.CreateLinkGroup(owner, "Ops", 1, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	otherGroupID, err := store.CreateLinkGroup(other, "Private", 1, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	grafana, err := store.CreateLink(groupID, "Grafana", "https://grafana.example.com", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	pager, err := store.CreateLink(groupID, "Pager", "https://pager.example.com/grafana-alerts", 2)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if _, err := store.CreateLink(otherGroupID, "Grafana staging", "https://grafana.staging.example.com", 1); err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if err := store.SetLinkTags(pager, []string{"oncall"}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+
+	search := func(userID int64, query string) []SearchResult {
+		t.Helper()
+		results, err := store.SearchLinks(userID, query, 10)
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		return results
+	}
+
+	// Name matches rank above URL matches, and links of other users are not found
+	results := search(owner, "graf")
+	if len(results) != 2 || results[0].ID != grafana || results[1].ID != pager {
+		t.Fatalf("search for graf returned %+v", results)
+	}
+	if results[0].GroupName != "Ops" || results[0].Rank <= results[1].Rank {
+		t.Errorf("search for graf returned %+v", results)
+	}
+	if strings.Join(results[1].Tags, ",") != "oncall" {
+		t.Errorf("Pager has tags %q in search results", results[1].Tags)
+	}
+
+	// Every term must match, tags included
+	if results := search(owner, "ONCALL, grafana"); len(results) != 1 || results[0].ID != pager {
+		t.Errorf("search for oncall and grafana returned %+v", results)
+	}
+	if results := search(owner, "grafana unknown"); len(results) != 0 {
+		t.Errorf("search with an unknown term returned %+v", results)
+	}
+	if results := search(owner, " !? "); len(results) != 0 {
+		t.Errorf("search without terms returned %+v", results)
+	}
+
+	// Shared groups are searched, and updates are found
+	if _, err := store.ShareGroupWithUser(groupID, reader, PermissionRead); err != nil {
+		t.Fatalf("share group: %v", err)
+	}
+	if err := store.UpdateLink(grafana, groupID, "Dashboards", "https://grafana.example.com", 1); err != nil {
+		t.Fatalf("update link: %v", err)
+	}
+	if results := search(reader, "dashboards"); len(results) != 1 || results[0].ID != grafana {
+		t.Errorf("search for dashboards by the reader returned %+v", results)
+	}
+
+	// Descriptions and other details are searched, below names
+	details := LinkDetails{Description: "Who is on call", Owner: "SRE", Metadata: map[string]string{"team": "platform"}}
+	if err := store.SetLinkDetails(pager, details); err != nil {
+		t.Fatalf("set details: %v", err)
+	}
+	if results := search(owner, "platform sre"); len(results) != 1 || results[0].ID != pager || results[0].Owner != "SRE" {
+		t.Errorf("search for details returned %+v", results)
+	}
+	if _, err := store.CreateLink(groupID, "Call list", "https://calls.example.com", 3); err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if results := search(owner, "call"); len(results) != 2 || results[0].Name != "Call list" || results[1].ID != pager {
+		t.Errorf("search for call returned %+v", results)
+	}
+
+	// Deleted links are not found
+	if err := store.DeleteLink(pager); err != nil {
+		t.Fatalf("delete link: %v", err)
+	}
+	if results := search(owner, "oncall"); len(results) != 0 {
+		t.Errorf("search for a deleted link returned %+v", results)
+	}
+
+	// Links deleted along with their group, its subgroups or their owner leave nothing behind in the index
+	subgroupID, err := store.CreateLinkGroup(owner, "Ops tools", 2, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if err := store.MoveLinkGroup(subgroupID, groupID); err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	if _, err := store.CreateLink(subgroupID, "Runbooks", "https://runbooks.example.com", 1); err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if err := store.DeleteLinkGroup(groupID, owner); err != nil {
+		t.Fatalf("delete group: %v", err)
+	}
+	if results := search(owner, "runbooks"); len(results) != 0 {
+		t.Errorf("search for a link of a deleted subgroup returned %+v", results)
+	}
+	if size, ok := searchIndexSize(t, store); ok && size != 1 {
+		t.Errorf("search index has %d entries after deleting a group, want the link of carol", size)
+	}
+	if err := store.DeleteUser(other); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if size, ok := searchIndexSize(t, store); ok && size != 0 {
+		t.Errorf("search index has %d entries after deleting the last owner", size)
+	}
+}
+
+// searchIndexSize returns the number of entries in the full-text index of SQLite,
+// and false for databases without one
+func searchIndexSize(t *testing.T, store Store) (int, bool) {
+	t.Helper()
+
+	s, ok := store.(*sqlStore)
+	if !ok || !s.dialect.fts5 {
+		return 0, false
+	}
+	var size int
+	if err := s.queryRow("SELECT COUNT(*) FROM link_search").Scan(&size); err != nil {
+		t.Fatalf("count search index entries: %v", err)
+	}
+	return size, true
+}
+
+func TestNormalizeLinkDetails(t *testing.T) {
+	got, err := NormalizeLinkDetails(LinkDetails{
+		Description: " Dashboards ",
+		Owner:       " SRE ",
+		Environment: " Staging ",
+		Metadata:    map[string]string{" team ": " sre "},
+	})
+	want := LinkDetails{Description: "Dashboards", Owner: "SRE", Environment: EnvironmentStaging, Metadata: map[string]string{"team": "sre"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeLinkDetails = %+v, %v, want %+v", got, err, want)
+	}
+	if got, err := NormalizeLinkDetails(LinkDetails{}); err != nil || got.Metadata == nil {
+		t.Errorf("NormalizeLinkDetails of empty details = %#v, %v", got, err)
+	}
+
+	tooManyEntries := make(map[string]string)
+	for i := 0; i <= MaxMetadataEntries; i++ {
+		tooManyEntries[strconv.Itoa(i)] = "x"
+	}
+	for _, tt := range []struct {
+		details LinkDetails
+		wantErr error
+	}{
+		{LinkDetails{Description: strings.Repeat("x", MaxDescriptionLength+1)}, ErrDescriptionTooLong},
+		{LinkDetails{Owner: strings.Repeat("x", MaxOwnerLength+1)}, ErrOwnerTooLong},
+		{LinkDetails{Environment: "qa"}, ErrInvalidEnvironment},
+		{LinkDetails{Metadata: map[string]string{"": "x"}}, ErrInvalidMetadata},
+		{LinkDetails{Metadata: map[string]string{"key": strings.Repeat("x", MaxMetadataValueLength+1)}}, ErrInvalidMetadata},
+		{LinkDetails{Metadata: tooManyEntries}, ErrInvalidMetadata},
+	} {
+		if _, err := NormalizeLinkDetails(tt.details); err != tt.wantErr {
+			t.Errorf("NormalizeLinkDetails(%+v) error %v, want %v", tt.details, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		tags    []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{[]string{" OnCall ", "monitoring", "oncall", ""}, "monitoring,oncall", false},
+		{[]string{"a,b"}, "", true},
+		{[]string{strings.Repeat("x", MaxTagLength+1)}, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeTags(tt.tags)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeTags(%q) error %v, want error %v", tt.tags, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (got == nil || strings.Join(got, ",") != tt.want) {
+			t.Errorf("NormalizeTags(%q) = %#v, want %q", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func testSharing(t *testing.T, store Store) {
+	owner := mustCreateUser(t, store, "alice", RoleEditor)
+	reader := mustCreateUser(t, store, "bob", RoleViewer)
+	member := mustCreateUser(t, store, "carol", RoleEditor)
+
+	groupID, err := store.CreateLinkGroup(owner, "Team", 0, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	teamID, err := store.CreateTeam("devs")
+	if err != nil {
+		t.Fatalf("create team: %v", err)
+	}
+	if _, err := store.CreateTeam("devs"); err != ErrTeamExists {
+		t.Errorf("creating a duplicate team returned %v, want ErrTeamExists", err)
+	}
+	// Adding a member twice is not an error
+	for i := 0; i < 2; i++ {
+		if err := store.AddTeamMember(teamID, member); err != nil {
+			t.Fatalf("add member: %v", err)
+		}
+	}
+	if err := store.AddTeamMember(teamID+100, member); err != sql.ErrNoRows {
+		t.Errorf("adding to a missing team returned %v, want sql.ErrNoRows", err)
+	}
+	teams, err := store.GetAllTeams()
+	if err != nil || len(teams) != 1 || len(teams[0].Members) != 1 || teams[0].Members[0] != "carol" {
+		t.Errorf("GetAllTeams returned %+v, %v", teams, err)
+	}
+
+	if _, err := store.ShareGroupWithUser(groupID, reader, PermissionRead); err != nil {
+		t.Fatalf("share with user: %v", err)
+	}
+	if _, err := store.ShareGroupWithTeam(groupID, teamID, PermissionWrite); err != nil {
+		t.Fatalf("share with team: %v", err)
+	}
+
+	permissions := map[int64]string{owner: PermissionOwner, reader: PermissionRead, member: PermissionWrite}
+	for userID, want := range permissions {
+		if got, err := store.GetLinkGroupPermission(groupID, userID); err != nil || got != want {
+			t.Errorf("permission of user %d is %q, %v, want %q", userID, got, err, want)
+		}
+	}
+
+	// Permissions of several groups at once, where subgroups inherit the share and
+	// missing groups are left out
+	subID, err := store.CreateLinkGroup(owner, "Sub", 0, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create subgroup: %v", err)
+	}
+	if err := store.MoveLinkGroup(subID, groupID); err != nil {
+		t.Fatalf("move subgroup: %v", err)
+	}
+	otherID, err := store.CreateLinkGroup(reader, "Other", 0, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("create other group: %v", err)
+	}
+	batch, err := store.GetLinkGroupPermissions([]int64{groupID, subID, otherID, otherID + 100}, member)
+	if err != nil || len(batch) != 3 || batch[groupID] != PermissionWrite || batch[subID] != PermissionWrite || batch[otherID] != "" {
+		t.Errorf("GetLinkGroupPermissions returned %v, %v", batch, err)
+	}
+
+	// Sharing again replaces the permission
+	shareID, err := store.ShareGroupWithUser(groupID, reader, PermissionWrite)
+	if err != nil {
+		t.Fatalf("reshare: %v", err)
+	}
+	shares, err := store.GetGroupShares(groupID)
+	if err != nil || len(shares) != 2 {
+		t.Fatalf("GetGroupShares returned %+v, %v", shares, err)
+	}
+	if shares[0].ID != shareID || shares[0].Username != "bob" || shares[0].Permission != PermissionWrite || shares[1].TeamName != "devs" {
+		t.Errorf("unexpected shares %+v", shares)
+	}
+
+	groups, err := store.GetAllLinkGroups(member)
+	if err != nil || len(groups) != 1 || !groups[0].Shared || !groups[0].CanEdit {
+		t.Errorf("team member sees %+v, %v", groups, err)
+	}
+
+	if err := store.RemoveTeamMember(teamID, member); err != nil {
+		t.Fatalf("remove member: %v", err)
+	}
+	if got, _ := store.GetLinkGroupPermission(groupID, member); got != "" {
+		t.Errorf("former member still has permission %q", got)
+	}
+	if err := store.DeleteGroupShare(groupID, shareID); err != nil {
+		t.Fatalf("delete share: %v", err)
+	}
+	if err := store.DeleteTeam(teamID); err != nil {
+		t.Fatalf("delete team: %v", err)
+	}
+	if shares, _ := store.GetGroupShares(groupID); len(shares) != 0 {
+		t.Errorf("shares remain: %+v", shares)
+	}
+}
+
+func testSessions(t *testing.T, store Store) {
+	userID := mustCreateUser(t, store, "alice", RoleEditor)
+
+	session, token, err := store.CreateSession(userID, "test", "127.0.0.1", time.Hour)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if !session.Active() {
+		t.Error("new session is not active")
+	}
+
+	rotated, newToken, err := store.RotateRefreshToken(token)
+	if err != nil || rotated.ID != session.ID || newToken == token {
+		t.Fatalf("rotate returned %+v, %v", rotated, err)
+	}
+
+	// Replaying the old token revokes the session
+	if _, _, err := store.RotateRefreshToken(token); err != ErrRefreshTokenReused {
+		t.Errorf("reusing a token returned %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := store.RotateRefreshToken(newToken); err != sql.ErrNoRows {
+		t.Errorf("rotating a revoked session returned %v, want sql.ErrNoRows", err)
+	}
+
+	other, _, err := store.CreateSession(userID, "test", "127.0.0.1", time.Hour)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if _, _, err := store.CreateSession(userID, "test", "127.0.0.1", time.Hour); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	sessions, err := store.GetActiveSessionsByUserID(userID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("GetActiveSessionsByUserID returned %+v, %v", sessions, err)
+	}
+	if revoked, err := store.RevokeUserSessions(userID, other.ID); err != nil || revoked != 1 {
+		t.Errorf("RevokeUserSessions revoked %d, %v", revoked, err)
+	}
+	if err := store.RevokeUserSession(userID, other.ID); err != nil {
+		t.Errorf("revoke session: %v", err)
+	}
+	if err := store.RevokeSession(other.ID); err != sql.ErrNoRows {
+		t.Errorf("revoking twice returned %v, want sql.ErrNoRows", err)
+	}
+
+	if _, _, err := store.CreateSession(userID, "test", "127.0.0.1", -time.Minute); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if err := store.DeleteExpiredSessions(); err != nil {
+		t.Errorf("delete expired sessions: %v", err)
+	}
+}
+
+func testAPITokens(t *testing.T, store Store) {
+	userID := mustCreateUser(t, store, "alice", RoleEditor)
+
+	expires := time.Now().Add(time.Hour)
+	token, plain, err := store.CreateAPIToken(userID, "ci", []string{ScopeRead, ScopeWrite}, &expires)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if token.Expired() || token.ExpiresAt == nil || token.Role(RoleAdmin) != RoleEditor {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	found, err := store.GetAPITokenByToken(plain)
+	if err != nil || found.ID != token.ID || len(found.Scopes) != 2 {
+		t.Fatalf("GetAPITokenByToken returned %+v, %v", found, err)
+	}
+	if err := store.TouchAPIToken(token.ID); err != nil {
+		t.Fatalf("touch token: %v", err)
+	}
+	tokens, err := store.GetAPITokensByUserID(userID)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Errorf("GetAPITokensByUserID returned %+v, %v", tokens, err)
+	}
+
+	if err := store.DeleteAPIToken(token.ID, userID+1); err != sql.ErrNoRows {
+		t.Errorf("deleting another user's token returned %v, want sql.ErrNoRows", err)
+	}
+	if err := store.DeleteAPIToken(token.ID, userID); err != nil {
+		t.Fatalf("delete token: %v", err)
+	}
+	if _, err := store.GetAPITokenByToken(plain); err != sql.ErrNoRows {
+		t.Errorf("deleted token returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testTwoFactor(t *testing.T, store Store) {
+	userID := mustCreateUser(t, store, "alice", RoleAdmin)
+
+	key, err := store.StartTOTPEnrollment(userID, "alice")
+	if err != nil {
+		t.Fatalf("start enrollment: %v", err)
+	}
+	if _, ok, err := store.EnableTOTP(userID, "000000x"); ok || err != nil {
+		t.Errorf("wrong code enabled two-factor auth: %v", err)
+	}
+
+	now := time.Now()
+	code, _ := totp.GenerateCode(key.Secret(), now)
+	codes, ok, err := store.EnableTOTP(userID, code)
+	if err != nil || !ok || len(codes) != RecoveryCodeCount {
+		t.Fatalf("EnableTOTP returned %d codes, %v, %v", len(codes), ok, err)
+	}
+	if _, err := store.StartTOTPEnrollment(userID, "alice"); err != sql.ErrNoRows {
+		t.Errorf("enrolling again returned %v, want sql.ErrNoRows", err)
+	}
+
+	// A code is accepted only once
+	if ok, _ := store.VerifyTwoFactorCode(userID, code); ok {
+		t.Error("replayed code was accepted")
+	}
+	next, _ := totp.GenerateCode(key.Secret(), now.Add(totpPeriod*time.Second))
+	if ok, err := store.VerifyTwoFactorCode(userID, next); !ok || err != nil {
+		t.Errorf("next code rejected: %v", err)
+	}
+
+	// Recovery codes work once each and ignore case and dashes
+	loose := "  " + codes[0][:4] + codes[0][5:]
+	if ok, err := store.VerifyTwoFactorCode(userID, loose); !ok || err != nil {
+		t.Errorf("recovery code rejected: %v", err)
+	}
+	if ok, _ := store.VerifyTwoFactorCode(userID, codes[0]); ok {
+		t.Error("used recovery code was accepted")
+	}
+	if left, err := store.CountRecoveryCodes(userID); err != nil || left != RecoveryCodeCount-1 {
+		t.Errorf("CountRecoveryCodes returned %d, %v", left, err)
+	}
+
+	if err := store.DisableTOTP(userID); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if user, _ := store.GetUserByID(userID); user.TwoFactor {
+		t.Error("two-factor auth still enabled")
+	}
+	if err := store.DisableTOTP(userID + 1); err != sql.ErrNoRows {
+		t.Errorf("disabling for a missing user returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testSettings(t *testing.T, store Store) {
+	if on, err := store.GetBoolSetting(SettingRequireAdminTwoFactor); on || err != nil {
+		t.Errorf("unset setting is %v, %v", on, err)
+	}
+	for _, want := range []bool{true, false} {
+		if err := store.SetBoolSetting(SettingRequireAdminTwoFactor, want); err != nil {
+			t.Fatalf("set setting: %v", err)
+		}
+		if got, err := store.GetBoolSetting(SettingRequireAdminTwoFactor); got != want || err != nil {
+			t.Errorf("setting is %v, %v, want %v", got, err, want)
+		}
+	}
+}
+
+func testTransactions(t *testing.T, store Store) {
+	userID := mustCreateUser(t, store, "alice", RoleEditor)
+
+	// A failing transaction leaves nothing behind
+	err := store.InTx(func(tx Store) error {
+		if _, err := tx.CreateLinkGroup(userID, "Rolled back", 0, VisibilityPrivate); err != nil {
+			return err
+		}
+		_, err := tx.CreateLink(-1, "Orphan", "https://example.com", 0)
+		return err
+	})
+	if err == nil {
+		t.Fatal("link in a missing group was created")
+	}
+	if groups, _ := store.GetAllLinkGroups(userID); len(groups) != 0 {
+		t.Errorf("rolled back group exists: %+v", groups)
+	}
+
+	err = store.InTx(func(tx Store) error {
+		groupID, err := tx.CreateLinkGroup(userID, "Committed", 0, VisibilityPrivate)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateLink(groupID, "Link", "https://example.com", 0)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if groups, _ := store.GetAllLinkGroups(userID); len(groups) != 1 || len(groups[0].Links) != 1 {
+		t.Errorf("committed group missing: %+v", groups)
+	}
+}
+
+func testMigrations(t *testing.T, store Store) {
+	latest, err := store.LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("latest version: %v", err)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != latest {
+		t.Errorf("schema version is %d, %v, want %d", version, err, latest)
+	}
+
+	// A dry run changes nothing
+	steps, err := store.Migrate(0, true)
+	if err != nil || len(steps) != latest {
+		t.Errorf("dry run planned %v, %v", steps, err)
+	}
+	if version, _ := store.SchemaVersion(); version != latest {
+		t.Errorf("dry run changed the schema version to %d", version)
+	}
+
+	// Reverting and reapplying every migration works
+	if _, err := store.Migrate(0, false); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if version, _ := store.SchemaVersion(); version != 0 {
+		t.Errorf("schema version is %d after migrating down", version)
+	}
+	if _, err := store.Migrate(-1, false); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	mustCreateUser(t, store, "alice", RoleViewer)
+
+	if _, err := store.Migrate(latest+1, false); err == nil {
+		t.Error("migrating past the latest version succeeded")
+	}
+}
+
+// newLegacyDatabase creates a SQLite file with a schema from before migrations existed
+// and returns its path
+func newLegacyDatabase(t *testing.T, statements ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "linkdeck.db")
+	db, err := sql.Open(sqliteDialect.driver, path)
+	if err != nil {
+		t.Fatalf("open legacy database: %v", err)
+	}
+	defer db.Close()
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("create legacy database: %v", err)
+		}
+	}
+
+	return path
+}
+
+func TestMigrateLegacySchema(t *testing.T) {
+	path := newLegacyDatabase(t,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL UNIQUE, password TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE link_groups (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, sort_order INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`,
+		"INSERT INTO users (username, password) VALUES ('admin', 'hash'), ('alice', 'hash')",
+		"INSERT INTO link_groups (name) VALUES ('Tools')",
+	)
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Migrate(-1, false); err != nil {
+		t.Fatalf("migrate legacy database: %v", err)
+	}
+	admin, err := store.GetUserByUsername("admin")
+	if err != nil || admin.Role != RoleAdmin {
+		t.Fatalf("admin after the upgrade %+v, %v", admin, err)
+	}
+	if alice, err := store.GetUserByUsername("alice"); err != nil || alice.Role != RoleEditor {
+		t.Errorf("alice after the upgrade %+v, %v", alice, err)
+	}
+	groups, err := store.GetAllLinkGroups(admin.ID)
+	if err != nil || len(groups) != 1 || groups[0].Name != "Tools" {
+		t.Errorf("groups of admin after the upgrade %+v, %v", groups, err)
+	}
+}
+
+func TestMigrateLegacySchemaFailure(t *testing.T) {
+	// Without a link_groups table its columns cannot be added
+	path := newLegacyDatabase(t, "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL UNIQUE, password TEXT NOT NULL)")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	defer store.Close()
+
+	// The error is returned for the caller to handle instead of exiting the process
+	if _, err := store.Migrate(-1, false); err == nil || !strings.Contains(err.Error(), "link_groups") {
+		t.Errorf("migrating a broken legacy database returned %v", err)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("schema version after the failed upgrade %d, %v", version, err)
+	}
+}
+
+func TestMigrationsPerDriver(t *testing.T) {
+	sqlite, err := Migrations(DriverSQLite)
+	if err != nil {
+		t.Fatalf("SQLite migrations: %v", err)
+	}
+	postgres, err := Migrations(DriverPostgres)
+	if err != nil {
+		t.Fatalf("Postgres migrations: %v", err)
+	}
+
+	// Both databases go through the same schema versions
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("%d SQLite migrations but %d Postgres migrations", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].String() != postgres[i].String() {
+			t.Errorf("migration %d is %s for SQLite but %s for Postgres", i+1, sqlite[i], postgres[i])
+		}
+	}
+
+	if _, err := Migrations("mysql"); err == nil {
+		t.Error("unknown driver accepted")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT id FROM users WHERE username = ? AND role = ?"
+
+	sqlite := &sqlStore{dialect: sqliteDialect}
+	if got := sqlite.rebind(query); got != query {
+		t.Errorf("SQLite query rewritten to %q", got)
+	}
+
+	postgres := &sqlStore{dialect: postgresDialect}
+	for query, want := range map[string]string{
+		"SELECT id FROM users WHERE username = ? AND role = ?":                "SELECT id FROM users WHERE username = $1 AND role = $2",
+		"SELECT id FROM links WHERE url = 'https://a.example/?q' OR name = ?": "SELECT id FROM links WHERE url = 'https://a.example/?q' OR name = $1",
+		"SELECT 'it''s ?', ? FROM links":                                      "SELECT 'it''s ?', $1 FROM links",
+		`SELECT "odd?column" FROM links WHERE id = ?`:                         `SELECT "odd?column" FROM links WHERE id = $1`,
+		"SELECT id -- which one?\nFROM links WHERE id = ?":                    "SELECT id -- which one?\nFROM links WHERE id = $1",
+		"SELECT id FROM links WHERE name = 'ü?' AND id = ?":                   "SELECT id FROM links WHERE name = 'ü?' AND id = $1",
+	} {
+		if got := postgres.rebind(query); got != want {
+			t.Errorf("Postgres query of %q is %q, want %q", query, got, want)
+		}
+	}
+}
+
+// recordingConnector is a database/sql connector that records the statements run through it
+// and answers every query with a single row with the ID 42
+type recordingConnector struct {
+	queries []string
+	args    [][]driver.Value
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *recordingConnector) Driver() driver.Driver                        { return nil }
+func (c *recordingConnector) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{c, query}, nil
+}
+func (c *recordingConnector) Close() error              { return nil }
+func (c *recordingConnector) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type recordingStmt struct {
+	connector *recordingConnector
+	query     string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.connector.queries = append(s.connector.queries, s.query)
+	s.connector.args = append(s.connector.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.Exec(args)
+	return &idRows{}, nil
+}
+
+// idRows is a result with a single row with the ID 42
+type idRows struct {
+	done bool
+}
+
+func (r *idRows) Columns() []string { return []string{"id"} }
+func (r *idRows) Close() error      { return nil }
+
+func (r *idRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(42)
+	return nil
+}
+
+func TestInsertWithNumberedParams(t *testing.T) {
+	connector := &recordingConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	store := &sqlStore{db: db, q: db, dialect: postgresDialect}
+
+	// Postgres has no LastInsertId, the ID is read from RETURNING after the placeholders are numbered
+	id, err := store.insert("INSERT INTO links (group_id, name, url) VALUES (?, ?, ?)", 1, "Wiki", "https://wiki.example/?page=1")
+	if err != nil || id != 42 {
+		t.Fatalf("insert returned %d, %v", id, err)
+	}
+	want := []string{"INSERT INTO links (group_id, name, url) VALUES ($1, $2, $3) RETURNING id"}
+	if !reflect.DeepEqual(connector.queries, want) {
+		t.Errorf("queries %q, want %q", connector.queries, want)
+	}
+	if args := []driver.Value{int64(1), "Wiki", "https://wiki.example/?page=1"}; !reflect.DeepEqual(connector.args, [][]driver.Value{args}) {
+		t.Errorf("arguments %v, want %v", connector.args, args)
+	}
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pquerna/otp"
+)
+
+// UserStore stores user accounts, teams and everything users authenticate with
+type UserStore interface {
+	// Users
+	GetUserByUsername(username string) (*User, error)
+	GetUserByID(id int64) (*User, error)
+	GetUserByExternalID(provider, externalID string) (*User, error)
+	GetAllUsers() ([]User, error)
+	CreateUser(username, password, role string) (int64, error)
+	ProvisionExternalUser(provider, externalID, username, role string) (*User, error)
+	SetUserDisabled(id int64, disabled bool) error
+	SetUserRole(id int64, role string) error
+	DeleteUser(id int64) error
+	UpdatePassword(userID int64, newPassword string) error
+
+	// Teams
+	GetAllTeams() ([]Team, error)
+	GetTeamIDByName(name string) (int64, error)
+	CreateTeam(name string) (int64, error)
+	DeleteTeam(id int64) error
+	AddTeamMember(teamID, userID int64) error
+	RemoveTeamMember(teamID, userID int64) error
+
+	// Sessions
+	CreateSession(userID int64, userAgent, ipAddress string, ttl time.Duration) (*Session, string, error)
+	GetSessionByID(id int64) (*Session, error)
+	RotateRefreshToken(token string) (*Session, string, error)
+	GetActiveSessionsByUserID(userID int64) ([]Session, error)
+	RevokeSession(id int64) error
+	RevokeUserSession(userID, sessionID int64) error
+	RevokeUserSessions(userID, exceptID int64) (int64, error)
+	DeleteExpiredSessions() error
+
+	// Personal access tokens
+	CreateAPIToken(userID int64, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error)
+	GetAPITokenByToken(plain string) (*APIToken, error)
+	GetAPITokensByUserID(userID int64) ([]APIToken, error)
+	TouchAPIToken(id int64) error
+	DeleteAPIToken(id, userID int64) error
+
+	// Two-factor authentication
+	StartTOTPEnrollment(userID int64, username string) (*otp.Key, error)
+	EnableTOTP(userID int64, code string) ([]string, bool, error)
+	DisableTOTP(userID int64) error
+	VerifyTwoFactorCode(userID int64, code string) (bool, error)
+	CountRecoveryCodes(userID int64) (int, error)
+}
+
+// LinkStore stores link groups, their links and who they are shared with
+type LinkStore interface {
+	// Link groups and links
+	GetAllLinkGroups(userID int64) ([]LinkGroup, error)
+	GetPublicLinkGroups() ([]LinkGroup, error)
+	GetLinksByGroupID(groupID int64) ([]Link, error)
+	GetLink(id int64) (Link, error)
+	GetLinkGroupIDByLinkID(linkID int64) (int64, error)
+	GetLinkGroupVisibility(groupID int64) (string, error)
+	CreateLinkGroup(userID int64, name string, sortOrder int, visibility string) (int64, error)
+	UpdateLinkGroup(id int64, name string, sortOrder int, visibility string) error
+	MoveLinkGroup(id, parentID int64) error
+	ReorderLinkGroups(ids []int64) error
+	DeleteLinkGroup(id int64, userID int64) error
+	CreateLink(groupID int64, name, url string, sortOrder int) (int64, error)
+	UpdateLink(id int64, groupID int64, name, url string, sortOrder int) error
+	ReorderLinks(groupID int64, ids []int64) error
+	DeleteLink(id int64) error
+	DeleteLinksByGroupID(groupID int64) error
+	SetLinkTags(linkID int64, tags []string) error
+	SetLinkDetails(linkID int64, details LinkDetails) error
+	SetLinkAlias(linkID int64, alias string) error
+	GetLinkIcon(linkID int64) (LinkIcon, error)
+	SaveLinkIcon(linkID int64, icon LinkIcon) error
+	DeleteLinkIcon(linkID int64) error
+	SearchLinks(userID int64, query string, limit int) ([]SearchResult, error)
+	GetLinkURLs() ([]LinkURL, error)
+	SaveLinkHealth(linkID int64, health LinkHealth) error
+	RecordClick(linkID, userID int64, referrer string) error
+	CountLinkClicks(since time.Time) (map[int64]int64, error)
+	GetLinkClickTimes(linkID int64, since time.Time) ([]time.Time, error)
+
+	// Sharing
+	GetLinkGroupPermission(groupID, userID int64) (string, error)
+	GetLinkGroupPermissions(groupIDs []int64, userID int64) (map[int64]string, error)
+	GetGroupShares(groupID int64) ([]GroupShare, error)
+	ShareGroupWithUser(groupID, userID int64, permission string) (int64, error)
+	ShareGroupWithTeam(groupID, teamID int64, permission string) (int64, error)
+	DeleteGroupShare(groupID, shareID int64) error
+}
+
+// Store is the storage of link-deck, implemented for SQLite and PostgreSQL
+type Store interface {
+	UserStore
+	LinkStore
+
+	// Settings
+	GetSetting(key, def string) (string, error)
+	SetSetting(key, value string) error
+	GetBoolSetting(key string) (bool, error)
+	SetBoolSetting(key string, value bool) error
+
+	// Schema
+	SchemaVersion() (int, error)
+	LatestSchemaVersion() (int, error)
+	Migrate(target int, dryRun bool) ([]string, error)
+
+	// InTx runs fn with a store whose changes are committed together if fn succeeds
+	// and rolled back if it returns an error
+	InTx(fn func(tx Store) error) error
+	Close() error
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// MaxTagLength is the longest tag name allowed
+const MaxTagLength = 50
+
+// ErrInvalidTag is returned for tag names that are too long or contain commas
+var ErrInvalidTag = errors.New("tags must be at most 50 characters and cannot contain commas")
+
+// NormalizeTags trims and lowercases tag names, dropping empty and duplicate ones,
+// and returns them sorted
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength || strings.Contains(tag, ",") {
+			return nil, ErrInvalidTag
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+// HasTag reports whether the link is tagged with tag
+func (l Link) HasTag(tag string) bool {
+	for _, t := range l.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilterLinkGroupsByTag returns the groups with only their links tagged with tag,
+// leaving out groups without any such link in them or their subgroups
+func FilterLinkGroupsByTag(groups []LinkGroup, tag string) []LinkGroup {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+
+	filtered := []LinkGroup{}
+	for _, group := range groups {
+		links := []Link{}
+		for _, link := range group.Links {
+			if link.HasTag(tag) {
+				links = append(links, link)
+			}
+		}
+		subgroups := FilterLinkGroupsByTag(group.Subgroups, tag)
+		if len(links) > 0 || len(subgroups) > 0 {
+			group.Links = links
+			group.Subgroups = subgroups
+			filtered = append(filtered, group)
+		}
+	}
+
+	return filtered
+}
+
+// SetLinkTags replaces the tags of a link, creating tags that do not exist yet.
+// The tags must be normalized with NormalizeTags.
+func (s *sqlStore) SetLinkTags(linkID int64, tags []string) error {
+	return s.inTx(func(tx *sqlStore) error {
+		if _, err := tx.exec("DELETE FROM link_tags WHERE link_id = ?", linkID); err != nil {
+			return err
+		}
+
+		for _, tag := range tags {
+			if _, err := tx.exec("INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING", tag); err != nil {
+				return err
+			}
+			_, err := tx.exec(`
+				INSERT INTO link_tags (link_id, tag_id)
+				SELECT ?, id FROM tags WHERE name = ?
+			`, linkID, tag)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Tags no link uses anymore are forgotten
+		if _, err := tx.exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM link_tags)"); err != nil {
+			return err
+		}
+
+		return tx.indexLink(linkID)
+	})
+}
+
+// loadLinkTags fills in the tags of links
+func (s *sqlStore) loadLinkTags(links []Link) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+	}
+	rows, err := s.query(`
+		SELECT lt.link_id, t.name
+		FROM link_tags lt
+		JOIN tags t ON t.id = lt.tag_id
+		WHERE lt.link_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY t.name ASC
+	`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tagsByLink := make(map[int64][]string)
+	for rows.Next() {
+		var (
+			linkID int64
+			name   string
+		)
+		if err := rows.Scan(&linkID, &name); err != nil {
+			return err
+		}
+		tagsByLink[linkID] = append(tagsByLink[linkID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Initialize as empty slice instead of nil
+	for i := range links {
+		links[i].Tags = tagsByLink[links[i].ID]
+		if links[i].Tags == nil {
+			links[i].Tags = []string{}
+		}
+	}
+
+	return nil
+}
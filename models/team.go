@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTeamExists is returned when creating a team whose name is already taken
+var ErrTeamExists = errors.New("team already exists")
+
+// Team represents a named set of users that link groups can be shared with
+type Team struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Members   []string  `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetAllTeams retrieves all teams with the usernames of their members
+func (s *sqlStore) GetAllTeams() ([]Team, error) {
+	rows, err := s.query(`
+		SELECT id, name, created_at, updated_at
+		FROM teams
+		ORDER BY name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	teams := []Team{}
+
+	for rows.Next() {
+		var team Team
+		err := rows.Scan(
+			&team.ID,
+			&team.Name,
+			&team.CreatedAt,
+			&team.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		teams = append(teams, team)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Get members for each team
+	for i := range teams {
+		members, err := s.getTeamMembers(teams[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		teams[i].Members = members
+	}
+
+	return teams, nil
+}
+
+// getTeamMembers retrieves the usernames of a team's members
+func (s *sqlStore) getTeamMembers(teamID int64) ([]string, error) {
+	rows, err := s.query(`
+		SELECT u.username
+		FROM team_members tm
+		JOIN users u ON u.id = tm.user_id
+		WHERE tm.team_id = ?
+		ORDER BY u.username ASC
+	`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize as empty slice instead of nil
+	members := []string{}
+
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		members = append(members, username)
+	}
+
+	return members, rows.Err()
+}
+
+// GetTeamIDByName returns the ID of the team with the given name
+func (s *sqlStore) GetTeamIDByName(name string) (int64, error) {
+	var id int64
+	err := s.queryRow("SELECT id FROM teams WHERE name = ?", name).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// CreateTeam creates a new team
+func (s *sqlStore) CreateTeam(name string) (int64, error) {
+	// Check if the name is already taken
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM teams WHERE name = ?", name).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, ErrTeamExists
+	}
+
+	return s.insert("INSERT INTO teams (name) VALUES (?)", name)
+}
+
+// DeleteTeam deletes a team together with its memberships and group shares
+func (s *sqlStore) DeleteTeam(id int64) error {
+	result, err := s.exec("DELETE FROM teams WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// AddTeamMember adds a user to a team
+func (s *sqlStore) AddTeamMember(teamID, userID int64) error {
+	// Check if the team exists
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM teams WHERE id = ?", teamID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = s.exec(`
+		INSERT INTO team_members (team_id, user_id)
+		VALUES (?, ?)
+		ON CONFLICT DO NOTHING
+	`, teamID, userID)
+
+	return err
+}
+
+// RemoveTeamMember removes a user from a team
+func (s *sqlStore) RemoveTeamMember(teamID, userID int64) error {
+	result, err := s.exec("DELETE FROM team_members WHERE team_id = ? AND user_id = ?", teamID, userID)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
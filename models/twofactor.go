@@ -0,0 +1,228 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// TOTPIssuer is the issuer shown next to the account in authenticator apps
+const TOTPIssuer = "Link Deck"
+
+// RecoveryCodeCount is the number of recovery codes generated when two-factor auth is enabled
+const RecoveryCodeCount = 10
+
+// totpPeriod is the lifetime of a TOTP code in seconds
+const totpPeriod = 30
+
+// StartTOTPEnrollment generates a new TOTP secret for a user, which only takes effect
+// once a code for it is confirmed with EnableTOTP
+func (s *sqlStore) StartTOTPEnrollment(userID int64, username string) (*otp.Key, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      TOTPIssuer,
+		AccountName: username,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Enabled two-factor auth has to be disabled before enrolling again
+	result, err := s.exec(`
+		UPDATE users SET totp_secret = ?, totp_last_counter = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND totp_enabled = FALSE
+	`, key.Secret(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRowsAffected(result); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// EnableTOTP turns on two-factor auth for a user whose pending secret accepts the code.
+// It returns the plain recovery codes, or false if the code is wrong.
+func (s *sqlStore) EnableTOTP(userID int64, code string) ([]string, bool, error) {
+	ok, err := s.checkTOTPCode(userID, code, false)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	var codes []string
+	err = s.inTx(func(tx *sqlStore) error {
+		_, err := tx.exec("UPDATE users SET totp_enabled = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = ?", userID)
+		if err != nil {
+			return err
+		}
+
+		codes, err = tx.replaceRecoveryCodes(userID)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return codes, true, nil
+}
+
+// DisableTOTP turns off two-factor auth for a user and removes their recovery codes
+func (s *sqlStore) DisableTOTP(userID int64) error {
+	return s.inTx(func(tx *sqlStore) error {
+		result, err := tx.exec(`
+			UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_counter = 0, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, userID)
+		if err != nil {
+			return err
+		}
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+
+		_, err = tx.exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+		return err
+	})
+}
+
+// VerifyTwoFactorCode checks a TOTP code or an unused recovery code of a user with two-factor auth enabled.
+// A recovery code is used up by a successful check.
+func (s *sqlStore) VerifyTwoFactorCode(userID int64, code string) (bool, error) {
+	ok, err := s.checkTOTPCode(userID, code, true)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	return s.useRecoveryCode(userID, code)
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func (s *sqlStore) CountRecoveryCodes(userID int64) (int, error) {
+	var count int
+	err := s.queryRow(
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID,
+	).Scan(&count)
+
+	return count, err
+}
+
+// checkTOTPCode checks a code against the TOTP secret of a user, allowing one period of clock drift.
+// Each code is accepted only once, so a code seen by someone else cannot be replayed.
+func (s *sqlStore) checkTOTPCode(userID int64, code string, enabled bool) (bool, error) {
+	var (
+		secret      sql.NullString
+		lastCounter int64
+	)
+	err := s.queryRow(
+		"SELECT totp_secret, totp_last_counter FROM users WHERE id = ? AND totp_enabled = ?", userID, enabled,
+	).Scan(&secret, &lastCounter)
+	if err == sql.ErrNoRows || (err == nil && !secret.Valid) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	now := time.Now()
+	for _, offset := range []int64{-1, 0, 1} {
+		t := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		counter := t.Unix() / totpPeriod
+		if counter <= lastCounter {
+			continue
+		}
+
+		expected, err := totp.GenerateCode(secret.String, t)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		// Only the first request using the code wins
+		result, err := s.exec(
+			"UPDATE users SET totp_last_counter = ? WHERE id = ? AND totp_last_counter = ?",
+			counter, userID, lastCounter,
+		)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+
+		return affected == 1, nil
+	}
+
+	return false, nil
+}
+
+// useRecoveryCode marks an unused recovery code of a user as used, reporting whether there was one
+func (s *sqlStore) useRecoveryCode(userID int64, code string) (bool, error) {
+	result, err := s.exec(`
+		UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, time.Now().UTC(), userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// replaceRecoveryCodes replaces the recovery codes of a user with new ones and returns them
+func (s *sqlStore) replaceRecoveryCodes(userID int64) ([]string, error) {
+	if _, err := s.exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = s.exec(
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, hashToken(normalizeRecoveryCode(code)),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCode returns a random recovery code formatted as xxxx-xxxx-xxxx-xxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
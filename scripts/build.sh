@@ -32,16 +32,16 @@ cd "$ROOT_DIR"
 # Detect operating system
 if [[ "$OSTYPE" == "linux-gnu"* ]]; then
     echo "Building for Linux..."
-    GOOS=linux GOARCH=amd64 go build -o "$BIN_DIR/link-deck" .
+    GOOS=linux GOARCH=amd64 go build -tags sqlite_fts5 -o "$BIN_DIR/link-deck" .
 elif [[ "$OSTYPE" == "darwin"* ]]; then
     echo "Building for macOS..."
-    GOOS=darwin GOARCH=amd64 go build -o "$BIN_DIR/link-deck" .
+    GOOS=darwin GOARCH=amd64 go build -tags sqlite_fts5 -o "$BIN_DIR/link-deck" .
 elif [[ "$OSTYPE" == "msys"* || "$OSTYPE" == "win32" ]]; then
     echo "Building for Windows..."
-    GOOS=windows GOARCH=amd64 go build -o "$BIN_DIR/link-deck.exe" .
+    GOOS=windows GOARCH=amd64 go build -tags sqlite_fts5 -o "$BIN_DIR/link-deck.exe" .
 else
     echo "Unknown OS type: $OSTYPE. Building for current OS..."
-    go build -o "$BIN_DIR/link-deck" .
+    go build -tags sqlite_fts5 -o "$BIN_DIR/link-deck" .
 fi
 
 echo "Build complete!"
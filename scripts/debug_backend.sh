@@ -20,4 +20,4 @@ fi
 
 # Run with delve
 cd "$ROOT_DIR"
-dlv debug . -- -dev 
\ No newline at end of file
+dlv debug --build-flags="-tags sqlite_fts5" . -- -dev 
\ No newline at end of file
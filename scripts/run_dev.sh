@@ -31,7 +31,7 @@ echo "Starting development environment..."
 if [ "$1" = "backend" ]; then
   echo "Starting only backend..."
   cd "$ROOT_DIR"
-  go run . -dev
+  go run -tags sqlite_fts5 . -dev
   exit 0
 elif [ "$1" = "frontend" ]; then
   echo "Starting only frontend..."
@@ -43,7 +43,7 @@ fi
 # Start backend in background
 echo "Starting Go backend..."
 cd "$ROOT_DIR"
-go run . -dev &
+go run -tags sqlite_fts5 . -dev &
 BACKEND_PID=$!
 
 # Wait for backend to start
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/yongliucc/link-deck/auth"
+	"github.com/yongliucc/link-deck/health"
+	"github.com/yongliucc/link-deck/icons"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Config is the configuration of a server, read from a JSON file
+type Config struct {
+	Server struct {
+		Port int `json:"port"`
+		// TrustedProxies lists the proxies allowed to set X-Forwarded-For, an empty list trusts none
+		TrustedProxies []string `json:"trusted_proxies"`
+		Public         struct {
+			// Enabled serves link groups marked public without login
+			Enabled bool `json:"enabled"`
+		} `json:"public"`
+		CORS struct {
+			AllowedOrigins []string `json:"allowed_origins"`
+			AllowedMethods []string `json:"allowed_methods"`
+			AllowedHeaders []string `json:"allowed_headers"`
+		} `json:"cors"`
+	} `json:"server"`
+	Database struct {
+		// Driver is "sqlite" (the default) or "postgres"
+		Driver string `json:"driver"`
+		// DSN is the Postgres connection string, or the SQLite file path
+		DSN string `json:"dsn"`
+		// Path is the SQLite file path, used when no DSN is set
+		Path string `json:"path"`
+	} `json:"database"`
+	Auth struct {
+		JWTSecret string `json:"jwt_secret"`
+		// DisablePasswordLogin turns off login with passwords stored in link-deck, e.g. when only SSO is used
+		DisablePasswordLogin bool            `json:"disable_password_login"`
+		OIDC                 auth.OIDCConfig `json:"oidc"`
+		LDAP                 auth.LDAPConfig `json:"ldap"`
+		// Throttle slows down and temporarily locks out repeated failed logins
+		Throttle auth.ThrottleConfig `json:"throttle"`
+	} `json:"auth"`
+	// Icons configures fetching the favicons of links
+	Icons icons.Config `json:"icons"`
+	// Health configures checking in the background whether links respond
+	Health health.Config `json:"health"`
+}
+
+// DefaultConfig returns the configuration used for everything a config file leaves out
+func DefaultConfig() *Config {
+	var config Config
+
+	// Default values
+	config.Server.Port = 8080
+	config.Server.CORS.AllowedOrigins = []string{"*"}
+	config.Server.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.Server.CORS.AllowedHeaders = []string{"Content-Type", "Authorization"}
+	config.Database.Driver = models.DriverSQLite
+	config.Auth.Throttle = auth.DefaultThrottleConfig()
+	config.Icons = icons.DefaultConfig()
+	config.Health = health.DefaultConfig()
+
+	return &config
+}
+
+// LoadConfig reads the config file at configPath over the defaults. The JWT_SECRET
+// and DB_PATH environment variables fill in a secret and database path the file leaves out.
+func LoadConfig(configPath string) (*Config, error) {
+	config := DefaultConfig()
+
+	// If config path is provided, load from file
+	if configPath != "" {
+		file, err := os.Open(configPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		decoder := json.NewDecoder(file)
+		if err := decoder.Decode(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Auth.JWTSecret == "" {
+		config.Auth.JWTSecret = os.Getenv("JWT_SECRET")
+	}
+	if config.Database.Path == "" {
+		config.Database.Path = os.Getenv("DB_PATH")
+	}
+
+	return config, nil
+}
+
+// DatabaseDSN returns the DSN to open the store with. For SQLite that is the
+// database path, which defaults to models.DefaultSQLitePath.
+func (c *Config) DatabaseDSN() string {
+	if c.Database.DSN != "" || c.Database.Driver == models.DriverPostgres {
+		return c.Database.DSN
+	}
+	if c.Database.Path != "" {
+		return c.Database.Path
+	}
+
+	return models.DefaultSQLitePath
+}
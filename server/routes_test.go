@@ -0,0 +1,1619 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/yongliucc/link-deck/handlers"
+	"github.com/yongliucc/link-deck/health"
+	"github.com/yongliucc/link-deck/icons"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// routeFixture is a server with a few users, link groups and shares to run route tests against
+type routeFixture struct {
+	srv   *Server
+	store models.Store
+	// tokens maps admin, editor and viewer to their access tokens,
+	// apitoken to a write token of the editor and bad to a token nobody signed
+	tokens map[string]string
+	// ids replaces placeholders like {group} in paths and bodies
+	ids *strings.Replacer
+}
+
+// newRouteFixture returns a fresh fixture in a temporary SQLite file:
+//   - editor owns {group} with {link} tagged oncall and with an uploaded icon, shared with viewer as {share}
+//   - other owns the private {otherGroup} with {otherLink}, which has the alias other
+//   - {linkIcon} and {otherLinkIcon} are the signed query strings of the icon URLs of the links,
+//     {staleLinkIcon} of an earlier icon of {link} and {missingIcon} of {missing}
+//   - {linkClick} is the signed query string of the redirect URL of {link} for editor,
+//     {viewerLinkClickOfEditor} the same with the user changed to viewer, {expiredLinkClick}
+//     one that expired, {publicLinkClick} one for visitors and {missingClick} one of {missing}
+//   - editor is a member of team ops ({team}), has session {session} and API token {token}
+func newRouteFixture(t *testing.T) *routeFixture {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.Server.Public.Enabled = true
+	// The links point at example.com, which the tests must not fetch icons from
+	config.Icons.DisableFetch = true
+	srv, store := newSQLiteTestServer(t, config)
+
+	admin, err := store.GetUserByUsername("admin")
+	if err != nil {
+		t.Fatalf("get admin: %v", err)
+	}
+	editorID := mustCreateUser(t, store, "editor", models.RoleEditor)
+	viewerID := mustCreateUser(t, store, "viewer", models.RoleViewer)
+	otherID := mustCreateUser(t, store, "other", models.RoleEditor)
+
+	groupID := mustID(t)(store.CreateLinkGroup(editorID, "Editor group", 1, models.VisibilityPrivate))
+	linkID := mustID(t)(store.CreateLink(groupID, "Example", "https://example.com", 1))
+	if err := store.SetLinkTags(linkID, []string{"oncall"}); err != nil {
+		t.Fatalf("set link tags: %v", err)
+	}
+	if err := store.SaveLinkIcon(linkID, models.LinkIcon{ContentType: "image/png", Data: pngIcon, Uploaded: true}); err != nil {
+		t.Fatalf("save link icon: %v", err)
+	}
+	subgroupID := mustID(t)(store.CreateLinkGroup(editorID, "Editor subgroup", 1, models.VisibilityPrivate))
+	if err := store.MoveLinkGroup(subgroupID, groupID); err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	shareID := mustID(t)(store.ShareGroupWithUser(groupID, viewerID, models.PermissionRead))
+	otherGroupID := mustID(t)(store.CreateLinkGroup(otherID, "Other group", 1, models.VisibilityPrivate))
+	otherLinkID := mustID(t)(store.CreateLink(otherGroupID, "Other", "https://example.org", 1))
+	if err := store.SetLinkAlias(otherLinkID, "other"); err != nil {
+		t.Fatalf("set link alias: %v", err)
+	}
+	teamID := mustID(t)(store.CreateTeam("ops"))
+	if err := store.AddTeamMember(teamID, editorID); err != nil {
+		t.Fatalf("add team member: %v", err)
+	}
+	apiToken, plainAPIToken, err := store.CreateAPIToken(editorID, "script", []string{models.ScopeWrite}, nil)
+	if err != nil {
+		t.Fatalf("create API token: %v", err)
+	}
+
+	f := &routeFixture{srv: srv, store: store, tokens: map[string]string{
+		"apitoken": plainAPIToken,
+		"bad":      "not-a-token",
+	}}
+	var editor handlers.LoginResponse
+	for _, user := range []struct{ name, password string }{{"admin", "admin"}, {"editor", "password"}, {"viewer", "password"}} {
+		var resp handlers.LoginResponse
+		body := map[string]string{"username": user.name, "password": user.password}
+		if code := doJSON(t, srv, http.MethodPost, "/api/login", "", body, &resp); code != http.StatusOK {
+			t.Fatalf("login as %s returned %d", user.name, code)
+		}
+		f.tokens[user.name] = resp.Token
+		if user.name == "editor" {
+			editor = resp
+		}
+	}
+
+	sessions, err := store.GetActiveSessionsByUserID(editorID)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("get editor sessions: %v %v", sessions, err)
+	}
+
+	id := func(id int64) string { return strconv.FormatInt(id, 10) }
+	// iconQuery signs the icon URL of a link at the given version
+	iconQuery := func(linkID int64, version string) string {
+		return fmt.Sprintf("v=%s&sig=%s", version, srv.handler.Auth.Sign(fmt.Sprintf("icon:%d:%s", linkID, version)))
+	}
+	// clickQuery signs the redirect URL of a link for a user, expiring at the given time
+	clickQuery := func(linkID, userID int64, expires time.Time) string {
+		return fmt.Sprintf("u=%d&e=%d&sig=%s", userID, expires.Unix(),
+			srv.handler.Auth.Sign(fmt.Sprintf("click:%d:%d:%d", linkID, userID, expires.Unix())))
+	}
+	// iconVersion returns the version of the icon URL of a link
+	iconVersion := func(linkID int64) string {
+		link, err := store.GetLink(linkID)
+		if err != nil {
+			t.Fatalf("get link: %v", err)
+		}
+		return link.IconVersion()
+	}
+	f.ids = strings.NewReplacer(
+		"{admin}", id(admin.ID),
+		"{editor}", id(editorID),
+		"{viewer}", id(viewerID),
+		"{group}", id(groupID),
+		"{subgroup}", id(subgroupID),
+		"{link}", id(linkID),
+		"{share}", id(shareID),
+		"{otherGroup}", id(otherGroupID),
+		"{otherLink}", id(otherLinkID),
+		"{team}", id(teamID),
+		"{session}", id(sessions[0].ID),
+		"{token}", id(apiToken.ID),
+		"{refresh}", editor.RefreshToken,
+		"{missing}", "9999",
+		"{linkIcon}", iconQuery(linkID, iconVersion(linkID)),
+		"{otherLinkIcon}", iconQuery(otherLinkID, iconVersion(otherLinkID)),
+		"{staleLinkIcon}", iconQuery(linkID, models.IconSum([]byte("earlier icon"))),
+		"{missingIcon}", iconQuery(9999, ""),
+		"{linkClick}", clickQuery(linkID, editorID, time.Now().Add(time.Hour)),
+		"{viewerLinkClickOfEditor}", strings.Replace(clickQuery(linkID, editorID, time.Now().Add(time.Hour)), "u="+id(editorID), "u="+id(viewerID), 1),
+		"{expiredLinkClick}", clickQuery(linkID, editorID, time.Now().Add(-time.Second)),
+		"{publicLinkClick}", clickQuery(linkID, 0, time.Now().Add(time.Hour)),
+		"{missingClick}", clickQuery(9999, editorID, time.Now().Add(time.Hour)),
+	)
+
+	return f
+}
+
+// pngIcon is the start of a PNG file, enough to be recognized as one
+var pngIcon = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// mustCreateUser creates a user with the password "password" and returns its ID
+func mustCreateUser(t *testing.T, store models.Store, username, role string) int64 {
+	t.Helper()
+
+	id, err := store.CreateUser(username, "password", role)
+	if err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+
+	return id
+}
+
+// mustID returns a function failing the test on error and otherwise returning the created ID
+func mustID(t *testing.T) func(int64, error) int64 {
+	return func(id int64, err error) int64 {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("create fixture: %v", err)
+		}
+		return id
+	}
+}
+
+// do sends a request with a raw body as the user named by as and returns the response
+func (f *routeFixture) do(method, path, as, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, f.ids.Replace(path), strings.NewReader(f.ids.Replace(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if as != "" {
+		req.Header.Set("Authorization", "Bearer "+f.tokens[as])
+	}
+
+	rec := httptest.NewRecorder()
+	f.srv.ServeHTTP(rec, req)
+	return rec
+}
+
+// routeCase is one request against a route and the status it must get
+type routeCase struct {
+	name     string
+	path     string
+	as       string // user from routeFixture.tokens, empty for no token
+	body     string
+	wantCode int
+}
+
+// routeTests lists the cases of every route by method and registered path
+var routeTests = []struct {
+	route string
+	cases []routeCase
+}{
+	{"GET /api/auth/methods", []routeCase{
+		{"anonymous", "/api/auth/methods", "", "", http.StatusOK},
+	}},
+	{"POST /api/login", []routeCase{
+		{"valid credentials", "/api/login", "", `{"username":"editor","password":"password"}`, http.StatusOK},
+		{"wrong password", "/api/login", "", `{"username":"editor","password":"wrong"}`, http.StatusUnauthorized},
+		{"unknown user", "/api/login", "", `{"username":"nobody","password":"password"}`, http.StatusUnauthorized},
+		{"missing password", "/api/login", "", `{"username":"editor"}`, http.StatusBadRequest},
+		{"invalid JSON", "/api/login", "", `{`, http.StatusBadRequest},
+	}},
+	{"POST /api/login/2fa", []routeCase{
+		{"invalid challenge", "/api/login/2fa", "", `{"challenge_token":"bad","code":"123456"}`, http.StatusUnauthorized},
+		{"missing code", "/api/login/2fa", "", `{"challenge_token":"bad"}`, http.StatusBadRequest},
+	}},
+	{"POST /api/refresh", []routeCase{
+		{"valid refresh token", "/api/refresh", "", `{"refresh_token":"{refresh}"}`, http.StatusOK},
+		{"unknown refresh token", "/api/refresh", "", `{"refresh_token":"unknown"}`, http.StatusUnauthorized},
+		{"missing refresh token", "/api/refresh", "", `{}`, http.StatusBadRequest},
+	}},
+	{"GET /api/public/links", []routeCase{
+		{"anonymous", "/api/public/links", "", "", http.StatusOK},
+	}},
+	{"POST /api/logout", []routeCase{
+		{"editor", "/api/logout", "editor", "", http.StatusOK},
+		{"no token", "/api/logout", "", "", http.StatusUnauthorized},
+		{"bad token", "/api/logout", "bad", "", http.StatusUnauthorized},
+	}},
+	{"GET /api/links", []routeCase{
+		{"viewer", "/api/links", "viewer", "", http.StatusOK},
+		{"by tag", "/api/links?tag=oncall", "viewer", "", http.StatusOK},
+		{"API token", "/api/links", "apitoken", "", http.StatusOK},
+		{"no token", "/api/links", "", "", http.StatusUnauthorized},
+		{"bad token", "/api/links", "bad", "", http.StatusUnauthorized},
+	}},
+	{"GET /api/search", []routeCase{
+		{"viewer", "/api/search?q=example", "viewer", "", http.StatusOK},
+		{"API token", "/api/search?q=example&limit=5", "apitoken", "", http.StatusOK},
+		{"missing query", "/api/search", "viewer", "", http.StatusBadRequest},
+		{"bad limit", "/api/search?q=example&limit=0", "viewer", "", http.StatusBadRequest},
+		{"no token", "/api/search?q=example", "", "", http.StatusUnauthorized},
+	}},
+	{"GET /api/go/*alias", []routeCase{
+		{"alias of another user's link", "/api/go/other", "editor", "", http.StatusNotFound},
+		{"missing alias", "/api/go/", "viewer", "", http.StatusBadRequest},
+		{"no token", "/api/go/other", "", "", http.StatusUnauthorized},
+	}},
+	{"GET /api/icons/:id", []routeCase{
+		{"uploaded", "/api/icons/{link}?{linkIcon}", "", "", http.StatusOK},
+		{"not fetched", "/api/icons/{otherLink}?{otherLinkIcon}", "", "", http.StatusNotFound},
+		{"bad signature", "/api/icons/{link}?v=1&sig=bad", "", "", http.StatusNotFound},
+		{"no version", "/api/icons/{link}?sig=bad", "", "", http.StatusNotFound},
+		{"signature of another link", "/api/icons/{otherLink}?{linkIcon}", "", "", http.StatusNotFound},
+		{"earlier icon of the link", "/api/icons/{link}?{staleLinkIcon}", "", "", http.StatusNotFound},
+		{"invalid ID", "/api/icons/abc", "", "", http.StatusBadRequest},
+		{"missing link", "/api/icons/{missing}?{missingIcon}", "", "", http.StatusNotFound},
+	}},
+	{"GET /r/:linkId", []routeCase{
+		{"signed", "/r/{link}?{linkClick}", "", "", http.StatusFound},
+		{"signed for another user", "/r/{link}?{viewerLinkClickOfEditor}", "", "", http.StatusNotFound},
+		{"bad signature", "/r/{link}?u={editor}&e=9999999999&sig=bad", "", "", http.StatusNotFound},
+		{"no expiry", "/r/{link}?u={editor}&sig=bad", "", "", http.StatusNotFound},
+		{"expired", "/r/{link}?{expiredLinkClick}", "", "", http.StatusNotFound},
+		{"visitor of a private group", "/r/{link}?{publicLinkClick}", "", "", http.StatusNotFound},
+		{"invalid ID", "/r/abc", "", "", http.StatusBadRequest},
+		{"missing link", "/r/{missing}?{missingClick}", "", "", http.StatusNotFound},
+	}},
+	{"POST /api/admin/change-password", []routeCase{
+		{"editor", "/api/admin/change-password", "editor", `{"old_password":"password","new_password":"secret"}`, http.StatusOK},
+		{"wrong old password", "/api/admin/change-password", "editor", `{"old_password":"wrong","new_password":"secret"}`, http.StatusUnauthorized},
+		{"missing new password", "/api/admin/change-password", "editor", `{"old_password":"password"}`, http.StatusBadRequest},
+		{"API token", "/api/admin/change-password", "apitoken", `{"old_password":"password","new_password":"secret"}`, http.StatusForbidden},
+		{"no token", "/api/admin/change-password", "", `{"old_password":"password","new_password":"secret"}`, http.StatusUnauthorized},
+	}},
+	{"GET /api/admin/tokens", []routeCase{
+		{"editor", "/api/admin/tokens", "editor", "", http.StatusOK},
+		{"API token", "/api/admin/tokens", "apitoken", "", http.StatusForbidden},
+		{"no token", "/api/admin/tokens", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/tokens", []routeCase{
+		{"editor", "/api/admin/tokens", "editor", `{"name":"ci","scopes":["read","write"]}`, http.StatusCreated},
+		{"missing name", "/api/admin/tokens", "editor", `{}`, http.StatusBadRequest},
+		{"unknown scope", "/api/admin/tokens", "editor", `{"name":"ci","scopes":["everything"]}`, http.StatusBadRequest},
+		{"scope above role", "/api/admin/tokens", "editor", `{"name":"ci","scopes":["admin"]}`, http.StatusBadRequest},
+		{"expired", "/api/admin/tokens", "editor", `{"name":"ci","expires_at":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"API token", "/api/admin/tokens", "apitoken", `{"name":"ci"}`, http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/tokens/:tokenId", []routeCase{
+		{"own token", "/api/admin/tokens/{token}", "editor", "", http.StatusOK},
+		{"token of another user", "/api/admin/tokens/{token}", "admin", "", http.StatusNotFound},
+		{"missing token", "/api/admin/tokens/{missing}", "editor", "", http.StatusNotFound},
+		{"invalid ID", "/api/admin/tokens/abc", "editor", "", http.StatusBadRequest},
+		{"no token", "/api/admin/tokens/{token}", "", "", http.StatusUnauthorized},
+	}},
+	{"GET /api/admin/2fa", []routeCase{
+		{"viewer", "/api/admin/2fa", "viewer", "", http.StatusOK},
+		{"admin", "/api/admin/2fa", "admin", "", http.StatusOK},
+		{"API token", "/api/admin/2fa", "apitoken", "", http.StatusForbidden},
+		{"no token", "/api/admin/2fa", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/2fa/enroll", []routeCase{
+		{"editor", "/api/admin/2fa/enroll", "editor", "", http.StatusOK},
+		{"no token", "/api/admin/2fa/enroll", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/2fa/activate", []routeCase{
+		{"no enrollment", "/api/admin/2fa/activate", "editor", `{"code":"123456"}`, http.StatusBadRequest},
+		{"missing code", "/api/admin/2fa/activate", "editor", `{}`, http.StatusBadRequest},
+		{"no token", "/api/admin/2fa/activate", "", `{"code":"123456"}`, http.StatusUnauthorized},
+	}},
+	{"DELETE /api/admin/2fa", []routeCase{
+		{"not enabled", "/api/admin/2fa", "editor", `{"code":"123456"}`, http.StatusBadRequest},
+		{"missing code", "/api/admin/2fa", "editor", `{}`, http.StatusBadRequest},
+		{"no token", "/api/admin/2fa", "", `{"code":"123456"}`, http.StatusUnauthorized},
+	}},
+	{"GET /api/admin/link-groups", []routeCase{
+		{"editor", "/api/admin/link-groups", "editor", "", http.StatusOK},
+		{"viewer", "/api/admin/link-groups", "viewer", "", http.StatusForbidden},
+		{"no token", "/api/admin/link-groups", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/link-groups", []routeCase{
+		{"editor", "/api/admin/link-groups", "editor", `{"name":"New"}`, http.StatusCreated},
+		{"public", "/api/admin/link-groups", "editor", `{"name":"New","visibility":"public"}`, http.StatusCreated},
+		{"API token", "/api/admin/link-groups", "apitoken", `{"name":"New"}`, http.StatusCreated},
+		{"missing name", "/api/admin/link-groups", "editor", `{}`, http.StatusBadRequest},
+		{"invalid visibility", "/api/admin/link-groups", "editor", `{"name":"New","visibility":"secret"}`, http.StatusBadRequest},
+		{"subgroup", "/api/admin/link-groups", "editor", `{"name":"New","parent_id":{group}}`, http.StatusCreated},
+		{"missing parent", "/api/admin/link-groups", "editor", `{"name":"New","parent_id":{missing}}`, http.StatusNotFound},
+		{"parent of another user", "/api/admin/link-groups", "editor", `{"name":"New","parent_id":{otherGroup}}`, http.StatusNotFound},
+		{"viewer", "/api/admin/link-groups", "viewer", `{"name":"New"}`, http.StatusForbidden},
+		{"no token", "/api/admin/link-groups", "", `{"name":"New"}`, http.StatusUnauthorized},
+	}},
+	{"GET /api/admin/analytics/links", []routeCase{
+		{"editor", "/api/admin/analytics/links", "editor", "", http.StatusOK},
+		{"most used this month", "/api/admin/analytics/links?days=30&limit=10", "editor", "", http.StatusOK},
+		{"invalid days", "/api/admin/analytics/links?days=0", "editor", "", http.StatusBadRequest},
+		{"invalid limit", "/api/admin/analytics/links?limit=1000", "editor", "", http.StatusBadRequest},
+		{"viewer", "/api/admin/analytics/links", "viewer", "", http.StatusForbidden},
+		{"no token", "/api/admin/analytics/links", "", "", http.StatusUnauthorized},
+	}},
+	{"GET /api/admin/analytics/links/:id", []routeCase{
+		{"editor", "/api/admin/analytics/links/{link}?days=30", "editor", "", http.StatusOK},
+		{"link of another user", "/api/admin/analytics/links/{otherLink}", "editor", "", http.StatusNotFound},
+		{"missing link", "/api/admin/analytics/links/{missing}", "editor", "", http.StatusNotFound},
+		{"invalid ID", "/api/admin/analytics/links/abc", "editor", "", http.StatusBadRequest},
+		{"invalid days", "/api/admin/analytics/links/{link}?days=366", "editor", "", http.StatusBadRequest},
+	}},
+	{"GET /api/admin/analytics/groups", []routeCase{
+		{"editor", "/api/admin/analytics/groups", "editor", "", http.StatusOK},
+		{"invalid days", "/api/admin/analytics/groups?days=week", "editor", "", http.StatusBadRequest},
+		{"viewer", "/api/admin/analytics/groups", "viewer", "", http.StatusForbidden},
+	}},
+	{"POST /api/admin/link-groups/reorder", []routeCase{
+		{"editor", "/api/admin/link-groups/reorder", "editor", `{"ids":[{subgroup},{group}]}`, http.StatusOK},
+		{"group of another user", "/api/admin/link-groups/reorder", "editor", `{"ids":[{group},{otherGroup}]}`, http.StatusNotFound},
+		{"duplicate IDs", "/api/admin/link-groups/reorder", "editor", `{"ids":[{group},{group}]}`, http.StatusBadRequest},
+		{"no IDs", "/api/admin/link-groups/reorder", "editor", `{"ids":[]}`, http.StatusBadRequest},
+		{"missing IDs", "/api/admin/link-groups/reorder", "editor", `{}`, http.StatusBadRequest},
+		{"viewer", "/api/admin/link-groups/reorder", "viewer", `{"ids":[{group}]}`, http.StatusForbidden},
+		{"no token", "/api/admin/link-groups/reorder", "", `{"ids":[{group}]}`, http.StatusUnauthorized},
+	}},
+	{"PUT /api/admin/link-groups/:id", []routeCase{
+		{"owner", "/api/admin/link-groups/{group}", "editor", `{"name":"Renamed"}`, http.StatusOK},
+		{"change visibility", "/api/admin/link-groups/{group}", "editor", `{"name":"Renamed","visibility":"public"}`, http.StatusOK},
+		{"invalid visibility", "/api/admin/link-groups/{group}", "editor", `{"name":"Renamed","visibility":"secret"}`, http.StatusBadRequest},
+		{"move to the top level", "/api/admin/link-groups/{subgroup}", "editor", `{"name":"Renamed","parent_id":0}`, http.StatusOK},
+		{"move into own subgroup", "/api/admin/link-groups/{group}", "editor", `{"name":"Renamed","parent_id":{subgroup}}`, http.StatusBadRequest},
+		{"move below group of another user", "/api/admin/link-groups/{subgroup}", "editor", `{"name":"Renamed","parent_id":{otherGroup}}`, http.StatusNotFound},
+		{"missing name", "/api/admin/link-groups/{group}", "editor", `{}`, http.StatusBadRequest},
+		{"invalid ID", "/api/admin/link-groups/abc", "editor", `{"name":"Renamed"}`, http.StatusBadRequest},
+		{"missing group", "/api/admin/link-groups/{missing}", "editor", `{"name":"Renamed"}`, http.StatusNotFound},
+		{"group of another user", "/api/admin/link-groups/{otherGroup}", "editor", `{"name":"Renamed"}`, http.StatusNotFound},
+		{"viewer", "/api/admin/link-groups/{group}", "viewer", `{"name":"Renamed"}`, http.StatusForbidden},
+		{"no token", "/api/admin/link-groups/{group}", "", `{"name":"Renamed"}`, http.StatusUnauthorized},
+	}},
+	{"DELETE /api/admin/link-groups/:id", []routeCase{
+		{"owner", "/api/admin/link-groups/{group}", "editor", "", http.StatusOK},
+		{"invalid ID", "/api/admin/link-groups/abc", "editor", "", http.StatusBadRequest},
+		{"missing group", "/api/admin/link-groups/{missing}", "editor", "", http.StatusNotFound},
+		{"group of another user", "/api/admin/link-groups/{otherGroup}", "editor", "", http.StatusNotFound},
+		{"viewer", "/api/admin/link-groups/{group}", "viewer", "", http.StatusForbidden},
+		{"no token", "/api/admin/link-groups/{group}", "", "", http.StatusUnauthorized},
+	}},
+	{"GET /api/admin/link-groups/:id/shares", []routeCase{
+		{"owner", "/api/admin/link-groups/{group}/shares", "editor", "", http.StatusOK},
+		{"invalid ID", "/api/admin/link-groups/abc/shares", "editor", "", http.StatusBadRequest},
+		{"missing group", "/api/admin/link-groups/{missing}/shares", "editor", "", http.StatusNotFound},
+		{"group of another user", "/api/admin/link-groups/{otherGroup}/shares", "editor", "", http.StatusNotFound},
+		{"no token", "/api/admin/link-groups/{group}/shares", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/link-groups/:id/shares", []routeCase{
+		{"with user", "/api/admin/link-groups/{group}/shares", "editor", `{"username":"other","permission":"write"}`, http.StatusOK},
+		{"with team", "/api/admin/link-groups/{group}/shares", "editor", `{"team":"ops","permission":"read"}`, http.StatusOK},
+		{"with yourself", "/api/admin/link-groups/{group}/shares", "editor", `{"username":"editor","permission":"read"}`, http.StatusBadRequest},
+		{"user and team", "/api/admin/link-groups/{group}/shares", "editor", `{"username":"other","team":"ops","permission":"read"}`, http.StatusBadRequest},
+		{"invalid permission", "/api/admin/link-groups/{group}/shares", "editor", `{"username":"other","permission":"owner"}`, http.StatusBadRequest},
+		{"unknown user", "/api/admin/link-groups/{group}/shares", "editor", `{"username":"nobody","permission":"read"}`, http.StatusNotFound},
+		{"unknown team", "/api/admin/link-groups/{group}/shares", "editor", `{"team":"nobody","permission":"read"}`, http.StatusNotFound},
+		{"invalid ID", "/api/admin/link-groups/abc/shares", "editor", `{"username":"other","permission":"read"}`, http.StatusBadRequest},
+		{"group of another user", "/api/admin/link-groups/{otherGroup}/shares", "editor", `{"username":"viewer","permission":"read"}`, http.StatusNotFound},
+	}},
+	{"DELETE /api/admin/link-groups/:id/shares/:shareId", []routeCase{
+		{"owner", "/api/admin/link-groups/{group}/shares/{share}", "editor", "", http.StatusOK},
+		{"invalid group ID", "/api/admin/link-groups/abc/shares/{share}", "editor", "", http.StatusBadRequest},
+		{"invalid share ID", "/api/admin/link-groups/{group}/shares/abc", "editor", "", http.StatusBadRequest},
+		{"missing share", "/api/admin/link-groups/{group}/shares/{missing}", "editor", "", http.StatusNotFound},
+		{"share of another group", "/api/admin/link-groups/{otherGroup}/shares/{share}", "editor", "", http.StatusNotFound},
+	}},
+	{"GET /api/admin/link-groups/:id/links", []routeCase{
+		{"owner", "/api/admin/link-groups/{group}/links", "editor", "", http.StatusOK},
+		{"invalid ID", "/api/admin/link-groups/abc/links", "editor", "", http.StatusBadRequest},
+		{"missing group", "/api/admin/link-groups/{missing}/links", "editor", "", http.StatusNotFound},
+		{"group of another user", "/api/admin/link-groups/{otherGroup}/links", "editor", "", http.StatusNotFound},
+		{"viewer", "/api/admin/link-groups/{group}/links", "viewer", "", http.StatusForbidden},
+	}},
+	{"POST /api/admin/link-groups/:id/links/reorder", []routeCase{
+		{"editor", "/api/admin/link-groups/{group}/links/reorder", "editor", `{"ids":[{link}]}`, http.StatusOK},
+		{"link of another group", "/api/admin/link-groups/{group}/links/reorder", "editor", `{"ids":[{otherLink}]}`, http.StatusBadRequest},
+		{"duplicate IDs", "/api/admin/link-groups/{group}/links/reorder", "editor", `{"ids":[{link},{link}]}`, http.StatusBadRequest},
+		{"invalid ID", "/api/admin/link-groups/abc/links/reorder", "editor", `{"ids":[{link}]}`, http.StatusBadRequest},
+		{"missing group", "/api/admin/link-groups/{missing}/links/reorder", "editor", `{"ids":[{link}]}`, http.StatusNotFound},
+		{"group of another user", "/api/admin/link-groups/{otherGroup}/links/reorder", "editor", `{"ids":[{otherLink}]}`, http.StatusNotFound},
+		{"viewer", "/api/admin/link-groups/{group}/links/reorder", "viewer", `{"ids":[{link}]}`, http.StatusForbidden},
+		{"no token", "/api/admin/link-groups/{group}/links/reorder", "", `{"ids":[{link}]}`, http.StatusUnauthorized},
+	}},
+	{"GET /api/admin/links/health", []routeCase{
+		{"editor", "/api/admin/links/health", "editor", "", http.StatusOK},
+		{"only links that are down", "/api/admin/links/health?status=down", "editor", "", http.StatusOK},
+		{"invalid status", "/api/admin/links/health?status=sick", "editor", "", http.StatusBadRequest},
+		{"viewer", "/api/admin/links/health", "viewer", "", http.StatusForbidden},
+		{"no token", "/api/admin/links/health", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/links", []routeCase{
+		{"owner", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net"}`, http.StatusCreated},
+		{"with tags", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net","tags":["oncall","monitoring"]}`, http.StatusCreated},
+		{"invalid tag", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net","tags":["a,b"]}`, http.StatusBadRequest},
+		{"with details", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net","description":"Status page","owner":"SRE","environment":"prod","metadata":{"runbook":"https://wiki.example.com/status"}}`, http.StatusCreated},
+		{"invalid environment", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net","environment":"qa"}`, http.StatusBadRequest},
+		{"with alias", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net/{page}","alias":"go/docs/{page}"}`, http.StatusCreated},
+		{"invalid alias", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net","alias":"{page}"}`, http.StatusBadRequest},
+		{"alias of another link", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"https://example.net","alias":"Other"}`, http.StatusConflict},
+		{"missing URL", "/api/admin/links", "editor", `{"group_id":{group},"name":"New"}`, http.StatusBadRequest},
+		{"javascript URL", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"javascript:alert(1)"}`, http.StatusBadRequest},
+		{"relative URL", "/api/admin/links", "editor", `{"group_id":{group},"name":"New","url":"/admin"}`, http.StatusBadRequest},
+		{"missing group", "/api/admin/links", "editor", `{"group_id":{missing},"name":"New","url":"https://example.net"}`, http.StatusNotFound},
+		{"group of another user", "/api/admin/links", "editor", `{"group_id":{otherGroup},"name":"New","url":"https://example.net"}`, http.StatusNotFound},
+		{"viewer", "/api/admin/links", "viewer", `{"group_id":{group},"name":"New","url":"https://example.net"}`, http.StatusForbidden},
+		{"no token", "/api/admin/links", "", `{"group_id":{group},"name":"New","url":"https://example.net"}`, http.StatusUnauthorized},
+	}},
+	{"PUT /api/admin/links/:id", []routeCase{
+		{"owner", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net"}`, http.StatusOK},
+		{"with tags", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","tags":[]}`, http.StatusOK},
+		{"invalid tag", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","tags":["a,b"]}`, http.StatusBadRequest},
+		{"with details", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","description":"","environment":"dev"}`, http.StatusOK},
+		{"invalid metadata", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","metadata":{" ":"empty key"}}`, http.StatusBadRequest},
+		{"with icon", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","icon":"https://example.net/logo.png"}`, http.StatusOK},
+		{"invalid icon", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","icon":"javascript:alert(1)"}`, http.StatusBadRequest},
+		{"with alias", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","alias":"example"}`, http.StatusOK},
+		{"alias of another link", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net","alias":"other"}`, http.StatusConflict},
+		{"missing name", "/api/admin/links/{link}", "editor", `{"group_id":{group},"url":"https://example.net"}`, http.StatusBadRequest},
+		{"data URL", "/api/admin/links/{link}", "editor", `{"group_id":{group},"name":"Renamed","url":"data:text/html,<script>alert(1)</script>"}`, http.StatusBadRequest},
+		{"invalid ID", "/api/admin/links/abc", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net"}`, http.StatusBadRequest},
+		{"missing link", "/api/admin/links/{missing}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net"}`, http.StatusNotFound},
+		{"link of another user", "/api/admin/links/{otherLink}", "editor", `{"group_id":{group},"name":"Renamed","url":"https://example.net"}`, http.StatusNotFound},
+		{"move to group of another user", "/api/admin/links/{link}", "editor", `{"group_id":{otherGroup},"name":"Renamed","url":"https://example.net"}`, http.StatusNotFound},
+		{"viewer", "/api/admin/links/{link}", "viewer", `{"group_id":{group},"name":"Renamed","url":"https://example.net"}`, http.StatusForbidden},
+	}},
+	{"POST /api/admin/links/:id/icon", []routeCase{
+		{"not multipart", "/api/admin/links/{link}/icon", "editor", `{}`, http.StatusBadRequest},
+		{"invalid ID", "/api/admin/links/abc/icon", "editor", `{}`, http.StatusBadRequest},
+		{"missing link", "/api/admin/links/{missing}/icon", "editor", `{}`, http.StatusNotFound},
+		{"link of another user", "/api/admin/links/{otherLink}/icon", "editor", `{}`, http.StatusNotFound},
+		{"viewer", "/api/admin/links/{link}/icon", "viewer", `{}`, http.StatusForbidden},
+		{"no token", "/api/admin/links/{link}/icon", "", `{}`, http.StatusUnauthorized},
+	}},
+	{"DELETE /api/admin/links/:id/icon", []routeCase{
+		{"owner", "/api/admin/links/{link}/icon", "editor", "", http.StatusOK},
+		{"invalid ID", "/api/admin/links/abc/icon", "editor", "", http.StatusBadRequest},
+		{"missing link", "/api/admin/links/{missing}/icon", "editor", "", http.StatusNotFound},
+		{"link of another user", "/api/admin/links/{otherLink}/icon", "editor", "", http.StatusNotFound},
+		{"viewer", "/api/admin/links/{link}/icon", "viewer", "", http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/links/:id", []routeCase{
+		{"owner", "/api/admin/links/{link}", "editor", "", http.StatusOK},
+		{"invalid ID", "/api/admin/links/abc", "editor", "", http.StatusBadRequest},
+		{"missing link", "/api/admin/links/{missing}", "editor", "", http.StatusNotFound},
+		{"link of another user", "/api/admin/links/{otherLink}", "editor", "", http.StatusNotFound},
+		{"viewer", "/api/admin/links/{link}", "viewer", "", http.StatusForbidden},
+	}},
+	{"GET /api/admin/users", []routeCase{
+		{"admin", "/api/admin/users", "admin", "", http.StatusOK},
+		{"editor", "/api/admin/users", "editor", "", http.StatusForbidden},
+		{"no token", "/api/admin/users", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/users", []routeCase{
+		{"admin", "/api/admin/users", "admin", `{"username":"new","password":"password"}`, http.StatusCreated},
+		{"existing username", "/api/admin/users", "admin", `{"username":"editor","password":"password"}`, http.StatusConflict},
+		{"invalid role", "/api/admin/users", "admin", `{"username":"new","password":"password","role":"root"}`, http.StatusBadRequest},
+		{"missing password", "/api/admin/users", "admin", `{"username":"new"}`, http.StatusBadRequest},
+		{"editor", "/api/admin/users", "editor", `{"username":"new","password":"password"}`, http.StatusForbidden},
+	}},
+	{"PUT /api/admin/users/:id", []routeCase{
+		{"disable", "/api/admin/users/{editor}", "admin", `{"disabled":true}`, http.StatusOK},
+		{"change role", "/api/admin/users/{editor}", "admin", `{"role":"viewer"}`, http.StatusOK},
+		{"nothing to change", "/api/admin/users/{editor}", "admin", `{}`, http.StatusBadRequest},
+		{"invalid role", "/api/admin/users/{editor}", "admin", `{"role":"root"}`, http.StatusBadRequest},
+		{"disable yourself", "/api/admin/users/{admin}", "admin", `{"disabled":true}`, http.StatusBadRequest},
+		{"demote yourself", "/api/admin/users/{admin}", "admin", `{"role":"editor"}`, http.StatusBadRequest},
+		{"invalid ID", "/api/admin/users/abc", "admin", `{"disabled":true}`, http.StatusBadRequest},
+		{"missing user", "/api/admin/users/{missing}", "admin", `{"disabled":true}`, http.StatusNotFound},
+		{"editor", "/api/admin/users/{viewer}", "editor", `{"disabled":true}`, http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/users/:id", []routeCase{
+		{"admin", "/api/admin/users/{editor}", "admin", "", http.StatusOK},
+		{"yourself", "/api/admin/users/{admin}", "admin", "", http.StatusBadRequest},
+		{"invalid ID", "/api/admin/users/abc", "admin", "", http.StatusBadRequest},
+		{"missing user", "/api/admin/users/{missing}", "admin", "", http.StatusNotFound},
+		{"editor", "/api/admin/users/{viewer}", "editor", "", http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/users/:id/2fa", []routeCase{
+		{"admin", "/api/admin/users/{editor}/2fa", "admin", "", http.StatusOK},
+		{"invalid ID", "/api/admin/users/abc/2fa", "admin", "", http.StatusBadRequest},
+		{"missing user", "/api/admin/users/{missing}/2fa", "admin", "", http.StatusNotFound},
+		{"editor", "/api/admin/users/{viewer}/2fa", "editor", "", http.StatusForbidden},
+	}},
+	{"GET /api/admin/users/:id/sessions", []routeCase{
+		{"admin", "/api/admin/users/{editor}/sessions", "admin", "", http.StatusOK},
+		{"invalid ID", "/api/admin/users/abc/sessions", "admin", "", http.StatusBadRequest},
+		{"editor", "/api/admin/users/{editor}/sessions", "editor", "", http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/users/:id/sessions", []routeCase{
+		{"admin", "/api/admin/users/{editor}/sessions", "admin", "", http.StatusOK},
+		{"invalid ID", "/api/admin/users/abc/sessions", "admin", "", http.StatusBadRequest},
+		{"editor", "/api/admin/users/{editor}/sessions", "editor", "", http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/users/:id/sessions/:sessionId", []routeCase{
+		{"admin", "/api/admin/users/{editor}/sessions/{session}", "admin", "", http.StatusOK},
+		{"invalid user ID", "/api/admin/users/abc/sessions/{session}", "admin", "", http.StatusBadRequest},
+		{"invalid session ID", "/api/admin/users/{editor}/sessions/abc", "admin", "", http.StatusBadRequest},
+		{"missing session", "/api/admin/users/{editor}/sessions/{missing}", "admin", "", http.StatusNotFound},
+		{"session of another user", "/api/admin/users/{viewer}/sessions/{session}", "admin", "", http.StatusNotFound},
+	}},
+	{"GET /api/admin/users/:id/tokens", []routeCase{
+		{"admin", "/api/admin/users/{editor}/tokens", "admin", "", http.StatusOK},
+		{"invalid ID", "/api/admin/users/abc/tokens", "admin", "", http.StatusBadRequest},
+		{"editor", "/api/admin/users/{editor}/tokens", "editor", "", http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/users/:id/tokens/:tokenId", []routeCase{
+		{"admin", "/api/admin/users/{editor}/tokens/{token}", "admin", "", http.StatusOK},
+		{"invalid user ID", "/api/admin/users/abc/tokens/{token}", "admin", "", http.StatusBadRequest},
+		{"invalid token ID", "/api/admin/users/{editor}/tokens/abc", "admin", "", http.StatusBadRequest},
+		{"missing token", "/api/admin/users/{editor}/tokens/{missing}", "admin", "", http.StatusNotFound},
+		{"token of another user", "/api/admin/users/{viewer}/tokens/{token}", "admin", "", http.StatusNotFound},
+	}},
+	{"GET /api/admin/teams", []routeCase{
+		{"admin", "/api/admin/teams", "admin", "", http.StatusOK},
+		{"editor", "/api/admin/teams", "editor", "", http.StatusForbidden},
+	}},
+	{"POST /api/admin/teams", []routeCase{
+		{"admin", "/api/admin/teams", "admin", `{"name":"dev"}`, http.StatusCreated},
+		{"existing name", "/api/admin/teams", "admin", `{"name":"ops"}`, http.StatusConflict},
+		{"missing name", "/api/admin/teams", "admin", `{}`, http.StatusBadRequest},
+		{"editor", "/api/admin/teams", "editor", `{"name":"dev"}`, http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/teams/:id", []routeCase{
+		{"admin", "/api/admin/teams/{team}", "admin", "", http.StatusOK},
+		{"invalid ID", "/api/admin/teams/abc", "admin", "", http.StatusBadRequest},
+		{"missing team", "/api/admin/teams/{missing}", "admin", "", http.StatusNotFound},
+		{"editor", "/api/admin/teams/{team}", "editor", "", http.StatusForbidden},
+	}},
+	{"POST /api/admin/teams/:id/members", []routeCase{
+		{"admin", "/api/admin/teams/{team}/members", "admin", `{"username":"viewer"}`, http.StatusOK},
+		{"unknown user", "/api/admin/teams/{team}/members", "admin", `{"username":"nobody"}`, http.StatusNotFound},
+		{"missing username", "/api/admin/teams/{team}/members", "admin", `{}`, http.StatusBadRequest},
+		{"invalid ID", "/api/admin/teams/abc/members", "admin", `{"username":"viewer"}`, http.StatusBadRequest},
+		{"missing team", "/api/admin/teams/{missing}/members", "admin", `{"username":"viewer"}`, http.StatusNotFound},
+		{"editor", "/api/admin/teams/{team}/members", "editor", `{"username":"viewer"}`, http.StatusForbidden},
+	}},
+	{"DELETE /api/admin/teams/:id/members/:username", []routeCase{
+		{"admin", "/api/admin/teams/{team}/members/editor", "admin", "", http.StatusOK},
+		{"not a member", "/api/admin/teams/{team}/members/viewer", "admin", "", http.StatusNotFound},
+		{"unknown user", "/api/admin/teams/{team}/members/nobody", "admin", "", http.StatusNotFound},
+		{"invalid ID", "/api/admin/teams/abc/members/editor", "admin", "", http.StatusBadRequest},
+		{"editor", "/api/admin/teams/{team}/members/editor", "editor", "", http.StatusForbidden},
+	}},
+	{"GET /api/admin/settings", []routeCase{
+		{"admin", "/api/admin/settings", "admin", "", http.StatusOK},
+		{"editor", "/api/admin/settings", "editor", "", http.StatusForbidden},
+	}},
+	{"PUT /api/admin/settings", []routeCase{
+		{"admin", "/api/admin/settings", "admin", `{"require_admin_2fa":false}`, http.StatusOK},
+		{"require 2FA without own 2FA", "/api/admin/settings", "admin", `{"require_admin_2fa":true}`, http.StatusBadRequest},
+		{"invalid JSON", "/api/admin/settings", "admin", `{`, http.StatusBadRequest},
+		{"editor", "/api/admin/settings", "editor", `{"require_admin_2fa":false}`, http.StatusForbidden},
+	}},
+	{"GET /api/admin/export", []routeCase{
+		{"admin", "/api/admin/export", "admin", "", http.StatusOK},
+		{"bookmarks", "/api/admin/export?format=netscape", "admin", "", http.StatusOK},
+		{"invalid format", "/api/admin/export?format=csv", "admin", "", http.StatusBadRequest},
+		{"editor", "/api/admin/export", "editor", "", http.StatusForbidden},
+		{"no token", "/api/admin/export", "", "", http.StatusUnauthorized},
+	}},
+	{"POST /api/admin/import", []routeCase{
+		{"no file", "/api/admin/import", "admin", `{}`, http.StatusBadRequest},
+		{"invalid format", "/api/admin/import?format=csv", "admin", `{}`, http.StatusBadRequest},
+		{"invalid mode", "/api/admin/import?mode=append", "admin", `{}`, http.StatusBadRequest},
+		{"invalid dry run", "/api/admin/import?dry_run=maybe", "admin", `{}`, http.StatusBadRequest},
+		{"editor", "/api/admin/import", "editor", `{}`, http.StatusForbidden},
+		{"no token", "/api/admin/import", "", `{}`, http.StatusUnauthorized},
+	}},
+}
+
+func TestRoutes(t *testing.T) {
+	for _, route := range routeTests {
+		method, _, _ := strings.Cut(route.route, " ")
+		for _, tt := range route.cases {
+			t.Run(route.route+"/"+tt.name, func(t *testing.T) {
+				f := newRouteFixture(t)
+				rec := f.do(method, tt.path, tt.as, tt.body)
+				if rec.Code != tt.wantCode {
+					t.Errorf("%s %s returned %d, want %d: %s", method, f.ids.Replace(tt.path), rec.Code, tt.wantCode, rec.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRoutesCovered(t *testing.T) {
+	tested := make(map[string]bool)
+	for _, route := range routeTests {
+		tested[route.route] = true
+	}
+
+	f := newRouteFixture(t)
+	for _, route := range f.srv.router.Routes() {
+		// Single sign-on routes need an identity provider and are left to the OIDC tests
+		isAPI := strings.HasPrefix(route.Path, "/api/") || strings.HasPrefix(route.Path, "/r/")
+		if !isAPI || strings.HasPrefix(route.Path, "/api/auth/oidc/") {
+			continue
+		}
+		if !tested[route.Method+" "+route.Path] {
+			t.Errorf("route %s %s has no tests", route.Method, route.Path)
+		}
+	}
+}
+
+func TestRouteEffects(t *testing.T) {
+	t.Run("deleted group is gone", func(t *testing.T) {
+		f := newRouteFixture(t)
+		if rec := f.do(http.MethodDelete, "/api/admin/link-groups/{group}", "editor", ""); rec.Code != http.StatusOK {
+			t.Fatalf("delete group returned %d", rec.Code)
+		}
+		if rec := f.do(http.MethodGet, "/api/admin/link-groups/{group}/links", "editor", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("links of deleted group returned %d, want 404", rec.Code)
+		}
+	})
+
+	t.Run("logout ends the session", func(t *testing.T) {
+		f := newRouteFixture(t)
+		if rec := f.do(http.MethodPost, "/api/logout", "editor", ""); rec.Code != http.StatusOK {
+			t.Fatalf("logout returned %d", rec.Code)
+		}
+		if rec := f.do(http.MethodGet, "/api/links", "editor", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token after logout returned %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("disabled user is locked out", func(t *testing.T) {
+		f := newRouteFixture(t)
+		if rec := f.do(http.MethodPut, "/api/admin/users/{editor}", "admin", `{"disabled":true}`); rec.Code != http.StatusOK {
+			t.Fatalf("disable user returned %d", rec.Code)
+		}
+		if rec := f.do(http.MethodGet, "/api/links", "editor", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token of disabled user returned %d, want 401", rec.Code)
+		}
+		if rec := f.do(http.MethodGet, "/api/links", "apitoken", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("API token of disabled user returned %d, want 401", rec.Code)
+		}
+		if rec := f.do(http.MethodPost, "/api/login", "", `{"username":"editor","password":"password"}`); rec.Code != http.StatusForbidden {
+			t.Errorf("login of disabled user returned %d, want 403", rec.Code)
+		}
+	})
+
+	t.Run("refresh token is single use", func(t *testing.T) {
+		f := newRouteFixture(t)
+		if rec := f.do(http.MethodPost, "/api/refresh", "", `{"refresh_token":"{refresh}"}`); rec.Code != http.StatusOK {
+			t.Fatalf("refresh returned %d", rec.Code)
+		}
+		if rec := f.do(http.MethodPost, "/api/refresh", "", `{"refresh_token":"{refresh}"}`); rec.Code != http.StatusUnauthorized {
+			t.Errorf("reused refresh token returned %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("links are filtered by tag", func(t *testing.T) {
+		f := newRouteFixture(t)
+		body := `{"group_id":{group},"name":"Grafana","url":"https://grafana.example.com","sort_order":2,"tags":["Monitoring"," oncall "]}`
+		if rec := f.do(http.MethodPost, "/api/admin/links", "editor", body); rec.Code != http.StatusCreated {
+			t.Fatalf("create link returned %d", rec.Code)
+		}
+
+		for tag, want := range map[string]string{"oncall": "Example,Grafana", "monitoring": "Grafana", "unknown": ""} {
+			var groups []models.LinkGroup
+			rec := f.do(http.MethodGet, "/api/links?tag="+tag, "editor", "")
+			if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body.String(), err)
+			}
+			var names []string
+			for _, group := range groups {
+				for _, link := range group.Links {
+					names = append(names, link.Name)
+				}
+			}
+			if got := strings.Join(names, ","); got != want {
+				t.Errorf("links tagged %s are %q, want %q", tag, got, want)
+			}
+		}
+
+		// Updating a link without tags keeps them
+		body = `{"group_id":{group},"name":"Example","url":"https://example.com","sort_order":3}`
+		if rec := f.do(http.MethodPut, "/api/admin/links/{link}", "editor", body); rec.Code != http.StatusOK {
+			t.Fatalf("update link returned %d", rec.Code)
+		}
+		links, err := f.store.GetLinksByGroupID(mustGroupID(t, f.store, "editor", "Editor group"))
+		if err != nil || len(links) != 2 || strings.Join(links[0].Tags, ",") != "monitoring,oncall" || strings.Join(links[1].Tags, ",") != "oncall" {
+			t.Errorf("links after update without tags %+v, %v", links, err)
+		}
+	})
+
+	t.Run("link details are kept unless given", func(t *testing.T) {
+		f := newRouteFixture(t)
+		body := `{"group_id":{group},"name":"Example","url":"https://example.com","description":" Main site ","owner":"Web team","environment":"Prod","metadata":{"runbook":"https://wiki.example.com/web"}}`
+		if rec := f.do(http.MethodPut, "/api/admin/links/{link}", "editor", body); rec.Code != http.StatusOK {
+			t.Fatalf("update link returned %d", rec.Code)
+		}
+		linkID := mustID(t)(strconv.ParseInt(f.ids.Replace("{link}"), 10, 64))
+		link, err := f.store.GetLink(linkID)
+		if err != nil || link.Description != "Main site" || link.Owner != "Web team" || link.Environment != models.EnvironmentProd ||
+			link.Metadata["runbook"] != "https://wiki.example.com/web" {
+			t.Fatalf("link after update %+v, %v", link, err)
+		}
+
+		// Reordering does not send the details, changing one keeps the others
+		body = `{"group_id":{group},"name":"Example","url":"https://example.com","sort_order":5}`
+		if rec := f.do(http.MethodPut, "/api/admin/links/{link}", "editor", body); rec.Code != http.StatusOK {
+			t.Fatalf("reorder link returned %d", rec.Code)
+		}
+		body = `{"group_id":{group},"name":"Example","url":"https://example.com","sort_order":5,"owner":""}`
+		if rec := f.do(http.MethodPut, "/api/admin/links/{link}", "editor", body); rec.Code != http.StatusOK {
+			t.Fatalf("clear owner returned %d", rec.Code)
+		}
+		link, err = f.store.GetLink(linkID)
+		if err != nil || link.Description != "Main site" || link.Owner != "" || len(link.Metadata) != 1 || link.SortOrder != 5 {
+			t.Errorf("link after partial updates %+v, %v", link, err)
+		}
+
+		// Descriptions are searched
+		var results []models.SearchResult
+		rec := f.do(http.MethodGet, "/api/search?q=main", "viewer", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 1 || results[0].Description != "Main site" {
+			t.Errorf("search for the description returned %s", rec.Body.String())
+		}
+	})
+
+	t.Run("search ranks links the user can read", func(t *testing.T) {
+		f := newRouteFixture(t)
+		body := `{"group_id":{group},"name":"Example status","url":"https://status.example.org","sort_order":2}`
+		if rec := f.do(http.MethodPost, "/api/admin/links", "editor", body); rec.Code != http.StatusCreated {
+			t.Fatalf("create link returned %d", rec.Code)
+		}
+
+		var results []models.SearchResult
+		rec := f.do(http.MethodGet, "/api/search?q=example", "viewer", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body.String(), err)
+		}
+		// The link of the other user also matches but is not shared with the viewer
+		var names []string
+		for _, result := range results {
+			if result.GroupName != "Editor group" {
+				t.Errorf("result %+v is not in the shared group", result)
+			}
+			names = append(names, result.Name)
+		}
+		if got := strings.Join(names, ","); got != "Example,Example status" {
+			t.Errorf("search returned %q", got)
+		}
+	})
+
+	t.Run("shared group is readable but not writable", func(t *testing.T) {
+		f := newRouteFixture(t)
+		var groups []models.LinkGroup
+		rec := f.do(http.MethodGet, "/api/links", "viewer", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil || len(groups) != 1 || len(groups[0].Links) != 1 {
+			t.Fatalf("viewer sees %s, want the shared group with its link", rec.Body.String())
+		}
+
+		// Promote the viewer so only the read share stands in the way
+		if err := f.store.SetUserRole(mustUserID(t, f.store, "viewer"), models.RoleEditor); err != nil {
+			t.Fatalf("promote viewer: %v", err)
+		}
+		f.tokens["viewer"] = login(t, f.srv, "viewer", "password")
+		if rec := f.do(http.MethodDelete, "/api/admin/links/{link}", "viewer", ""); rec.Code != http.StatusForbidden {
+			t.Errorf("delete link with read share returned %d, want 403", rec.Code)
+		}
+	})
+}
+
+// exportGroups exports the link groups of the user named by as
+func (f *routeFixture) exportGroups(t *testing.T, as string) handlers.ExportData {
+	t.Helper()
+
+	rec := f.do(http.MethodGet, "/api/admin/export", as, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); !strings.Contains(disposition, "attachment") {
+		t.Errorf("export is not a download, Content-Disposition %q", disposition)
+	}
+
+	var data handlers.ExportData
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatalf("decode export: %v", err)
+	}
+	return data
+}
+
+// importGroups uploads data as the import file of the user named by as and returns the status
+func (f *routeFixture) importGroups(t *testing.T, as string, data []byte) int {
+	t.Helper()
+
+	return f.upload(t, "/api/admin/import", as, "link-deck-export.json", data).Code
+}
+
+// upload posts data as the file of a multipart form as the user named by as
+func (f *routeFixture) upload(t *testing.T, path, as, filename string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, f.ids.Replace(path), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+f.tokens[as])
+	rec := httptest.NewRecorder()
+	f.srv.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// withoutIDs strips the IDs from exported groups, which change on import,
+// and refers to parents by their position instead
+func withoutIDs(data handlers.ExportData) []handlers.ExportLinkGroup {
+	positions := make(map[int64]int64, len(data.LinkGroups))
+	for i, group := range data.LinkGroups {
+		positions[group.ID] = int64(i + 1)
+	}
+
+	groups := make([]handlers.ExportLinkGroup, 0, len(data.LinkGroups))
+	for _, group := range data.LinkGroups {
+		group.ID = 0
+		group.ParentID = positions[group.ParentID]
+		links := make([]handlers.ExportLink, 0, len(group.Links))
+		for _, link := range group.Links {
+			link.ID, link.GroupID = 0, 0
+			links = append(links, link)
+		}
+		group.Links = links
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := newRouteFixture(t)
+	for _, body := range []string{
+		`{"name":"Work","sort_order":1}`,
+		`{"name":"Public","sort_order":2,"visibility":"public"}`,
+		`{"name":"Empty","sort_order":3}`,
+	} {
+		if rec := source.do(http.MethodPost, "/api/admin/link-groups", "admin", body); rec.Code != http.StatusCreated {
+			t.Fatalf("create group returned %d", rec.Code)
+		}
+	}
+	groups, err := source.store.GetAllLinkGroups(mustUserID(t, source.store, "admin"))
+	if err != nil {
+		t.Fatalf("get groups: %v", err)
+	}
+	for i, link := range []struct{ name, url string }{{"Mail", "https://mail.example.com"}, {"Wiki", "https://wiki.example.com"}} {
+		if _, err := source.store.CreateLink(groups[0].ID, link.name, link.url, i+1); err != nil {
+			t.Fatalf("create link: %v", err)
+		}
+	}
+	docsID, err := source.store.CreateLink(groups[1].ID, "Docs", "https://docs.example.com", 1)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	// Work > Databases > Postgres
+	parentID := groups[0].ID
+	for _, name := range []string{"Databases", "Postgres"} {
+		var created struct{ ID int64 }
+		body := map[string]any{"name": name, "parent_id": parentID}
+		if code := doJSON(t, source.srv, http.MethodPost, "/api/admin/link-groups", source.tokens["admin"], body, &created); code != http.StatusCreated {
+			t.Fatalf("create subgroup returned %d", code)
+		}
+		parentID = created.ID
+	}
+	if _, err := source.store.CreateLink(parentID, "Primary", "https://pg.example.com", 1); err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if err := source.store.SetLinkTags(docsID, []string{"manuals", "oncall"}); err != nil {
+		t.Fatalf("set link tags: %v", err)
+	}
+	details := models.LinkDetails{Description: "Product manuals", Owner: "Docs team", Environment: models.EnvironmentProd,
+		Metadata: map[string]string{"repo": "docs"}, Icon: "https://docs.example.com/logo.png"}
+	if err := source.store.SetLinkDetails(docsID, details); err != nil {
+		t.Fatalf("set link details: %v", err)
+	}
+	if err := source.store.SetLinkAlias(docsID, "docs/{page}"); err != nil {
+		t.Fatalf("set link alias: %v", err)
+	}
+	if err := source.store.SaveLinkIcon(docsID, models.LinkIcon{ContentType: "image/png", Data: pngIcon, Uploaded: true}); err != nil {
+		t.Fatalf("save link icon: %v", err)
+	}
+
+	exported := source.exportGroups(t, "admin")
+	if len(exported.LinkGroups) != 5 {
+		t.Fatalf("exported %d groups, want 5", len(exported.LinkGroups))
+	}
+	// Groups of other users are not part of the admin's export
+	for _, group := range exported.LinkGroups {
+		if group.Name == "Editor group" || group.Name == "Other group" {
+			t.Errorf("export contains group %q of another user", group.Name)
+		}
+	}
+	file, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("encode export: %v", err)
+	}
+
+	// Importing into an empty deck recreates the same groups and links
+	target := newRouteFixture(t)
+	if code := target.importGroups(t, "admin", file); code != http.StatusOK {
+		t.Fatalf("import returned %d", code)
+	}
+	assertSameGroups(t, withoutIDs(target.exportGroups(t, "admin")), withoutIDs(exported))
+
+	// Importing again replaces the links of groups with the same name instead of duplicating them
+	if code := target.importGroups(t, "admin", file); code != http.StatusOK {
+		t.Fatalf("second import returned %d", code)
+	}
+	assertSameGroups(t, withoutIDs(target.exportGroups(t, "admin")), withoutIDs(exported))
+
+	// Other users' decks are untouched
+	editorGroups, err := target.store.GetAllLinkGroups(mustUserID(t, target.store, "editor"))
+	if err != nil || len(editorGroups) != 1 || len(editorGroups[0].Links) != 1 {
+		t.Errorf("editor groups after import %+v, %v", editorGroups, err)
+	}
+}
+
+func TestImportRejectsInvalidFile(t *testing.T) {
+	f := newRouteFixture(t)
+	if code := f.importGroups(t, "admin", []byte("not json")); code != http.StatusBadRequest {
+		t.Errorf("import of invalid JSON returned %d, want 400", code)
+	}
+	for name, file := range map[string]string{
+		"missing parent":   `{"link_groups":[{"id":1,"name":"Child","parent_id":2}]}`,
+		"nested in a loop": `{"link_groups":[{"id":1,"name":"A","parent_id":2},{"id":2,"name":"B","parent_id":1}]}`,
+		"invalid alias":    `{"link_groups":[{"id":1,"name":"A","links":[{"name":"Wiki","url":"https://wiki.example.com","alias":"team wiki"}]}]}`,
+		"javascript URL":   `{"link_groups":[{"id":1,"name":"A","links":[{"name":"Wiki","url":"javascript:alert(1)"}]}]}`,
+	} {
+		if code := f.importGroups(t, "admin", []byte(file)); code != http.StatusBadRequest {
+			t.Errorf("import of groups with a %s returned %d, want 400", name, code)
+		}
+	}
+	taken := `{"link_groups":[{"id":1,"name":"A","links":[{"name":"Wiki","url":"https://wiki.example.com","alias":"other"}]}]}`
+	// The alias is of a group admin cannot read, so it is not echoed back
+	if rec := f.upload(t, "/api/admin/import", "admin", "link-deck-export.json", []byte(taken)); rec.Code != http.StatusConflict ||
+		strings.Contains(rec.Body.String(), "other") || !strings.Contains(rec.Body.String(), "Wiki") {
+		t.Errorf("import of an alias of another link returned %d %s, want 409 naming the link", rec.Code, rec.Body.String())
+	}
+
+	data := f.exportGroups(t, "admin")
+	if len(data.LinkGroups) != 0 {
+		t.Errorf("failed import created groups %+v", data.LinkGroups)
+	}
+}
+
+func TestImportModes(t *testing.T) {
+	f := newRouteFixture(t)
+	initial := `{"link_groups":[
+		{"id":1,"name":"Work","sort_order":1,"links":[
+			{"name":"Mail","url":"https://mail.example.com","sort_order":1},
+			{"name":"Wiki","url":"https://wiki.example.com","sort_order":2}]},
+		{"id":2,"name":"Ops","sort_order":2,"links":[{"name":"Grafana","url":"https://grafana.example.com","sort_order":1}]}]}`
+	if code := f.importGroups(t, "admin", []byte(initial)); code != http.StatusOK {
+		t.Fatalf("initial import returned %d", code)
+	}
+
+	// A link added since the export, and a click that replacing must keep
+	workID := mustGroupID(t, f.store, "admin", "Work")
+	if _, err := f.store.CreateLink(workID, "Status", "https://status.example.com", 3); err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	links, err := f.store.GetLinksByGroupID(workID)
+	if err != nil || len(links) != 3 {
+		t.Fatalf("links of Work %+v, %v", links, err)
+	}
+	mailID := links[0].ID
+	if err := f.store.RecordClick(mailID, 0, ""); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+
+	update := []byte(`{"link_groups":[{"id":1,"name":"Work","sort_order":1,"links":[
+		{"name":"Webmail","url":"https://mail.example.com","sort_order":1},
+		{"name":"Docs","url":"https://docs.example.com","sort_order":2}]}]}`)
+	importAs := func(query string) handlers.ImportResult {
+		t.Helper()
+		rec := f.upload(t, "/api/admin/import?"+query, "admin", "link-deck-export.json", update)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("import with %s returned %d %s", query, rec.Code, rec.Body.String())
+		}
+		var result handlers.ImportResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("decode import result: %v", err)
+		}
+		return result
+	}
+	linkNames := func(group string) []string {
+		t.Helper()
+		links, err := f.store.GetLinksByGroupID(mustGroupID(t, f.store, "admin", group))
+		if err != nil {
+			t.Fatalf("get links of %s: %v", group, err)
+		}
+		var names []string
+		for _, link := range links {
+			names = append(names, link.Name)
+		}
+		return names
+	}
+
+	// Dry runs list the changes without making them
+	result := importAs("mode=replace-group&dry_run=true")
+	want := []handlers.ImportChange{
+		{Action: "delete", Type: "link", Group: "Work", Name: "Wiki", URL: "https://wiki.example.com"},
+		{Action: "delete", Type: "link", Group: "Work", Name: "Status", URL: "https://status.example.com"},
+		{Action: "update", Type: "link", Group: "Work", Name: "Webmail", URL: "https://mail.example.com"},
+		{Action: "create", Type: "link", Group: "Work", Name: "Docs", URL: "https://docs.example.com"},
+	}
+	if !result.DryRun || !reflect.DeepEqual(result.Changes, want) {
+		t.Errorf("dry run result %+v, want changes %+v", result, want)
+	}
+	if got := linkNames("Work"); !reflect.DeepEqual(got, []string{"Mail", "Wiki", "Status"}) {
+		t.Errorf("links of Work after dry run %v", got)
+	}
+
+	// Merging adds the new URLs and keeps everything else
+	result = importAs("mode=merge")
+	want = []handlers.ImportChange{{Action: "create", Type: "link", Group: "Work", Name: "Docs", URL: "https://docs.example.com"}}
+	if result.DryRun || !reflect.DeepEqual(result.Changes, want) {
+		t.Errorf("merge result %+v, want changes %+v", result, want)
+	}
+	if got := linkNames("Work"); !reflect.DeepEqual(got, []string{"Mail", "Wiki", "Docs", "Status"}) {
+		t.Errorf("links of Work after merge %v", got)
+	}
+
+	// Replacing a group keeps the links with imported URLs, with their clicks
+	importAs("mode=replace-group")
+	if got := linkNames("Work"); !reflect.DeepEqual(got, []string{"Webmail", "Docs"}) {
+		t.Errorf("links of Work after replacing the group %v", got)
+	}
+	if counts, err := f.store.CountLinkClicks(time.Time{}); err != nil || counts[mailID] != 1 {
+		t.Errorf("clicks after replacing the group %v, %v", counts, err)
+	}
+	if got := linkNames("Ops"); !reflect.DeepEqual(got, []string{"Grafana"}) {
+		t.Errorf("links of Ops after replacing Work %v", got)
+	}
+
+	// Replacing everything deletes the groups that are not imported
+	importAs("mode=replace-all")
+	data := f.exportGroups(t, "admin")
+	if len(data.LinkGroups) != 1 || data.LinkGroups[0].Name != "Work" || len(data.LinkGroups[0].Links) != 2 {
+		t.Errorf("groups after replacing all %+v", data.LinkGroups)
+	}
+	if editorGroups, err := f.store.GetAllLinkGroups(mustUserID(t, f.store, "editor")); err != nil || len(editorGroups) != 1 {
+		t.Errorf("editor groups after replacing all %+v, %v", editorGroups, err)
+	}
+}
+
+// browserBookmarks is a bookmarks.html file as browsers export it
+const browserBookmarks = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1700000000" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://mail.example.com/" ADD_DATE="1700000000" TAGS="Mail,Daily">Mail &amp; Calendar</A>
+        <DD>Team inbox
+        <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+        <DT><H3>Monitoring</H3>
+        <DL><p>
+            <DT><A HREF="https://grafana.example.com/" ICON="data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==">Grafana</A>
+            <DT><A HREF="https://alerts.example.com/">Alerts</A>
+        </DL><p>
+        <DT><A HREF="https://wiki.example.com/">Wiki</A>
+    </DL><p>
+    <DT><A HREF="https://news.example.com/">News</A>
+</DL><p>
+`
+
+func TestNetscapeBookmarks(t *testing.T) {
+	f := newRouteFixture(t)
+	if rec := f.upload(t, "/api/admin/import?format=netscape", "admin", "bookmarks.html", []byte(browserBookmarks)); rec.Code != http.StatusOK {
+		t.Fatalf("import bookmarks returned %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Folders become groups in their order, bookmarks outside of folders go to their own group
+	data := f.exportGroups(t, "admin")
+	var got []string
+	for _, group := range data.LinkGroups {
+		names := make([]string, len(group.Links))
+		for i, link := range group.Links {
+			names[i] = link.Name
+		}
+		got = append(got, fmt.Sprintf("%s(%d)%v", group.Name, group.SortOrder, names))
+	}
+	want := []string{"Bookmarks bar(1)[Mail & Calendar Wiki]", "Monitoring(1)[Grafana Alerts]", "Bookmarks(2)[News]"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("imported groups %v, want %v", got, want)
+	}
+	if data.LinkGroups[1].ParentID != data.LinkGroups[0].ID {
+		t.Errorf("Monitoring is not nested in Bookmarks bar")
+	}
+	mail := data.LinkGroups[0].Links[0]
+	if mail.URL != "https://mail.example.com/" || mail.Description != "Team inbox" || strings.Join(mail.Tags, ",") != "daily,mail" {
+		t.Errorf("imported bookmark %+v", mail)
+	}
+	if data.LinkGroups[1].Links[0].IconData == "" {
+		t.Errorf("icon of Grafana not imported")
+	}
+
+	// The deck exported as bookmarks imports into another deck as the same groups
+	rec := f.do(http.MethodGet, "/api/admin/export?format=netscape", "admin", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "<!DOCTYPE NETSCAPE-Bookmark-file-1>") {
+		t.Fatalf("export bookmarks returned %d %s", rec.Code, rec.Body.String())
+	}
+	target := newRouteFixture(t)
+	if rec := target.upload(t, "/api/admin/import?format=netscape", "admin", "bookmarks.html", rec.Body.Bytes()); rec.Code != http.StatusOK {
+		t.Fatalf("import exported bookmarks returned %d %s", rec.Code, rec.Body.String())
+	}
+	assertSameGroups(t, withoutIDs(target.exportGroups(t, "admin")), withoutIDs(data))
+
+	if rec := f.upload(t, "/api/admin/import?format=netscape", "admin", "bookmarks.html", []byte("<p>Not bookmarks</p>")); rec.Code != http.StatusBadRequest {
+		t.Errorf("import of a file without bookmarks returned %d, want 400", rec.Code)
+	}
+}
+
+// assertSameGroups fails the test unless the exported groups match
+func assertSameGroups(t *testing.T, got, want []handlers.ExportLinkGroup) {
+	t.Helper()
+
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("groups after import\n got %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+// mustGroupID returns the ID of the group with the given name owned by username
+func mustGroupID(t *testing.T, store models.Store, username, name string) int64 {
+	t.Helper()
+
+	groups, err := store.GetAllLinkGroups(mustUserID(t, store, username))
+	if err != nil {
+		t.Fatalf("get groups of %s: %v", username, err)
+	}
+	for _, group := range groups {
+		if group.Name == name {
+			return group.ID
+		}
+	}
+	t.Fatalf("%s has no group %s", username, name)
+	return 0
+}
+
+// mustUserID returns the ID of the user with the given username
+func mustUserID(t *testing.T, store models.Store, username string) int64 {
+	t.Helper()
+
+	user, err := store.GetUserByUsername(username)
+	if err != nil {
+		t.Fatalf("get user %s: %v", username, err)
+	}
+	return user.ID
+}
+
+func TestLinkIcons(t *testing.T) {
+	icoIcon := []byte("\x00\x00\x01\x00\x01\x00\x10\x10")
+	requests := make(map[string]int)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><title>Site</title></head></html>`))
+		case "/favicon.ico":
+			w.Write(icoIcon)
+		case "/logo.png":
+			w.Write(pngIcon)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	f := newRouteFixture(t)
+	// The site runs on a loopback address, which is refused by default
+	iconConfig := icons.DefaultConfig()
+	iconConfig.AllowPrivateAddresses = true
+	f.srv.handler.Icons = icons.NewFetcher(iconConfig)
+	body := `{"group_id":{group},"name":"Site","url":"` + site.URL + `/","sort_order":2}`
+	if rec := f.do(http.MethodPost, "/api/admin/links", "editor", body); rec.Code != http.StatusCreated {
+		t.Fatalf("create link returned %d", rec.Code)
+	}
+
+	// getIcon returns the icon URL of the link named Site and the response to it
+	getIcon := func(t *testing.T, header string) (models.Link, *httptest.ResponseRecorder) {
+		t.Helper()
+		var groups []models.LinkGroup
+		rec := f.do(http.MethodGet, "/api/links", "viewer", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil || len(groups) != 1 {
+			t.Fatalf("viewer sees %s", rec.Body.String())
+		}
+		for _, link := range groups[0].Links {
+			if link.Name != "Site" {
+				continue
+			}
+			req := httptest.NewRequest(http.MethodGet, link.IconURL, nil)
+			if header != "" {
+				req.Header.Set("If-None-Match", header)
+			}
+			rec := httptest.NewRecorder()
+			f.srv.ServeHTTP(rec, req)
+			return link, rec
+		}
+		t.Fatalf("link Site not found in %s", rec.Body.String())
+		return models.Link{}, nil
+	}
+
+	// The favicon of the site is fetched once and then cached
+	link, rec := getIcon(t, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/x-icon" || !bytes.Equal(rec.Body.Bytes(), icoIcon) {
+		t.Fatalf("favicon returned %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	etag := rec.Header().Get("ETag")
+	if _, rec := getIcon(t, etag); rec.Code != http.StatusNotModified {
+		t.Errorf("icon with a matching ETag returned %d, want 304", rec.Code)
+	}
+	if requests["/favicon.ico"] != 1 {
+		t.Errorf("favicon fetched %d times, want once", requests["/favicon.ico"])
+	}
+
+	// Uploads replace the favicon and change the icon URL
+	linkPath := "/api/admin/links/" + strconv.FormatInt(link.ID, 10)
+	if rec := f.upload(t, linkPath+"/icon", "editor", "icon.txt", []byte("not an image")); rec.Code != http.StatusBadRequest {
+		t.Errorf("upload of text returned %d, want 400", rec.Code)
+	}
+	if rec := f.upload(t, linkPath+"/icon", "editor", "icon.png", pngIcon); rec.Code != http.StatusOK {
+		t.Fatalf("upload returned %d: %s", rec.Code, rec.Body.String())
+	}
+	uploaded, rec := getIcon(t, "")
+	if !uploaded.IconUploaded || uploaded.IconURL == link.IconURL || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("uploaded icon %+v returned %q", uploaded, rec.Header().Get("Content-Type"))
+	}
+	// The icon URL handed out before the upload is no longer signed for the link
+	stale := httptest.NewRecorder()
+	f.srv.ServeHTTP(stale, httptest.NewRequest(http.MethodGet, link.IconURL, nil))
+	if stale.Code != http.StatusNotFound {
+		t.Errorf("icon URL of before the upload returned %d, want 404", stale.Code)
+	}
+
+	// Another upload changes the icon URL at once, other changes of the link keep it
+	if rec := f.upload(t, linkPath+"/icon", "editor", "icon.png", append(pngIcon, 0)); rec.Code != http.StatusOK {
+		t.Fatalf("second upload returned %d: %s", rec.Code, rec.Body.String())
+	}
+	reuploaded, _ := getIcon(t, "")
+	if reuploaded.IconURL == uploaded.IconURL {
+		t.Error("icon URL unchanged by a second upload")
+	}
+	body = `{"ids":[` + strconv.FormatInt(link.ID, 10) + `]}`
+	if rec := f.do(http.MethodPost, "/api/admin/link-groups/{group}/links/reorder", "editor", body); rec.Code != http.StatusOK {
+		t.Fatalf("reorder returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if reordered, _ := getIcon(t, ""); reordered.IconURL != reuploaded.IconURL {
+		t.Errorf("icon URL changed by a reorder from %s to %s", reuploaded.IconURL, reordered.IconURL)
+	}
+
+	// An icon URL replaces the upload
+	body = `{"group_id":{group},"name":"Site","url":"` + site.URL + `/","icon":"` + site.URL + `/logo.png"}`
+	if rec := f.do(http.MethodPut, linkPath, "editor", body); rec.Code != http.StatusOK {
+		t.Fatalf("set icon URL returned %d", rec.Code)
+	}
+	if link, rec := getIcon(t, ""); link.IconUploaded || rec.Header().Get("Content-Type") != "image/png" || requests["/logo.png"] != 1 {
+		t.Errorf("icon URL %+v returned %q after %v", link, rec.Header().Get("Content-Type"), requests)
+	}
+
+	// Removing the icon fetches it again
+	if rec := f.do(http.MethodDelete, linkPath+"/icon", "editor", ""); rec.Code != http.StatusOK {
+		t.Fatalf("remove icon returned %d", rec.Code)
+	}
+	if _, rec := getIcon(t, ""); rec.Code != http.StatusOK || requests["/logo.png"] != 2 {
+		t.Errorf("icon after removing returned %d after %v", rec.Code, requests)
+	}
+}
+
+func TestLinkHealth(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/up" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	f := newRouteFixture(t)
+	for _, body := range []string{
+		`{"group_id":{group},"name":"Up","url":"` + site.URL + `/up"}`,
+		`{"group_id":{group},"name":"Down","url":"` + site.URL + `/down"}`,
+	} {
+		if rec := f.do(http.MethodPost, "/api/admin/links", "editor", body); rec.Code != http.StatusCreated {
+			t.Fatalf("create link returned %d", rec.Code)
+		}
+	}
+	// The fixture's other links point at example.com and example.org, which the test must not reach
+	store := &localLinks{Store: f.store, prefix: site.URL}
+	if err := health.NewChecker(health.Config{TimeoutSeconds: 2}).CheckAll(context.Background(), store); err != nil {
+		t.Fatalf("check links: %v", err)
+	}
+
+	var entries []handlers.LinkHealthEntry
+	rec := f.do(http.MethodGet, "/api/admin/links/health", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil || len(entries) != 3 {
+		t.Fatalf("link health returned %d %s", rec.Code, rec.Body.String())
+	}
+	if entries[0].Name != "Down" || entries[0].Status != "down" || entries[0].Health.StatusCode != http.StatusNotFound {
+		t.Errorf("first entry %+v, want the link that is down", entries[0])
+	}
+	if entries[1].Status != "unchecked" || entries[2].Name != "Up" || entries[2].Health.StatusCode != http.StatusOK {
+		t.Errorf("entries %+v, want the unchecked link before the one that is up", entries)
+	}
+
+	rec = f.do(http.MethodGet, "/api/admin/links/health?status=up", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].Name != "Up" {
+		t.Errorf("links that are up %s", rec.Body.String())
+	}
+
+	// Links carry their health wherever they are returned
+	var groups []models.LinkGroup
+	rec = f.do(http.MethodGet, "/api/links", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("get links: %v", err)
+	}
+	for _, link := range groups[0].Links {
+		if link.Name == "Up" && (link.Health == nil || link.Health.CheckedAt.IsZero()) {
+			t.Errorf("link without its health %+v", link)
+		}
+	}
+}
+
+func TestClickTracking(t *testing.T) {
+	f := newRouteFixture(t)
+
+	// Links are returned with redirect URLs signed for the user
+	var groups []models.LinkGroup
+	rec := f.do(http.MethodGet, "/api/links", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil || len(groups) == 0 || len(groups[0].Links) == 0 {
+		t.Fatalf("get links returned %d %s", rec.Code, rec.Body.String())
+	}
+	clickURL := groups[0].Links[0].ClickURL
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, clickURL, nil)
+		req.Header.Set("Referer", "https://wiki.example.com/runbook")
+		rec = httptest.NewRecorder()
+		f.srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://example.com" {
+			t.Fatalf("click URL %s returned %d to %q", clickURL, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	var links []handlers.LinkClicks
+	rec = f.do(http.MethodGet, "/api/admin/analytics/links", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &links); err != nil || len(links) != 1 {
+		t.Fatalf("link analytics returned %d %s", rec.Code, rec.Body.String())
+	}
+	if links[0].Name != "Example" || links[0].Clicks != 2 {
+		t.Errorf("link analytics %+v, want 2 clicks on Example", links)
+	}
+	// Other users' links are not counted for the editor
+	rec = f.do(http.MethodGet, "/api/admin/analytics/links", "admin", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &links); err != nil || len(links) != 0 {
+		t.Errorf("admin link analytics %s, want none of the editor's links", rec.Body.String())
+	}
+
+	var groupClicks []handlers.GroupClicks
+	rec = f.do(http.MethodGet, "/api/admin/analytics/groups", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &groupClicks); err != nil || len(groupClicks) != 2 {
+		t.Fatalf("group analytics returned %d %s", rec.Code, rec.Body.String())
+	}
+	if groupClicks[0].Name != "Editor group" || groupClicks[0].Clicks != 2 || groupClicks[1].TotalClicks != 0 {
+		t.Errorf("group analytics %+v", groupClicks)
+	}
+
+	var history handlers.LinkClickHistory
+	rec = f.do(http.MethodGet, "/api/admin/analytics/links/{link}?days=3", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil || len(history.Daily) != 3 {
+		t.Fatalf("click history returned %d %s", rec.Code, rec.Body.String())
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	if history.Clicks != 2 || history.Daily[2].Date != today || history.Daily[2].Clicks != 2 || history.Daily[0].Clicks != 0 {
+		t.Errorf("click history %+v, want 2 clicks today", history)
+	}
+}
+
+func TestClickURLAccess(t *testing.T) {
+	f := newRouteFixture(t)
+	groupID := mustGroupID(t, f.store, "editor", "Editor group")
+	viewerID := mustUserID(t, f.store, "viewer")
+
+	// clickURL returns the redirect URL of the link Example listed at path
+	clickURL := func(path, as string) string {
+		t.Helper()
+		var groups []models.LinkGroup
+		rec := f.do(http.MethodGet, path, as, "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil {
+			t.Fatalf("get %s returned %d %s", path, rec.Code, rec.Body.String())
+		}
+		for _, group := range models.FlattenLinkGroups(groups) {
+			for _, link := range group.Links {
+				if link.Name == "Example" {
+					return link.ClickURL
+				}
+			}
+		}
+		t.Fatalf("link Example not listed at %s: %s", path, rec.Body.String())
+		return ""
+	}
+	// open returns the status of following a redirect URL
+	open := func(url string) int {
+		rec := httptest.NewRecorder()
+		f.srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec.Code
+	}
+
+	// Visitors' URLs stop working when the group is no longer public
+	if err := f.store.UpdateLinkGroup(groupID, "Editor group", 1, models.VisibilityPublic); err != nil {
+		t.Fatalf("update group: %v", err)
+	}
+	public := clickURL("/api/public/links", "")
+	if code := open(public); code != http.StatusFound {
+		t.Fatalf("visitor URL of a public group returned %d", code)
+	}
+	if err := f.store.UpdateLinkGroup(groupID, "Editor group", 1, models.VisibilityPrivate); err != nil {
+		t.Fatalf("update group: %v", err)
+	}
+	if code := open(public); code != http.StatusNotFound {
+		t.Errorf("visitor URL of a group made private returned %d, want 404", code)
+	}
+
+	// Users' URLs stop working when the share is revoked, or the user is disabled or deleted
+	viewer := clickURL("/api/links", "viewer")
+	if code := open(viewer); code != http.StatusFound {
+		t.Fatalf("viewer URL returned %d", code)
+	}
+	if err := f.store.DeleteGroupShare(groupID, mustID(t)(strconv.ParseInt(f.ids.Replace("{share}"), 10, 64))); err != nil {
+		t.Fatalf("delete share: %v", err)
+	}
+	if code := open(viewer); code != http.StatusNotFound {
+		t.Errorf("viewer URL after revoking the share returned %d, want 404", code)
+	}
+	if _, err := f.store.ShareGroupWithUser(groupID, viewerID, models.PermissionRead); err != nil {
+		t.Fatalf("share group: %v", err)
+	}
+	if err := f.store.SetUserDisabled(viewerID, true); err != nil {
+		t.Fatalf("disable viewer: %v", err)
+	}
+	if code := open(viewer); code != http.StatusNotFound {
+		t.Errorf("viewer URL of a disabled user returned %d, want 404", code)
+	}
+	if err := f.store.DeleteUser(viewerID); err != nil {
+		t.Fatalf("delete viewer: %v", err)
+	}
+	if code := open(viewer); code != http.StatusNotFound {
+		t.Errorf("viewer URL of a deleted user returned %d, want 404", code)
+	}
+}
+
+func TestDisableTwoFactorIsThrottled(t *testing.T) {
+	f := newRouteFixture(t)
+	editorID := mustUserID(t, f.store, "editor")
+	key, err := f.store.StartTOTPEnrollment(editorID, "editor")
+	if err != nil {
+		t.Fatalf("start enrollment: %v", err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	if _, ok, err := f.store.EnableTOTP(editorID, code); err != nil || !ok {
+		t.Fatalf("enable two-factor auth: %v %v", ok, err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	// Guessing the code with a stolen access token runs into the login throttle
+	throttled := false
+	for i := 0; i < 10 && !throttled; i++ {
+		rec := f.do(http.MethodDelete, "/api/admin/2fa", "editor", `{"code":"`+wrong+`"}`)
+		switch rec.Code {
+		case http.StatusBadRequest:
+		case http.StatusTooManyRequests:
+			throttled = rec.Header().Get("Retry-After") != ""
+		default:
+			t.Fatalf("wrong code returned %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	if !throttled {
+		t.Fatal("wrong codes were never throttled")
+	}
+
+	// Even the right code waits, two-factor auth stays on
+	if rec := f.do(http.MethodDelete, "/api/admin/2fa", "editor", `{"code":"`+code+`"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("right code while throttled returned %d, want 429", rec.Code)
+	}
+	if user, err := f.store.GetUserByID(editorID); err != nil || !user.TwoFactor {
+		t.Errorf("editor after the guesses %+v, %v", user, err)
+	}
+}
+
+func TestGoLinks(t *testing.T) {
+	f := newRouteFixture(t)
+	body := `{"group_id":{group},"name":"Pull requests","url":"https://git.example.com/pull/{n}","alias":"pr/{n}"}`
+	if rec := f.do(http.MethodPost, "/api/admin/links", "editor", body); rec.Code != http.StatusCreated {
+		t.Fatalf("create link returned %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Viewers of the group can use its aliases
+	var target handlers.AliasTarget
+	rec := f.do(http.MethodGet, "/api/go/pr/42", "viewer", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &target); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("resolve alias returned %d %s", rec.Code, rec.Body.String())
+	}
+	if target.URL != "https://git.example.com/pull/42" || target.Alias != "pr/{n}" {
+		t.Errorf("resolved pr/42 to %+v", target)
+	}
+
+	var notFound struct {
+		Suggestions []string `json:"suggestions"`
+	}
+	rec = f.do(http.MethodGet, "/api/go/pr", "viewer", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &notFound); err != nil || rec.Code != http.StatusNotFound {
+		t.Fatalf("resolve pr returned %d %s", rec.Code, rec.Body.String())
+	}
+	if len(notFound.Suggestions) != 1 || notFound.Suggestions[0] != "pr/{n}" {
+		t.Errorf("suggestions for pr %v", notFound.Suggestions)
+	}
+
+	// Links stored with other schemes than http and https, e.g. before they were rejected, are never resolved
+	evilID, err := f.store.CreateLink(mustGroupID(t, f.store, "editor", "Editor group"), "Evil", "javascript:alert(document.cookie)", 9)
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if err := f.store.SetLinkAlias(evilID, "evil"); err != nil {
+		t.Fatalf("set link alias: %v", err)
+	}
+	if rec := f.do(http.MethodGet, "/api/go/evil", "viewer", ""); rec.Code != http.StatusNotFound || strings.Contains(rec.Body.String(), "javascript") {
+		t.Errorf("resolve evil returned %d %s, want 404", rec.Code, rec.Body.String())
+	}
+
+	// Following an alias counts as a click
+	var links []handlers.LinkClicks
+	rec = f.do(http.MethodGet, "/api/admin/analytics/links?limit=1", "editor", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &links); err != nil || len(links) != 1 || links[0].Name != "Pull requests" || links[0].Clicks != 1 {
+		t.Errorf("link analytics %s, want the click through the alias", rec.Body.String())
+	}
+}
+
+// localLinks only hands the links starting with prefix to the health checker
+type localLinks struct {
+	models.Store
+	prefix string
+}
+
+func (s *localLinks) GetLinkURLs() ([]models.LinkURL, error) {
+	urls, err := s.Store.GetLinkURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	local := []models.LinkURL{}
+	for _, url := range urls {
+		if strings.HasPrefix(url.URL, s.prefix) {
+			local = append(local, url)
+		}
+	}
+	return local, nil
+}
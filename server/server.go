@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/auth"
+	"github.com/yongliucc/link-deck/handlers"
+	"github.com/yongliucc/link-deck/health"
+	"github.com/yongliucc/link-deck/icons"
+	"github.com/yongliucc/link-deck/middleware"
+	"github.com/yongliucc/link-deck/models"
+)
+
+// Server serves the link-deck API for one config and store
+type Server struct {
+	config  *Config
+	store   models.Store
+	router  *gin.Engine
+	handler *handlers.Handler
+}
+
+// New sets up a server with the login methods of config, serving the data of store.
+// The store must be migrated already. Single sign-on discovers the issuer, which needs network access.
+func New(config *Config, store models.Store) (*Server, error) {
+	h := &handlers.Handler{
+		Store:    store,
+		Auth:     middleware.NewAuth(config.Auth.JWTSecret, store),
+		Throttle: auth.NewThrottle(config.Auth.Throttle),
+		Icons:    icons.NewFetcher(config.Icons),
+	}
+
+	// Discover the OpenID Connect issuer if single sign-on is enabled
+	if config.Auth.OIDC.Enabled {
+		provider, err := auth.NewOIDCProvider(context.Background(), config.Auth.OIDC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up OIDC: %w", err)
+		}
+		h.OIDC = provider
+		log.Printf("OIDC single sign-on enabled with issuer %s", config.Auth.OIDC.Issuer)
+	}
+
+	// Username and password logins are checked against local users, then LDAP
+	var authenticators auth.Chain
+	if !config.Auth.DisablePasswordLogin {
+		authenticators = append(authenticators, auth.LocalAuthenticator{Store: store})
+	}
+	if config.Auth.LDAP.Enabled {
+		ldapAuthenticator, err := auth.NewLDAPAuthenticator(config.Auth.LDAP, store)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up LDAP: %w", err)
+		}
+		authenticators = append(authenticators, ldapAuthenticator)
+		log.Printf("LDAP authentication enabled with directory %s", config.Auth.LDAP.URL)
+	}
+	if len(authenticators) > 0 {
+		h.Authenticator = authenticators
+	}
+	if h.Authenticator == nil && h.OIDC == nil {
+		return nil, errors.New("password login is disabled but no other login method is enabled")
+	}
+
+	s := &Server{
+		config:  config,
+		store:   store,
+		router:  gin.Default(),
+		handler: h,
+	}
+
+	// Only take client addresses from X-Forwarded-For if it was set by a known proxy,
+	// otherwise clients could pick their address to get around login throttling
+	if s.config.Server.TrustedProxies != nil {
+		if err := s.router.SetTrustedProxies(s.config.Server.TrustedProxies); err != nil {
+			return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+		}
+	}
+
+	// Log middleware (only in debug mode)
+	if gin.Mode() == gin.DebugMode {
+		s.router.Use(func(c *gin.Context) {
+			// Log request details
+			log.Printf("Request: %s %s", c.Request.Method, c.Request.URL.Path)
+
+			// Log headers in debug mode
+			log.Printf("Headers:")
+			for key, values := range c.Request.Header {
+				log.Printf("  %s: %v", key, values)
+			}
+
+			// Proceed with request
+			c.Next()
+
+			// Log response status
+			log.Printf("Response: %d", c.Writer.Status())
+
+			// Log response headers
+			log.Printf("Response Headers:")
+			for key, values := range c.Writer.Header() {
+				log.Printf("  %s: %v", key, values)
+			}
+		})
+	}
+
+	// Enable CORS
+	s.router.Use(func(c *gin.Context) {
+		// Get origin
+		origin := c.Request.Header.Get("Origin")
+
+		// Check if origin is allowed
+		allowedOrigin := "*"
+		if len(s.config.Server.CORS.AllowedOrigins) > 0 {
+			if origin != "" {
+				allowed := false
+				for _, allowedOrigin := range s.config.Server.CORS.AllowedOrigins {
+					if allowedOrigin == "*" || allowedOrigin == origin {
+						allowed = true
+						break
+					}
+				}
+
+				if allowed {
+					allowedOrigin = origin
+				} else {
+					allowedOrigin = s.config.Server.CORS.AllowedOrigins[0]
+				}
+			}
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", strings.Join(s.config.Server.CORS.AllowedMethods, ", "))
+		c.Writer.Header().Set("Access-Control-Allow-Headers", strings.Join(s.config.Server.CORS.AllowedHeaders, ", "))
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	})
+
+	s.registerRoutes()
+	return s, nil
+}
+
+// registerRoutes adds the API routes to the router
+func (s *Server) registerRoutes() {
+	h := s.handler
+
+	// Opens links and counts the clicks, browsers navigate here without a token so the URLs are signed
+	s.router.GET("/r/:linkId", h.RedirectLink)
+
+	// API routes
+	api := s.router.Group("/api")
+	{
+		// Public routes - login, plus public link groups when public mode is enabled
+		api.GET("/auth/methods", h.GetLoginMethods)
+		if h.Authenticator != nil {
+			api.POST("/login", h.Login)
+			api.POST("/login/2fa", h.LoginTwoFactor)
+		}
+		api.POST("/refresh", h.Refresh)
+		if h.OIDC != nil {
+			api.GET("/auth/oidc/login", h.OIDCLogin)
+			api.GET("/auth/oidc/callback", h.OIDCCallback)
+		}
+		// Icons are loaded by img tags without a token, their URLs are signed instead
+		api.GET("/icons/:id", h.GetLinkIcon)
+		if s.config.Server.Public.Enabled {
+			log.Println("Public mode enabled, serving public link groups without login")
+			api.GET("/public/links", h.GetPublicLinkGroups)
+		}
+
+		// All other routes are protected
+		protected := api.Group("")
+		protected.Use(h.Auth.AuthMiddleware())
+		{
+			// Ends the session of the access token
+			protected.POST("/logout", h.Logout)
+
+			// Links route - now protected, readable by every role
+			protected.GET("/links", h.GetAllLinkGroups)
+
+			// Searches the links the user can read
+			protected.GET("/search", h.SearchLinks)
+
+			// Resolves go-links, the UI serves /go/<alias> and follows them
+			protected.GET("/go/*alias", h.ResolveAlias)
+
+			// Admin routes
+			admin := protected.Group("/admin")
+			{
+				// Account routes need a login, API tokens cannot use them
+				account := admin.Group("")
+				account.Use(middleware.RequireSession())
+				{
+					// Every user may change their own password
+					account.POST("/change-password", h.ChangePassword)
+
+					// Every user may manage their own API tokens
+					account.GET("/tokens", h.GetAPITokens)
+					account.POST("/tokens", h.CreateAPIToken)
+					account.DELETE("/tokens/:tokenId", h.DeleteAPIToken)
+
+					// Every user may set up two-factor auth for their own login
+					account.GET("/2fa", h.GetTwoFactorStatus)
+					account.POST("/2fa/enroll", h.EnrollTwoFactor)
+					account.POST("/2fa/activate", h.ActivateTwoFactor)
+					account.DELETE("/2fa", h.DisableTwoFactor)
+				}
+
+				// Editor routes
+				editor := admin.Group("")
+				editor.Use(middleware.RequireRole(models.RoleEditor))
+				{
+					// Link group routes
+					editor.GET("/link-groups", h.GetAllLinkGroups)
+					editor.POST("/link-groups", h.CreateLinkGroup)
+					editor.POST("/link-groups/reorder", h.ReorderLinkGroups)
+					editor.PUT("/link-groups/:id", h.UpdateLinkGroup)
+					editor.DELETE("/link-groups/:id", h.DeleteLinkGroup)
+
+					// Link group sharing routes
+					editor.GET("/link-groups/:id/shares", h.GetGroupShares)
+					editor.POST("/link-groups/:id/shares", h.CreateGroupShare)
+					editor.DELETE("/link-groups/:id/shares/:shareId", h.DeleteGroupShare)
+
+					// Link routes
+					editor.GET("/link-groups/:id/links", h.GetLinksByGroupID)
+					editor.POST("/link-groups/:id/links/reorder", h.ReorderLinks)
+					editor.POST("/links", h.CreateLink)
+					editor.GET("/links/health", h.GetLinksHealth)
+					editor.PUT("/links/:id", h.UpdateLink)
+					editor.DELETE("/links/:id", h.DeleteLink)
+					editor.POST("/links/:id/icon", h.UploadLinkIcon)
+					editor.DELETE("/links/:id/icon", h.DeleteLinkIcon)
+
+					// Click analytics of the links the user can read
+					editor.GET("/analytics/links", h.GetLinkAnalytics)
+					editor.GET("/analytics/links/:id", h.GetLinkClickHistory)
+					editor.GET("/analytics/groups", h.GetGroupAnalytics)
+				}
+
+				// Admin-only routes
+				adminOnly := admin.Group("")
+				adminOnly.Use(middleware.RequireRole(models.RoleAdmin), h.Auth.RequireAdminTwoFactor())
+				{
+					// User routes
+					adminOnly.GET("/users", h.GetAllUsers)
+					adminOnly.POST("/users", h.CreateUser)
+					adminOnly.PUT("/users/:id", h.UpdateUser)
+					adminOnly.DELETE("/users/:id", h.DeleteUser)
+					adminOnly.DELETE("/users/:id/2fa", h.ResetUserTwoFactor)
+
+					// Session routes
+					adminOnly.GET("/users/:id/sessions", h.GetUserSessions)
+					adminOnly.DELETE("/users/:id/sessions", h.RevokeUserSessions)
+					adminOnly.DELETE("/users/:id/sessions/:sessionId", h.RevokeUserSession)
+
+					// API token routes
+					adminOnly.GET("/users/:id/tokens", h.GetUserAPITokens)
+					adminOnly.DELETE("/users/:id/tokens/:tokenId", h.DeleteUserAPIToken)
+
+					// Team routes
+					adminOnly.GET("/teams", h.GetAllTeams)
+					adminOnly.POST("/teams", h.CreateTeam)
+					adminOnly.DELETE("/teams/:id", h.DeleteTeam)
+					adminOnly.POST("/teams/:id/members", h.AddTeamMember)
+					adminOnly.DELETE("/teams/:id/members/:username", h.RemoveTeamMember)
+
+					// Settings routes
+					adminOnly.GET("/settings", h.GetSettings)
+					adminOnly.PUT("/settings", h.UpdateSettings)
+
+					// Import/Export routes
+					adminOnly.GET("/export", h.ExportLinkGroups)
+					adminOnly.POST("/import", h.ImportLinkGroups)
+				}
+			}
+		}
+	}
+}
+
+// ServeUI serves the single page app built into dir, e.g. ./ui/dist,
+// for every path that is not an API route
+func (s *Server) ServeUI(dir string) {
+	// Serve static files from the UI build directory
+	s.router.StaticFS("/assets", http.Dir(filepath.Join(dir, "assets")))
+	s.router.StaticFile("/favicon.ico", filepath.Join(dir, "favicon.ico"))
+
+	// Handle any routes that don't match static files
+	s.router.NoRoute(func(c *gin.Context) {
+		// Unknown API routes, such as public links with public mode disabled, are not SPA pages
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		if gin.Mode() == gin.DebugMode {
+			log.Printf("No route found for %s, serving index.html", c.Request.URL.Path)
+		}
+		// Serve the index.html for any unmatched routes (for SPA routing)
+		c.File(filepath.Join(dir, "index.html"))
+	})
+}
+
+// ServeHTTP lets the server handle requests directly, e.g. in tests with httptest
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Run listens on addr, e.g. ":8080", and serves requests until it fails.
+// The health of links is checked in the background meanwhile, unless disabled.
+func (s *Server) Run(addr string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !s.config.Health.DisableChecks {
+		go health.NewChecker(s.config.Health).Run(ctx, s.store)
+	}
+
+	return s.router.Run(addr)
+}
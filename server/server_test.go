@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yongliucc/link-deck/auth"
+	"github.com/yongliucc/link-deck/auth/oidctest"
+	"github.com/yongliucc/link-deck/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// Hashing at the production cost would make the tests slow
+	models.BcryptCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+// newTestServer returns a server with its own in-memory store holding the default admin
+func newTestServer(t *testing.T, config *Config) (*Server, models.Store) {
+	t.Helper()
+
+	store, err := models.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("open memory store: %v", err)
+	}
+
+	return startTestServer(t, config, store), store
+}
+
+// newSQLiteTestServer returns a server with a store in a temporary SQLite file holding the default admin
+func newSQLiteTestServer(t *testing.T, config *Config) (*Server, models.Store) {
+	t.Helper()
+
+	store, err := models.NewSQLiteStore(filepath.Join(t.TempDir(), "linkdeck.db"))
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	if _, err := store.Migrate(-1, false); err != nil {
+		store.Close()
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return startTestServer(t, config, store), store
+}
+
+// startTestServer seeds the default admin into store and returns a server using it.
+// The store is closed when the test ends.
+func startTestServer(t *testing.T, config *Config, store models.Store) *Server {
+	t.Helper()
+
+	t.Cleanup(func() { store.Close() })
+	if err := models.SeedAdmin(store); err != nil {
+		t.Fatalf("seed admin: %v", err)
+	}
+
+	if config == nil {
+		config = DefaultConfig()
+	}
+	srv, err := New(config, store)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+
+	return srv
+}
+
+// doJSON sends a request with an optional JSON body and bearer token and decodes the JSON response into out
+func doJSON(t *testing.T, srv http.Handler, method, path, token string, body, out any) int {
+	t.Helper()
+
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+
+	return rec.Code
+}
+
+// login logs in and returns the access token
+func login(t *testing.T, srv http.Handler, username, password string) string {
+	t.Helper()
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"username": username, "password": password}
+	if code := doJSON(t, srv, http.MethodPost, "/api/login", "", body, &resp); code != http.StatusOK || resp.Token == "" {
+		t.Fatalf("login as %s returned %d", username, code)
+	}
+
+	return resp.Token
+}
+
+func TestLoginAndCreateLinkGroup(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	token := login(t, srv, "admin", "admin")
+
+	code := doJSON(t, srv, http.MethodPost, "/api/admin/link-groups", token, map[string]any{"name": "Work"}, nil)
+	if code != http.StatusCreated {
+		t.Fatalf("create group returned %d", code)
+	}
+
+	var groups []models.LinkGroup
+	if code := doJSON(t, srv, http.MethodGet, "/api/links", token, nil, &groups); code != http.StatusOK {
+		t.Fatalf("get links returned %d", code)
+	}
+	if len(groups) != 1 || groups[0].Name != "Work" {
+		t.Errorf("unexpected groups %+v", groups)
+	}
+}
+
+func TestServersAreIndependent(t *testing.T) {
+	first := DefaultConfig()
+	first.Auth.JWTSecret = "first-secret"
+	second := DefaultConfig()
+	second.Auth.JWTSecret = "second-secret"
+
+	srv1, store1 := newTestServer(t, first)
+	srv2, _ := newTestServer(t, second)
+
+	if _, err := store1.CreateUser("alice", "password", models.RoleViewer); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	login(t, srv1, "alice", "password")
+
+	// The user only exists in the store of the first server
+	body := map[string]string{"username": "alice", "password": "password"}
+	if code := doJSON(t, srv2, http.MethodPost, "/api/login", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("login on the second server returned %d, want 401", code)
+	}
+
+	// Tokens are signed with the secret of their server
+	token := login(t, srv1, "admin", "admin")
+	if code := doJSON(t, srv2, http.MethodGet, "/api/links", token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("token of the first server returned %d on the second, want 401", code)
+	}
+}
+
+func TestPublicModeRoute(t *testing.T) {
+	private, _ := newTestServer(t, nil)
+	if code := doJSON(t, private, http.MethodGet, "/api/public/links", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("public links without public mode returned %d, want 404", code)
+	}
+
+	config := DefaultConfig()
+	config.Server.Public.Enabled = true
+	public, _ := newTestServer(t, config)
+	var groups []models.LinkGroup
+	if code := doJSON(t, public, http.MethodGet, "/api/public/links", "", nil, &groups); code != http.StatusOK {
+		t.Errorf("public links in public mode returned %d, want 200", code)
+	}
+}
+
+func TestNewRequiresLoginMethod(t *testing.T) {
+	store, err := models.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("open memory store: %v", err)
+	}
+	defer store.Close()
+
+	config := DefaultConfig()
+	config.Auth.DisablePasswordLogin = true
+	if _, err := New(config, store); err == nil {
+		t.Error("server without any login method was created")
+	}
+}
+
+// oidcLogin starts single sign-on and returns the state and nonce cookies with the state sent to the IdP
+func oidcLogin(t *testing.T, srv http.Handler) ([]*http.Cookie, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("OIDC login returned %d", rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse IdP redirect: %v", err)
+	}
+
+	return rec.Result().Cookies(), location.Query().Get("state")
+}
+
+// oidcCallback returns from the IdP with query and returns the values the login page is redirected with
+func oidcCallback(t *testing.T, srv http.Handler, cookies []*http.Cookie, query url.Values) url.Values {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+query.Encode(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	location := rec.Header().Get("Location")
+	if rec.Code != http.StatusFound || !strings.HasPrefix(location, "/login#") {
+		t.Fatalf("OIDC callback returned %d to %q", rec.Code, location)
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(location, "/login#"))
+	if err != nil {
+		t.Fatalf("parse login redirect: %v", err)
+	}
+	return values
+}
+
+// cookieValue returns the value of the cookie named name
+func cookieValue(cookies []*http.Cookie, name string) string {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestOIDCSingleSignOn(t *testing.T) {
+	idp := oidctest.New(t, "link-deck")
+	config := DefaultConfig()
+	config.Auth.OIDC = auth.OIDCConfig{
+		Enabled:     true,
+		Issuer:      idp.URL,
+		ClientID:    idp.ClientID,
+		RedirectURL: "http://localhost/api/auth/oidc/callback",
+		RoleMapping: map[string]string{"admins": models.RoleAdmin, "editors": models.RoleEditor},
+	}
+	srv, store := newTestServer(t, config)
+
+	signIn := func(code string, claims map[string]any, state string) url.Values {
+		t.Helper()
+		cookies, sentState := oidcLogin(t, srv)
+		if claims["nonce"] == nil {
+			claims["nonce"] = cookieValue(cookies, "oidc_nonce")
+		}
+		if state == "" {
+			state = sentState
+		}
+		idp.Issue(code, claims)
+		return oidcCallback(t, srv, cookies, url.Values{"code": {code}, "state": {state}})
+	}
+
+	// The first login creates the user with the role of their IdP groups
+	values := signIn("first", map[string]any{"sub": "u-1", "preferred_username": "alice", "groups": []string{"editors"}}, "")
+	if values.Get("token") == "" || values.Get("username") != "alice" || values.Get("role") != models.RoleEditor {
+		t.Fatalf("first login redirected with %v", values)
+	}
+	if code := doJSON(t, srv, http.MethodGet, "/api/links", values.Get("token"), nil, nil); code != http.StatusOK {
+		t.Errorf("get links with the SSO token returned %d", code)
+	}
+	user, err := store.GetUserByUsername("alice")
+	if err != nil || user.Role != models.RoleEditor || user.AuthProvider != models.AuthProviderOIDC {
+		t.Fatalf("provisioned user %+v, %v", user, err)
+	}
+
+	// Later logins follow the groups at the IdP
+	values = signIn("second", map[string]any{"sub": "u-1", "preferred_username": "alice", "groups": []string{"editors", "admins"}}, "")
+	if values.Get("role") != models.RoleAdmin {
+		t.Errorf("second login redirected with %v, want role admin", values)
+	}
+
+	for name, values := range map[string]url.Values{
+		"state mismatch": signIn("state", map[string]any{"sub": "u-1", "preferred_username": "alice"}, "forged"),
+		"nonce mismatch": signIn("nonce", map[string]any{"sub": "u-1", "preferred_username": "alice", "nonce": "forged"}, ""),
+		// The username of a local account is not taken over
+		"local username": signIn("local", map[string]any{"sub": "u-2", "preferred_username": "admin"}, ""),
+	} {
+		if values.Get("token") != "" || values.Get("error") == "" {
+			t.Errorf("login with %s redirected with %v, want an error", name, values)
+		}
+	}
+
+	if err := store.SetUserDisabled(user.ID, true); err != nil {
+		t.Fatalf("disable user: %v", err)
+	}
+	values = signIn("disabled", map[string]any{"sub": "u-1", "preferred_username": "alice"}, "")
+	if values.Get("token") != "" || values.Get("error") != "Account is disabled" {
+		t.Errorf("login of a disabled user redirected with %v", values)
+	}
+}
@@ -46,7 +46,7 @@ print_success "Frontend built successfully!"
 # Build backend
 print_step "Building Go server..."
 go mod tidy
-go build -ldflags="-s -w" -o bin/link-deck main.go
+go build -tags sqlite_fts5 -ldflags="-s -w" -o bin/link-deck main.go
 if [ $? -ne 0 ]; then
   print_error "Go build failed!"
   exit 1
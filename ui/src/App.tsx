@@ -4,6 +4,7 @@ import { Navigate, Route, BrowserRouter as Router, Routes } from 'react-router-d
 import SessionExpiredNotification from './components/SessionExpiredNotification';
 import { AuthProvider, useAuth } from './contexts/AuthContext';
 import Admin from './pages/Admin';
+import GoLink from './pages/GoLink';
 import Home from './pages/Home';
 import Login from './pages/Login';
 
@@ -30,15 +31,11 @@ function AppRoutes() {
     <>
       <SessionExpiredNotification />
       <Routes>
-        <Route 
-          path="/" 
-          element={
-            <ProtectedRoute>
-              <Home />
-            </ProtectedRoute>
-          } 
-        />
+        {/* Home decides itself whether to show the user's deck or the public deck */}
+        <Route path="/" element={<Home />} />
         <Route path="/login" element={<Login />} />
+        {/* Go-links like /go/pr/123 are resolved by the API and followed */}
+        <Route path="/go/*" element={<GoLink />} />
         <Route 
           path="/admin" 
           element={
@@ -3,13 +3,14 @@ import React, { useRef } from 'react';
 import { Link } from 'react-router-dom';
 
 import { Button } from '@/components/ui/button';
+import { ExportFormat } from '@/lib/api';
 import { AdminView } from './types';
 
 interface HeaderProps {
   username: string;
   onLogout: () => void;
   currentView: AdminView;
-  onExport: () => void;
+  onExport: (format: ExportFormat) => void;
   onImport: (file: File) => void;
   exporting: boolean;
   importing: boolean;
@@ -61,13 +62,24 @@ const Header: React.FC<HeaderProps> = ({
           {(currentView === 'linkGroups' || currentView === 'links') && (
             <>
               <Button 
-                onClick={onExport} 
+                onClick={() => onExport('json')} 
                 className="flex items-center gap-1"
                 disabled={exporting}
               >
                 <Download className="h-4 w-4 mr-2" />
                 {exporting ? 'Exporting...' : 'Export'}
               </Button>
+
+              <Button 
+                onClick={() => onExport('netscape')} 
+                variant="outline"
+                className="flex items-center gap-1"
+                disabled={exporting}
+                title="Export as a bookmarks.html file for browsers"
+              >
+                <Download className="h-4 w-4 mr-2" />
+                Bookmarks
+              </Button>
               
               <Button 
                 onClick={handleImportClick} 
@@ -82,7 +94,7 @@ const Header: React.FC<HeaderProps> = ({
                 type="file"
                 ref={fileInputRef}
                 onChange={handleImportFile}
-                accept="application/json"
+                accept="application/json,.json,text/html,.html,.htm"
                 className="hidden"
               />
             </>
@@ -10,6 +10,8 @@ import { LinkGroup, LinkGroupFormValues, linkGroupSchema } from '../types';
 
 interface LinkGroupFormProps {
   group?: LinkGroup;
+  // Groups the group can be nested below
+  groups: LinkGroup[];
   onSubmit: (data: LinkGroupFormValues) => void;
   onCancel: () => void;
   isEditMode: boolean;
@@ -17,6 +19,7 @@ interface LinkGroupFormProps {
 
 const LinkGroupForm: React.FC<LinkGroupFormProps> = ({ 
   group, 
+  groups,
   onSubmit, 
   onCancel, 
   isEditMode 
@@ -26,6 +29,7 @@ const LinkGroupForm: React.FC<LinkGroupFormProps> = ({
     defaultValues: {
       name: group?.name || '',
       sort_order: group?.sort_order || 0,
+      parent_id: group?.parent_id || 0,
     },
   });
 
@@ -51,6 +55,20 @@ const LinkGroupForm: React.FC<LinkGroupFormProps> = ({
                 <p className="text-sm text-red-500 mt-1">{form.formState.errors.sort_order.message}</p>
               )}
             </div>
+            <div>
+              <label className="block text-sm font-medium mb-1">Parent Group</label>
+              <select
+                className="w-full h-9 px-3 text-sm border border-input rounded-md bg-transparent"
+                {...form.register('parent_id')}
+              >
+                <option value={0}>None (top level)</option>
+                {groups
+                  .filter(g => g.id !== group?.id)
+                  .map(g => (
+                    <option key={g.id} value={g.id}>{g.path || g.name}</option>
+                  ))}
+              </select>
+            </div>
           </div>
           <div className="flex justify-end space-x-2">
             <Button type="button" variant="outline" onClick={onCancel}>
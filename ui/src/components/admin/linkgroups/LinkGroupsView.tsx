@@ -125,6 +125,7 @@ const LinkGroupsView: React.FC<LinkGroupsViewProps> = ({
           {/* Add Group Form */}
           {addingGroupMode && (
             <LinkGroupForm
+              groups={linkGroups}
               onSubmit={handleAddGroup}
               onCancel={handleCancelAdd}
               isEditMode={false}
@@ -135,6 +136,7 @@ const LinkGroupsView: React.FC<LinkGroupsViewProps> = ({
           {editingGroupId !== null && (
             <LinkGroupForm
               group={linkGroups.find(g => g.id === editingGroupId)}
+              groups={linkGroups}
               onSubmit={handleUpdateGroup}
               onCancel={handleCancelEdit}
               isEditMode={true}
@@ -42,11 +42,11 @@ const SortableGroupItem: React.FC<SortableGroupItemProps> = ({
             onClick={() => onViewLinks(group.id)}
             className="flex items-center text-blue-600 hover:underline"
           >
-            {group.name}
+            {group.path || group.name}
             <ExternalLink className="ml-1 h-3 w-3" />
           </button>
         ) : (
-          group.name
+          group.path || group.name
         )}
       </TableCell>
       <TableCell>{group.sort_order}</TableCell>
@@ -6,7 +6,7 @@ import { useForm } from 'react-hook-form';
 import { Button } from '@/components/ui/button';
 import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card';
 import { Input } from '@/components/ui/input';
-import { LinkFormValues, LinkType, linkSchema } from '../types';
+import { formatMetadata, LinkFormValues, LinkType, linkSchema } from '../types';
 
 interface LinkFormProps {
   link?: LinkType;
@@ -27,6 +27,13 @@ const LinkForm: React.FC<LinkFormProps> = ({
       name: link?.name || '',
       url: link?.url || '',
       sort_order: link?.sort_order || 0,
+      tags: (link?.tags || []).join(', '),
+      description: link?.description || '',
+      owner: link?.owner || '',
+      environment: (link?.environment || '') as LinkFormValues['environment'],
+      metadata: formatMetadata(link?.metadata),
+      icon: link?.icon || '',
+      alias: link?.alias || '',
     },
   });
 
@@ -62,6 +69,64 @@ const LinkForm: React.FC<LinkFormProps> = ({
                   <p className="text-sm text-red-500 mt-1">{form.formState.errors.sort_order.message}</p>
                 )}
               </div>
+              <div>
+                <label className="block text-sm font-medium mb-1">Tags</label>
+                <Input placeholder="monitoring, oncall" {...form.register('tags')} />
+              </div>
+              <div>
+                <label className="block text-sm font-medium mb-1">Owner</label>
+                <Input placeholder="SRE team" {...form.register('owner')} />
+                {form.formState.errors.owner && (
+                  <p className="text-sm text-red-500 mt-1">{form.formState.errors.owner.message}</p>
+                )}
+              </div>
+              <div>
+                <label className="block text-sm font-medium mb-1">Environment</label>
+                <select
+                  className="w-full h-9 px-3 text-sm border border-input rounded-md bg-transparent"
+                  {...form.register('environment')}
+                >
+                  <option value="">None</option>
+                  <option value="prod">Production</option>
+                  <option value="staging">Staging</option>
+                  <option value="dev">Development</option>
+                </select>
+              </div>
+              <div className="md:col-span-2">
+                <label className="block text-sm font-medium mb-1">Alias</label>
+                <Input placeholder="wiki, or pr/{n} with {n} in the URL" {...form.register('alias')} />
+                {form.formState.errors.alias && (
+                  <p className="text-sm text-red-500 mt-1">{form.formState.errors.alias.message}</p>
+                )}
+              </div>
+              <div className="md:col-span-2">
+                <label className="block text-sm font-medium mb-1">Icon URL</label>
+                <Input placeholder="Leave empty to use the site's favicon" {...form.register('icon')} />
+                {form.formState.errors.icon && (
+                  <p className="text-sm text-red-500 mt-1">{form.formState.errors.icon.message}</p>
+                )}
+              </div>
+              <div className="md:col-span-2">
+                <label className="block text-sm font-medium mb-1">Description</label>
+                <textarea
+                  className="w-full px-3 py-2 text-sm border border-input rounded-md bg-transparent"
+                  rows={2}
+                  placeholder="What the link is for"
+                  {...form.register('description')}
+                />
+                {form.formState.errors.description && (
+                  <p className="text-sm text-red-500 mt-1">{form.formState.errors.description.message}</p>
+                )}
+              </div>
+              <div className="md:col-span-2">
+                <label className="block text-sm font-medium mb-1">Metadata</label>
+                <textarea
+                  className="w-full px-3 py-2 text-sm font-mono border border-input rounded-md bg-transparent"
+                  rows={2}
+                  placeholder="runbook=https://wiki.example.com/grafana"
+                  {...form.register('metadata')}
+                />
+              </div>
             </div>
             <div className="flex justify-end space-x-2">
               <Button type="button" variant="outline" onClick={onCancel}>
@@ -29,6 +29,7 @@ interface LinksViewProps {
   onAddLink: (groupId: number, data: LinkFormValues) => Promise<void>;
   onUpdateLink: (linkId: number, groupId: number, data: LinkFormValues) => Promise<void>;
   onDeleteLink: (id: number) => Promise<void>;
+  onUploadIcon: (id: number, file: File) => Promise<void>;
   onReorderLinks: (groupId: number, reorderedLinks: LinkType[]) => void;
   filteredGroupId?: number;
 }
@@ -39,6 +40,7 @@ const LinksView: React.FC<LinksViewProps> = ({
   onAddLink,
   onUpdateLink,
   onDeleteLink,
+  onUploadIcon,
   onReorderLinks,
   filteredGroupId
 }) => {
@@ -157,7 +159,7 @@ const LinksView: React.FC<LinksViewProps> = ({
           >
             <option value="">All Groups</option>
             {linkGroups.map(group => (
-              <option key={group.id} value={group.id}>{group.name}</option>
+              <option key={group.id} value={group.id}>{group.path || group.name}</option>
             ))}
           </select>
         </div>
@@ -189,7 +191,7 @@ const LinksView: React.FC<LinksViewProps> = ({
             filteredGroups.map(group => (
               <Card key={group.id} className="overflow-hidden">
                 <CardHeader className="bg-gray-50 flex flex-row items-center justify-between">
-                  <CardTitle>{group.name}</CardTitle>
+                  <CardTitle>{group.path || group.name}</CardTitle>
                   <Button 
                     variant="outline" 
                     size="sm" 
@@ -224,6 +226,7 @@ const LinksView: React.FC<LinksViewProps> = ({
                             <TableHead className="w-10"></TableHead>
                             <TableHead>Name</TableHead>
                             <TableHead>URL</TableHead>
+                            <TableHead>Tags</TableHead>
                             <TableHead>Sort Order</TableHead>
                             <TableHead className="text-right">Actions</TableHead>
                           </TableRow>
@@ -239,6 +242,7 @@ const LinksView: React.FC<LinksViewProps> = ({
                                 link={link}
                                 onEdit={handleEditLink}
                                 onDelete={onDeleteLink}
+                                onUploadIcon={onUploadIcon}
                               />
                             ))}
                           </SortableContext>
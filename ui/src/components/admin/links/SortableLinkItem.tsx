@@ -1,7 +1,7 @@
 import { useSortable } from '@dnd-kit/sortable';
 import { CSS } from '@dnd-kit/utilities';
-import { GripVertical, Pencil, Trash2 } from 'lucide-react';
-import React from 'react';
+import { GripVertical, Pencil, Trash2, Upload } from 'lucide-react';
+import React, { useRef } from 'react';
 
 import { Button } from '@/components/ui/button';
 import { TableCell, TableRow } from '@/components/ui/table';
@@ -11,13 +11,20 @@ interface SortableLinkItemProps {
   link: LinkType;
   onEdit: (link: LinkType) => void;
   onDelete: (id: number) => void;
+  onUploadIcon: (id: number, file: File) => void;
 }
 
-const SortableLinkItem: React.FC<SortableLinkItemProps> = ({ link, onEdit, onDelete }) => {
+const SortableLinkItem: React.FC<SortableLinkItemProps> = ({ link, onEdit, onDelete, onUploadIcon }) => {
+  const iconInput = useRef<HTMLInputElement>(null);
   const { attributes, listeners, setNodeRef, transform, transition } = useSortable({
     id: link.id.toString(),
   });
   
+  const healthy = link.health && link.health.status_code >= 200 && link.health.status_code < 400;
+  const healthTitle = !link.health
+    ? 'Not checked yet'
+    : link.health.error || `HTTP ${link.health.status_code} in ${link.health.latency_ms} ms`;
+
   const style = {
     transform: CSS.Transform.toString(transform),
     transition,
@@ -30,15 +37,54 @@ const SortableLinkItem: React.FC<SortableLinkItemProps> = ({ link, onEdit, onDel
           <GripVertical className="h-4 w-4 text-gray-400 group-hover:text-gray-600" />
         </div>
       </TableCell>
-      <TableCell className="font-medium">{link.name}</TableCell>
+      <TableCell>
+        <div className="font-medium flex items-center">
+          <span
+            className={`h-2 w-2 mr-2 rounded-full ${!link.health ? 'bg-gray-300' : healthy ? 'bg-green-500' : 'bg-red-500'}`}
+            title={healthTitle}
+          />
+          {link.icon_url && <img className="h-4 w-4 mr-2" src={link.icon_url} alt="" />}
+          {link.name}
+          {link.environment && (
+            <span className="ml-2 px-1.5 py-0.5 text-xs rounded bg-blue-50 text-blue-700">{link.environment}</span>
+          )}
+          {link.alias && <span className="ml-2 text-xs font-mono text-gray-500">go/{link.alias}</span>}
+        </div>
+        {(link.description || link.owner) && (
+          <div className="text-xs text-gray-500">
+            {[link.description, link.owner && `Owner: ${link.owner}`].filter(Boolean).join(' · ')}
+          </div>
+        )}
+      </TableCell>
       <TableCell className="max-w-xs truncate">
         <a href={link.url} target="_blank" rel="noopener noreferrer" className="text-blue-500 hover:underline">
           {link.url}
         </a>
       </TableCell>
+      <TableCell>
+        <div className="flex flex-wrap gap-1">
+          {(link.tags || []).map(tag => (
+            <span key={tag} className="px-2 py-0.5 text-xs rounded bg-gray-100 text-gray-700">{tag}</span>
+          ))}
+        </div>
+      </TableCell>
       <TableCell>{link.sort_order}</TableCell>
       <TableCell className="text-right">
         <div className="flex justify-end space-x-2">
+          <input
+            ref={iconInput}
+            type="file"
+            accept="image/*"
+            className="hidden"
+            onChange={e => {
+              const file = e.target.files?.[0];
+              if (file) onUploadIcon(link.id, file);
+              e.target.value = '';
+            }}
+          />
+          <Button variant="ghost" size="sm" title="Upload icon" onClick={() => iconInput.current?.click()}>
+            <Upload className="h-4 w-4" />
+          </Button>
           <Button variant="ghost" size="sm" onClick={() => onEdit(link)}>
             <Pencil className="h-4 w-4" />
           </Button>
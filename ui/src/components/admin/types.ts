@@ -3,7 +3,10 @@ import { z } from 'zod';
 // Types imported from the API
 export interface LinkGroup {
   id: number;
+  parent_id?: number | null;
   name: string;
+  // Names of the parents and the group, e.g. "Prod > Databases"
+  path?: string;
   sort_order: number;
   links: LinkType[];
 }
@@ -14,6 +17,21 @@ export interface LinkType {
   url: string;
   sort_order: number;
   group_id: number;
+  tags?: string[];
+  description?: string;
+  owner?: string;
+  environment?: string;
+  metadata?: Record<string, string>;
+  icon?: string;
+  icon_uploaded?: boolean;
+  icon_url?: string;
+  alias?: string;
+  health?: {
+    status_code: number;
+    latency_ms: number;
+    error?: string;
+    checked_at: string;
+  } | null;
 }
 
 export interface LinkRequest {
@@ -21,6 +39,13 @@ export interface LinkRequest {
   url: string;
   sort_order: number;
   group_id: number;
+  tags?: string[];
+  description?: string;
+  owner?: string;
+  environment?: string;
+  metadata?: Record<string, string>;
+  icon?: string;
+  alias?: string;
 }
 
 // Zod schemas
@@ -36,16 +61,51 @@ export const passwordSchema = z.object({
 export const linkGroupSchema = z.object({
   name: z.string().min(1, 'Name is required'),
   sort_order: z.coerce.number().int().nonnegative(),
+  // 0 for the top level
+  parent_id: z.coerce.number().int().nonnegative(),
 });
 
 export const linkSchema = z.object({
   name: z.string().min(1, 'Name is required'),
   url: z.string().url('Must be a valid URL'),
   sort_order: z.coerce.number().int().nonnegative(),
+  // Comma separated, e.g. "monitoring, oncall"
+  tags: z.string(),
+  description: z.string().max(2000, 'Description must be at most 2000 characters'),
+  owner: z.string().max(100, 'Owner must be at most 100 characters'),
+  environment: z.enum(['', 'prod', 'staging', 'dev']),
+  // One "key=value" pair per line
+  metadata: z.string(),
+  icon: z.union([z.literal(''), z.string().url('Must be a valid URL')]),
+  // Opens the link at /go/<alias>, {n} segments are put into the URL
+  alias: z.string().max(100, 'Alias must be at most 100 characters'),
 });
 
 export type PasswordFormValues = z.infer<typeof passwordSchema>;
 export type LinkGroupFormValues = z.infer<typeof linkGroupSchema>;
 export type LinkFormValues = z.infer<typeof linkSchema>;
 
+// splitTags turns the comma separated tags of the link form into a list
+export const splitTags = (tags: string): string[] =>
+  tags.split(',').map(tag => tag.trim()).filter(tag => tag !== '');
+
+// parseMetadata turns the "key=value" lines of the link form into metadata
+export const parseMetadata = (metadata: string): Record<string, string> => {
+  const result: Record<string, string> = {};
+  for (const line of metadata.split('\n')) {
+    const index = line.indexOf('=');
+    if (index > 0) {
+      result[line.slice(0, index).trim()] = line.slice(index + 1).trim();
+    }
+  }
+  return result;
+};
+
+// formatMetadata turns metadata into the "key=value" lines of the link form
+export const formatMetadata = (metadata?: Record<string, string>): string =>
+  Object.entries(metadata || {})
+    .sort(([a], [b]) => a.localeCompare(b))
+    .map(([key, value]) => `${key}=${value}`)
+    .join('\n');
+
 export type AdminView = 'linkGroups' | 'links' | 'systemConfig'; 
\ No newline at end of file
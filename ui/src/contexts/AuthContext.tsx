@@ -1,10 +1,13 @@
-import React, { createContext, useContext, useState, useEffect } from 'react';
-import { login as apiLogin, LoginRequest } from '@/lib/api';
+import React, { createContext, useCallback, useContext, useState, useEffect } from 'react';
+import { login as apiLogin, loginTwoFactor as apiLoginTwoFactor, logout as apiLogout, LoginRequest, LoginResponse } from '@/lib/api';
 
 interface AuthContextType {
   isAuthenticated: boolean;
   username: string | null;
-  login: (data: LoginRequest) => Promise<void>;
+  // Resolves to a challenge token when the user still has to enter a two-factor code
+  login: (data: LoginRequest) => Promise<string | null>;
+  loginTwoFactor: (challengeToken: string, code: string) => Promise<void>;
+  loginWithToken: (token: string, refreshToken: string, username: string) => void;
   logout: () => void;
   loading: boolean;
   isSessionExpired: boolean;
@@ -47,24 +50,57 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
     return () => window.removeEventListener('storage', handleStorageChange);
   }, []);
 
+  const storeSession = (response: LoginResponse) => {
+    localStorage.setItem('token', response.token);
+    localStorage.setItem('refreshToken', response.refresh_token);
+    localStorage.setItem('username', response.username);
+
+    setIsAuthenticated(true);
+    setUsername(response.username);
+    setIsSessionExpired(false);
+  };
+
   const login = async (data: LoginRequest) => {
     try {
       setLoading(true);
       const response = await apiLogin(data);
-      
-      localStorage.setItem('token', response.token);
-      localStorage.setItem('username', response.username);
-      
-      setIsAuthenticated(true);
-      setUsername(response.username);
-      setIsSessionExpired(false);
+      if ('two_factor_required' in response) {
+        return response.challenge_token;
+      }
+
+      storeSession(response);
+      return null;
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const loginTwoFactor = async (challengeToken: string, code: string) => {
+    try {
+      setLoading(true);
+      const response = await apiLoginTwoFactor({ challenge_token: challengeToken, code });
+      storeSession(response);
     } finally {
       setLoading(false);
     }
   };
 
+  // Used after single sign-on, where the server hands the token to the login page
+  const loginWithToken = useCallback((token: string, refreshToken: string, username: string) => {
+    localStorage.setItem('token', token);
+    localStorage.setItem('refreshToken', refreshToken);
+    localStorage.setItem('username', username);
+
+    setIsAuthenticated(true);
+    setUsername(username);
+    setIsSessionExpired(false);
+  }, []);
+
   const logout = () => {
+    // End the session on the server too, the local logout does not depend on it
+    apiLogout().catch((err) => console.error('Failed to end session:', err));
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('username');
     setIsAuthenticated(false);
     setUsername(null);
@@ -79,6 +115,8 @@ export const AuthProvider: React.FC<{ children: React.ReactNode }> = ({ children
       isAuthenticated, 
       username, 
       login, 
+      loginTwoFactor,
+      loginWithToken,
       logout, 
       loading,
       isSessionExpired,
@@ -20,18 +20,56 @@ api.interceptors.request.use(
   (error) => Promise.reject(error)
 );
 
+// Clear stored auth data and send the user to the login page
+const endSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+  localStorage.removeItem('username');
+  window.location.href = '/login';
+};
+
+// A single refresh shared by all requests failing at the same time,
+// since each refresh token can only be used once
+let refreshPromise: Promise<string> | null = null;
+
+const refreshAccessToken = (): Promise<string> => {
+  if (!refreshPromise) {
+    const refreshToken = localStorage.getItem('refreshToken');
+    refreshPromise = (refreshToken
+      ? axios.post<LoginResponse>('/api/refresh', { refresh_token: refreshToken }).then((response) => {
+          localStorage.setItem('token', response.data.token);
+          localStorage.setItem('refreshToken', response.data.refresh_token);
+          localStorage.setItem('username', response.data.username);
+          return response.data.token;
+        })
+      : Promise.reject(new Error('No refresh token'))
+    ).finally(() => {
+      refreshPromise = null;
+    });
+  }
+  return refreshPromise;
+};
+
 // Add response interceptor to handle auth errors
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
-    // Handle 401 Unauthorized errors
-    if (error.response && error.response.status === 401) {
-      console.log('Unauthorized access detected, redirecting to login page');
-      // Clear any stored auth data
-      localStorage.removeItem('token');
-      localStorage.removeItem('username');
-      // Redirect to login page
-      window.location.href = '/login';
+  async (error) => {
+    const original = error.config;
+    // Failed logins are shown on the login page, the user has no session to refresh
+    if (original && original.url && original.url.startsWith('/login')) {
+      return Promise.reject(error);
+    }
+    // Handle 401 Unauthorized errors by refreshing the access token once
+    if (error.response && error.response.status === 401 && original && !original._retried) {
+      original._retried = true;
+      try {
+        const token = await refreshAccessToken();
+        original.headers.Authorization = `Bearer ${token}`;
+        return api(original);
+      } catch {
+        console.log('Session expired, redirecting to login page');
+        endSession();
+      }
     }
     return Promise.reject(error);
   }
@@ -43,33 +81,137 @@ export interface LoginRequest {
   password: string;
 }
 
+// Returned by login instead of tokens when the user has two-factor auth
+export interface TwoFactorChallenge {
+  two_factor_required: true;
+  challenge_token: string;
+}
+
+export interface LoginTwoFactorRequest {
+  challenge_token: string;
+  code: string;
+}
+
 export interface LoginResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number;
   username: string;
+  role: string;
+}
+
+export interface LoginMethods {
+  password: boolean;
+  oidc: boolean;
 }
 
 export interface LinkGroup {
   id: number;
+  parent_id: number | null;
   name: string;
   sort_order: number;
+  visibility?: 'private' | 'public';
   created_at: string;
   updated_at: string;
   links: Link[];
+  subgroups?: LinkGroup[];
+  // Names of the parents and the group, e.g. "Prod > Databases", set by flattenLinkGroups
+  path?: string;
 }
 
+// flattenLinkGroups lists the groups of a tree with each parent before its subgroups
+export const flattenLinkGroups = (groups: LinkGroup[], parentPath?: string): LinkGroup[] =>
+  groups.flatMap(group => {
+    const path = parentPath ? `${parentPath} > ${group.name}` : group.name;
+    return [{ ...group, path, subgroups: undefined }, ...flattenLinkGroups(group.subgroups || [], path)];
+  });
+
 export interface Link {
   id: number;
   group_id: number;
   name: string;
   url: string;
   sort_order: number;
+  description: string;
+  owner: string;
+  environment: '' | 'prod' | 'staging' | 'dev';
+  metadata: Record<string, string>;
+  // Opens the link at /go/<alias>, empty for none
+  alias: string;
+  icon: string;
+  icon_uploaded: boolean;
+  // Signed, so it can be used in <img> tags without a login
+  icon_url?: string;
+  // Opens the link and counts the click, signed like icon_url
+  click_url?: string;
+  // null until the link has been checked
+  health: LinkHealth | null;
+  tags: string[];
   created_at: string;
   updated_at: string;
 }
 
+export interface LinkHealth {
+  // 0 if the request failed
+  status_code: number;
+  latency_ms: number;
+  error?: string;
+  checked_at: string;
+}
+
+export interface LinkHealthEntry {
+  link_id: number;
+  name: string;
+  url: string;
+  group_id: number;
+  group_name: string;
+  status: 'down' | 'up' | 'unchecked';
+  health: LinkHealth | null;
+}
+
+export interface LinkClicks {
+  link_id: number;
+  name: string;
+  url: string;
+  group_id: number;
+  group_name: string;
+  clicks: number;
+}
+
+export interface GroupClicks {
+  group_id: number;
+  name: string;
+  parent_id: number | null;
+  clicks: number;
+  // Including the clicks on the links of subgroups
+  total_clicks: number;
+}
+
+export interface LinkClickHistory {
+  link_id: number;
+  clicks: number;
+  // One entry per day, oldest first, dates in UTC
+  daily: { date: string; clicks: number }[];
+}
+
+export interface AliasTarget {
+  link_id: number;
+  alias: string;
+  // The link's URL with the parameters of the alias put in
+  url: string;
+}
+
+export interface SearchResult extends Link {
+  group_name: string;
+  rank: number;
+}
+
 export interface LinkGroupRequest {
   name: string;
   sort_order: number;
+  visibility?: 'private' | 'public';
+  // 0 for the top level, omit to keep the group where it is
+  parent_id?: number;
 }
 
 export interface LinkRequest {
@@ -77,21 +219,60 @@ export interface LinkRequest {
   name: string;
   url: string;
   sort_order: number;
+  // Omitted tags and details are kept on update
+  tags?: string[];
+  description?: string;
+  owner?: string;
+  environment?: '' | 'prod' | 'staging' | 'dev';
+  metadata?: Record<string, string>;
+  icon?: string;
+  // Kept on update if omitted, empty removes it
+  alias?: string;
 }
 
 // Auth API
-export const login = async (data: LoginRequest): Promise<LoginResponse> => {
-  const response = await api.post<LoginResponse>('/login', data);
+export const login = async (data: LoginRequest): Promise<LoginResponse | TwoFactorChallenge> => {
+  const response = await api.post<LoginResponse | TwoFactorChallenge>('/login', data);
+  return response.data;
+};
+
+export const loginTwoFactor = async (data: LoginTwoFactorRequest): Promise<LoginResponse> => {
+  const response = await api.post<LoginResponse>('/login/2fa', data);
+  return response.data;
+};
+
+export const logout = async (): Promise<void> => {
+  await api.post('/logout');
+};
+
+export const getLoginMethods = async (): Promise<LoginMethods> => {
+  const response = await api.get<LoginMethods>('/auth/methods');
   return response.data;
 };
 
+// Single sign-on starts with a full page redirect to the identity provider
+export const oidcLoginUrl = '/api/auth/oidc/login';
+
 export const changePassword = async (oldPassword: string, newPassword: string): Promise<void> => {
   await api.post('/admin/change-password', { old_password: oldPassword, new_password: newPassword });
 };
 
 // Link Groups API
-export const getLinkGroups = async (): Promise<LinkGroup[]> => {
-  const response = await api.get<LinkGroup[]>('/links');
+// Link groups of the user, with only the links tagged with tag if one is given
+export const getLinkGroups = async (tag?: string): Promise<LinkGroup[]> => {
+  const response = await api.get<LinkGroup[]>('/links', { params: tag ? { tag } : undefined });
+  return response.data;
+};
+
+// Public link groups, only available when public mode is enabled on the server
+export const getPublicLinkGroups = async (tag?: string): Promise<LinkGroup[]> => {
+  const response = await api.get<LinkGroup[]>('/public/links', { params: tag ? { tag } : undefined });
+  return response.data;
+};
+
+// Links the user can read matching every word of the query, best match first
+export const searchLinks = async (q: string, limit?: number): Promise<SearchResult[]> => {
+  const response = await api.get<SearchResult[]>('/search', { params: { q, limit } });
   return response.data;
 };
 
@@ -114,6 +295,11 @@ export const deleteLinkGroup = async (id: number): Promise<void> => {
 };
 
 // Links API
+// Sort orders are set to the position of each ID, all or nothing
+export const reorderLinkGroups = async (ids: number[]): Promise<void> => {
+  await api.post('/admin/link-groups/reorder', { ids });
+};
+
 export const getLinksByGroupId = async (groupId: number): Promise<Link[]> => {
   const response = await api.get<Link[]>(`/admin/link-groups/${groupId}/links`);
   return response.data;
@@ -128,15 +314,66 @@ export const updateLink = async (id: number, data: LinkRequest): Promise<void> =
   await api.put(`/admin/links/${id}`, data);
 };
 
+export const reorderLinks = async (groupId: number, ids: number[]): Promise<void> => {
+  await api.post(`/admin/link-groups/${groupId}/links/reorder`, { ids });
+};
+
+export const getLinksHealth = async (status?: LinkHealthEntry['status']): Promise<LinkHealthEntry[]> => {
+  const response = await api.get('/admin/links/health', { params: { status } });
+  return response.data;
+};
+
+// resolveAlias looks up where a go-link path like pr/123 leads. Paths matching no alias
+// fail with 404 and a list of close aliases in suggestions.
+export const resolveAlias = async (path: string): Promise<AliasTarget> => {
+  const response = await api.get(`/go/${path}`);
+  return response.data;
+};
+
+export const getLinkAnalytics = async (days = 7, limit?: number): Promise<LinkClicks[]> => {
+  const response = await api.get('/admin/analytics/links', { params: { days, limit } });
+  return response.data;
+};
+
+export const getGroupAnalytics = async (days = 7): Promise<GroupClicks[]> => {
+  const response = await api.get('/admin/analytics/groups', { params: { days } });
+  return response.data;
+};
+
+export const getLinkClickHistory = async (id: number, days = 30): Promise<LinkClickHistory> => {
+  const response = await api.get(`/admin/analytics/links/${id}`, { params: { days } });
+  return response.data;
+};
+
 export const deleteLink = async (id: number): Promise<void> => {
   await api.delete(`/admin/links/${id}`);
 };
 
+export const uploadLinkIcon = async (id: number, file: File): Promise<void> => {
+  const formData = new FormData();
+  formData.append('file', file);
+
+  await api.post(`/admin/links/${id}/icon`, formData, {
+    headers: {
+      'Content-Type': 'multipart/form-data',
+    },
+  });
+};
+
+export const deleteLinkIcon = async (id: number): Promise<void> => {
+  await api.delete(`/admin/links/${id}/icon`);
+};
+
 // Import/Export API
-export const exportData = async (): Promise<void> => {
+
+// Exports are link-deck JSON or, with netscape, the bookmarks.html files of browsers
+export type ExportFormat = 'json' | 'netscape';
+
+export const exportData = async (format: ExportFormat = 'json'): Promise<void> => {
   try {
     // Use the api instance which already has the auth headers configured
     const response = await api.get('/admin/export', {
+      params: { format },
       responseType: 'blob', // Important for handling file download
     });
     
@@ -170,20 +407,46 @@ export const exportData = async (): Promise<void> => {
   }
 };
 
-export const importData = async (file: File): Promise<void> => {
+// Import modes: merge adds new URLs, replace-group replaces the links of imported groups, replace-all the whole deck
+export type ImportMode = 'merge' | 'replace-group' | 'replace-all';
+
+export interface ImportChange {
+  action: 'create' | 'update' | 'delete';
+  type: 'group' | 'link';
+  group: string;
+  name: string;
+  url?: string;
+}
+
+export interface ImportResult {
+  message: string;
+  mode: ImportMode;
+  dry_run: boolean;
+  changes: ImportChange[];
+}
+
+export const importData = async (
+  file: File,
+  mode: ImportMode = 'replace-group',
+  dryRun = false,
+): Promise<ImportResult> => {
   if (!file) {
     throw new Error('No file provided');
   }
   
   const formData = new FormData();
   formData.append('file', file);
+  // HTML files are browser bookmarks
+  const format: ExportFormat = /\.html?$/i.test(file.name) ? 'netscape' : 'json';
   
   // Need to set different content type for file upload
-  await api.post('/admin/import', formData, {
+  const response = await api.post<ImportResult>('/admin/import', formData, {
+    params: { format, mode, dry_run: dryRun },
     headers: {
       'Content-Type': 'multipart/form-data',
     },
   });
+  return response.data;
 };
 
 export default api; 
\ No newline at end of file
@@ -6,7 +6,7 @@ import LinksView from '@/components/admin/links/LinksView';
 import LinkGroupsView from '@/components/admin/linkgroups/LinkGroupsView';
 import Sidebar from '@/components/admin/Sidebar';
 import SystemConfigView from '@/components/admin/SystemConfigView';
-import { AdminView, LinkFormValues, LinkGroup, LinkGroupFormValues, LinkRequest, LinkType, PasswordFormValues } from '@/components/admin/types';
+import { AdminView, LinkFormValues, LinkGroup, LinkGroupFormValues, LinkRequest, LinkType, parseMetadata, PasswordFormValues, splitTags } from '@/components/admin/types';
 import { useAuth } from '@/contexts/AuthContext';
 import {
   changePassword,
@@ -15,10 +15,15 @@ import {
   deleteLink,
   deleteLinkGroup,
   exportData,
+  ExportFormat,
+  flattenLinkGroups,
   getAdminLinkGroups,
   importData,
+  reorderLinkGroups,
+  reorderLinks,
   updateLink,
-  updateLinkGroup
+  updateLinkGroup,
+  uploadLinkIcon
 } from '@/lib/api';
 
 const Admin: React.FC = () => {
@@ -39,7 +44,7 @@ const Admin: React.FC = () => {
       setLoading(true);
       setError(null);
       const data = await getAdminLinkGroups();
-      setLinkGroups(data);
+      setLinkGroups(flattenLinkGroups(data));
     } catch (err: any) {
       console.error('Failed to load link groups:', err);
       // Handle 401 errors specifically (should be handled by the interceptor, but as a fallback)
@@ -90,7 +95,10 @@ const Admin: React.FC = () => {
 
   const handleUpdateGroup = async (id: number, data: LinkGroupFormValues) => {
     try {
-      await updateLinkGroup(id, data);
+      // Only the owner may move a group, so the parent is only sent when it changes
+      const { parent_id, ...rest } = data;
+      const current = linkGroups.find(group => group.id === id);
+      await updateLinkGroup(id, parent_id === (current?.parent_id || 0) ? rest : data);
       await loadLinkGroups();
       return Promise.resolve();
     } catch (err: any) {
@@ -99,7 +107,7 @@ const Admin: React.FC = () => {
         logout();
         navigate('/login');
       }
-      setError('Failed to update group');
+      setError(err.response?.data?.error || 'Failed to update group');
       return Promise.reject(err);
     }
   };
@@ -128,6 +136,8 @@ const Admin: React.FC = () => {
       const linkData: LinkRequest = {
         ...data,
         group_id: groupId,
+        tags: splitTags(data.tags),
+        metadata: parseMetadata(data.metadata),
       };
       
       await createLink(linkData);
@@ -139,7 +149,7 @@ const Admin: React.FC = () => {
         logout();
         navigate('/login');
       }
-      setError('Failed to add link');
+      setError(err.response?.data?.error || 'Failed to add link');
       return Promise.reject(err);
     }
   };
@@ -149,6 +159,8 @@ const Admin: React.FC = () => {
       const linkData: LinkRequest = {
         ...data,
         group_id: groupId,
+        tags: splitTags(data.tags),
+        metadata: parseMetadata(data.metadata),
       };
       
       await updateLink(id, linkData);
@@ -160,7 +172,7 @@ const Admin: React.FC = () => {
         logout();
         navigate('/login');
       }
-      setError('Failed to update link');
+      setError(err.response?.data?.error || 'Failed to update link');
       return Promise.reject(err);
     }
   };
@@ -183,6 +195,22 @@ const Admin: React.FC = () => {
     }
   };
 
+  const handleUploadIcon = async (id: number, file: File) => {
+    try {
+      await uploadLinkIcon(id, file);
+      await loadLinkGroups();
+      return Promise.resolve();
+    } catch (err: any) {
+      console.error('Failed to upload icon:', err);
+      if (err.response && err.response.status === 401) {
+        logout();
+        navigate('/login');
+      }
+      setError(err.response?.data?.error || 'Failed to upload icon');
+      return Promise.reject(err);
+    }
+  };
+
   // Password operations
   const handleChangePassword = async (data: PasswordFormValues) => {
     try {
@@ -194,11 +222,11 @@ const Admin: React.FC = () => {
   };
 
   // Export/Import operations
-  const handleExport = async () => {
+  const handleExport = async (format: ExportFormat) => {
     try {
       setError(null);
       setExporting(true);
-      await exportData();
+      await exportData(format);
     } catch (err) {
       console.error('Failed to export data:', err);
       setError('Failed to export data. Please try again.');
@@ -213,10 +241,13 @@ const Admin: React.FC = () => {
       setError(null);
       setImportStatus(null);
       
-      await importData(file);
+      const result = await importData(file);
       await loadLinkGroups();
       
-      setImportStatus('Data imported successfully');
+      const count = (action: string) => result.changes.filter(change => change.action === action).length;
+      setImportStatus(
+        `Data imported successfully: ${count('create')} created, ${count('update')} updated, ${count('delete')} deleted`,
+      );
     } catch (err) {
       console.error('Failed to import data:', err);
       setError('Failed to import data. Please check your file format.');
@@ -226,24 +257,21 @@ const Admin: React.FC = () => {
   };
 
   // Handle group reordering
-  const handleReorderGroups = (reorderedGroups: LinkGroup[]) => {
+  const handleReorderGroups = async (reorderedGroups: LinkGroup[]) => {
     setLinkGroups(reorderedGroups);
     
-    // Save new order to backend
-    reorderedGroups.forEach(async (group) => {
-      try {
-        await updateLinkGroup(group.id, {
-          name: group.name,
-          sort_order: group.sort_order,
-        });
-      } catch (err) {
-        console.error('Failed to update group order:', err);
-      }
-    });
+    // Save new order to backend, reloading the saved order if it fails
+    try {
+      await reorderLinkGroups(reorderedGroups.map(group => group.id));
+    } catch (err) {
+      console.error('Failed to update group order:', err);
+      setError('Failed to update group order');
+      await loadLinkGroups();
+    }
   };
 
   // Handle link reordering within a group
-  const handleReorderLinks = (groupId: number, reorderedLinks: LinkType[]) => {
+  const handleReorderLinks = async (groupId: number, reorderedLinks: LinkType[]) => {
     const updatedGroups = linkGroups.map(group => {
       if (group.id === groupId) {
         return { ...group, links: reorderedLinks };
@@ -253,19 +281,14 @@ const Admin: React.FC = () => {
     
     setLinkGroups(updatedGroups);
     
-    // Save new order to backend
-    reorderedLinks.forEach(async (link) => {
-      try {
-        await updateLink(link.id, {
-          name: link.name,
-          url: link.url,
-          sort_order: link.sort_order,
-          group_id: link.group_id,
-        });
-      } catch (err) {
-        console.error('Failed to update link order:', err);
-      }
-    });
+    // Save new order to backend, reloading the saved order if it fails
+    try {
+      await reorderLinks(groupId, reorderedLinks.map(link => link.id));
+    } catch (err) {
+      console.error('Failed to update link order:', err);
+      setError('Failed to update link order');
+      await loadLinkGroups();
+    }
   };
 
   return (
@@ -322,6 +345,7 @@ const Admin: React.FC = () => {
               onAddLink={handleAddLink}
               onUpdateLink={handleUpdateLink}
               onDeleteLink={handleDeleteLink}
+              onUploadIcon={handleUploadIcon}
               onReorderLinks={handleReorderLinks}
               filteredGroupId={selectedGroupId !== null ? selectedGroupId : undefined}
             />
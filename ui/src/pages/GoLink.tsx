@@ -0,0 +1,82 @@
+import axios from 'axios';
+import React, { useEffect, useState } from 'react';
+import { Link, useLocation, useNavigate, useParams } from 'react-router-dom';
+
+import { useAuth } from '@/contexts/AuthContext';
+import { resolveAlias } from '@/lib/api';
+
+const GoLink: React.FC = () => {
+  const { isAuthenticated, loading: authLoading } = useAuth();
+  const navigate = useNavigate();
+  const location = useLocation();
+  const path = useParams()['*'] || '';
+  const [suggestions, setSuggestions] = useState<string[] | null>(null);
+  const [error, setError] = useState<string | null>(null);
+
+  useEffect(() => {
+    if (authLoading) {
+      return;
+    }
+    if (!isAuthenticated) {
+      navigate('/login', { state: { from: location.pathname } });
+      return;
+    }
+
+    setSuggestions(null);
+    setError(null);
+    resolveAlias(path)
+      .then(target => {
+        // Only web pages are opened, other schemes like javascript: would run in the app
+        if (!/^https?:\/\//i.test(target.url)) {
+          setError('Refusing to open a link that is not http or https');
+          return;
+        }
+        window.location.replace(target.url);
+      })
+      .catch(err => {
+        if (axios.isAxiosError(err) && err.response?.status === 404) {
+          setSuggestions(err.response.data.suggestions || []);
+          return;
+        }
+        console.error('Failed to resolve alias:', err);
+        setError('Failed to resolve alias');
+      });
+  }, [authLoading, isAuthenticated, location.pathname, navigate, path]);
+
+  if (error) {
+    return <div className="container mx-auto p-4 text-red-500">{error}</div>;
+  }
+  if (!suggestions) {
+    return <div className="flex items-center justify-center min-h-screen">Opening go/{path}...</div>;
+  }
+
+  return (
+    <div className="container mx-auto p-4">
+      <h1 className="text-2xl font-bold mb-2">go/{path} not found</h1>
+      {suggestions.length > 0 ? (
+        <>
+          <p className="text-gray-600 mb-2">Did you mean:</p>
+          <ul className="list-disc ml-6">
+            {suggestions.map(alias => (
+              <li key={alias}>
+                {/* Parameterized aliases like pr/{n} need their values filled in */}
+                {alias.includes('{') ? (
+                  <span className="font-mono">go/{alias}</span>
+                ) : (
+                  <Link className="text-blue-700 hover:underline font-mono" to={`/go/${alias}`}>go/{alias}</Link>
+                )}
+              </li>
+            ))}
+          </ul>
+        </>
+      ) : (
+        <p className="text-gray-600">No link has a similar alias.</p>
+      )}
+      <p className="mt-4">
+        <Link className="text-blue-700 hover:underline" to="/">Back to all links</Link>
+      </p>
+    </div>
+  );
+};
+
+export default GoLink;
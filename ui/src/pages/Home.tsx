@@ -1,24 +1,42 @@
-import { Settings } from 'lucide-react';
+import { LogIn, Search, Settings, X } from 'lucide-react';
 import React, { useEffect, useState } from 'react';
-import { Link } from 'react-router-dom';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
 
 import { useAuth } from '@/contexts/AuthContext';
-import { getLinkGroups, LinkGroup } from '@/lib/api';
+import { flattenLinkGroups, getLinkGroups, getPublicLinkGroups, LinkGroup, searchLinks, SearchResult } from '@/lib/api';
 
 const Home: React.FC = () => {
-  const { isAuthenticated } = useAuth();
+  const { isAuthenticated, loading: authLoading } = useAuth();
+  const navigate = useNavigate();
+  // Links can be filtered by tag with ?tag=oncall
+  const [searchParams, setSearchParams] = useSearchParams();
+  const tag = searchParams.get('tag') || undefined;
+  // Signed in users can search their links with ?q=grafana
+  const query = searchParams.get('q') || '';
+  const [searchInput, setSearchInput] = useState(query);
+  const [searchResults, setSearchResults] = useState<SearchResult[] | null>(null);
   const [linkGroups, setLinkGroups] = useState<LinkGroup[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
 
   useEffect(() => {
+    if (authLoading) {
+      return;
+    }
+
     const fetchLinkGroups = async () => {
       try {
         setLoading(true);
         setError(null);
-        const data = await getLinkGroups();
-        setLinkGroups(data);
+        // Anonymous visitors get the public deck, if public mode is enabled
+        const data = isAuthenticated ? await getLinkGroups(tag) : await getPublicLinkGroups(tag);
+        setLinkGroups(flattenLinkGroups(data));
       } catch (err) {
+        if (!isAuthenticated) {
+          // Public mode is disabled, a login is required
+          navigate('/login');
+          return;
+        }
         console.error('Failed to load link groups:', err);
         setError('Failed to load link groups');
       } finally {
@@ -27,7 +45,32 @@ const Home: React.FC = () => {
     };
 
     fetchLinkGroups();
-  }, []);
+  }, [authLoading, isAuthenticated, navigate, tag]);
+
+  useEffect(() => {
+    setSearchInput(query);
+    if (!isAuthenticated || !query) {
+      setSearchResults(null);
+      return;
+    }
+
+    const fetchSearchResults = async () => {
+      try {
+        setSearchResults(await searchLinks(query));
+      } catch (err) {
+        console.error('Failed to search links:', err);
+        setError('Failed to search links');
+      }
+    };
+
+    fetchSearchResults();
+  }, [isAuthenticated, query]);
+
+  const handleSearch = (e: React.FormEvent) => {
+    e.preventDefault();
+    const q = searchInput.trim();
+    setSearchParams(q ? { q } : {});
+  };
 
   return (
     <div className="min-h-screen bg-gray-100">
@@ -44,6 +87,52 @@ const Home: React.FC = () => {
           </div>
         )}
 
+        {isAuthenticated && (
+          <form className="mb-4 flex items-center max-w-md" onSubmit={handleSearch}>
+            <Search className="h-4 w-4 mr-2 text-gray-500" />
+            <input
+              className="flex-1 px-3 py-1.5 text-sm border border-gray-300 rounded"
+              type="search"
+              placeholder="Search links"
+              value={searchInput}
+              onChange={e => setSearchInput(e.target.value)}
+            />
+          </form>
+        )}
+
+        {searchResults && (
+          <div className="mb-6">
+            <div className="mb-2 flex items-center text-sm text-gray-700">
+              {searchResults.length} result{searchResults.length === 1 ? '' : 's'} for
+              <span className="ml-1 font-semibold">{query}</span>
+              <button className="ml-2 text-gray-500 hover:text-gray-800" onClick={() => setSearchParams({})}>
+                <X className="h-4 w-4" />
+              </button>
+            </div>
+            <ul className="space-y-1">
+              {searchResults.map(result => (
+                <li className="text-sm" key={result.id}>
+                  <a className="text-blue-700 hover:underline" href={result.click_url || result.url} target="_blank" rel="noopener noreferrer">
+                    {result.icon_url && <img className="inline h-4 w-4 mr-1 align-text-bottom" src={result.icon_url} alt="" />}
+                    {result.name}
+                  </a>
+                  <span className="ml-2 text-gray-500">{result.group_name}</span>
+                  {result.description && <div className="text-xs text-gray-500">{result.description}</div>}
+                </li>
+              ))}
+            </ul>
+          </div>
+        )}
+
+        {tag && (
+          <div className="mb-4 flex items-center text-sm text-gray-700">
+            Showing links tagged <span className="ml-1 font-semibold">{tag}</span>
+            <button className="ml-2 text-gray-500 hover:text-gray-800" onClick={() => setSearchParams({})}>
+              <X className="h-4 w-4" />
+            </button>
+          </div>
+        )}
+
         {loading ? (
           <div className="text-center py-8">Loading...</div>
         ) : linkGroups.length === 0 ? (
@@ -51,10 +140,9 @@ const Home: React.FC = () => {
         ) : (
           <div className="flex flex-wrap gap-2">
             {linkGroups
-              .sort((a, b) => a.sort_order - b.sort_order)
               .map(group => (
                 <div className="mb-5 w-full sm:w-[calc(50%-0.5rem)] lg:w-[calc(33.33%-0.5rem)]" key={group.id} id={`group-${group.id}`}>
-                  <div className="text-base leading-relaxed text-red-800 pl-1">{group.name}</div>
+                  <div className="text-base leading-relaxed text-red-800 pl-1">{group.path}</div>
                   <div className="flex flex-wrap overflow-hidden z-10">
                     {(group.links || [])
                       .sort((a, b) => a.sort_order - b.sort_order)
@@ -62,10 +150,12 @@ const Home: React.FC = () => {
                         <div className="w-28 m-0.5" key={link.id}>
                           <a 
                             className="block bg-black/35 text-white text-xs text-center py-1 px-0 leading-9 rounded transition-all duration-200 hover:bg-black/45 hover:font-bold"
-                            href={link.url} 
+                            href={link.click_url || link.url} 
                             target="_blank" 
                             rel="noopener noreferrer"
+                            title={[link.description, (link.tags || []).join(', ')].filter(Boolean).join('\n') || undefined}
                           >
+                            {link.icon_url && <img className="inline h-4 w-4 mr-1 align-middle" src={link.icon_url} alt="" />}
                             {link.name}
                           </a>
                         </div>
@@ -77,12 +167,18 @@ const Home: React.FC = () => {
         )}
       </main>
 
-      {isAuthenticated && (
+      {isAuthenticated ? (
         <Link to="/admin">
           <div className="fixed bottom-6 right-6 p-3 bg-slate-700 hover:bg-slate-800 text-white rounded-full shadow-lg transition-all duration-200">
             <Settings className="h-6 w-6" />
           </div>
         </Link>
+      ) : (
+        <Link to="/login">
+          <div className="fixed bottom-6 right-6 p-3 bg-slate-700 hover:bg-slate-800 text-white rounded-full shadow-lg transition-all duration-200">
+            <LogIn className="h-6 w-6" />
+          </div>
+        </Link>
       )}
     </div>
   );
@@ -1,13 +1,15 @@
 import { zodResolver } from '@hookform/resolvers/zod';
-import React, { useState } from 'react';
+import axios from 'axios';
+import React, { useEffect, useState } from 'react';
 import { useForm } from 'react-hook-form';
-import { useNavigate } from 'react-router-dom';
+import { useLocation, useNavigate } from 'react-router-dom';
 import { z } from 'zod';
 
 import { Button } from '@/components/ui/button';
 import { Card, CardContent, CardDescription, CardFooter, CardHeader, CardTitle } from '@/components/ui/card';
 import { Input } from '@/components/ui/input';
 import { useAuth } from '@/contexts/AuthContext';
+import { getLoginMethods, LoginMethods, oidcLoginUrl } from '@/lib/api';
 
 const loginSchema = z.object({
   username: z.string().min(1, 'Username is required'),
@@ -16,11 +18,40 @@ const loginSchema = z.object({
 
 type LoginFormValues = z.infer<typeof loginSchema>;
 
+// The server answers 429 while failed logins are throttled
+const isThrottled = (err: unknown) => axios.isAxiosError(err) && err.response?.status === 429;
+
 const Login: React.FC = () => {
-  const { login } = useAuth();
+  const { login, loginTwoFactor, loginWithToken } = useAuth();
   const navigate = useNavigate();
+  // Pages that need a login, like go-links, send users here and get them back afterwards
+  const from = (useLocation().state as { from?: string } | null)?.from || '/';
   const [error, setError] = useState<string | null>(null);
   const [isLoading, setIsLoading] = useState(false);
+  const [methods, setMethods] = useState<LoginMethods>({ password: true, oidc: false });
+  const [challengeToken, setChallengeToken] = useState<string | null>(null);
+  const [code, setCode] = useState('');
+
+  useEffect(() => {
+    // Single sign-on returns here with the token or an error in the URL fragment
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    window.history.replaceState(null, '', window.location.pathname);
+    const token = params.get('token');
+    const refreshToken = params.get('refresh_token');
+    const username = params.get('username');
+    if (token && refreshToken && username) {
+      loginWithToken(token, refreshToken, username);
+      navigate('/');
+      return;
+    }
+    if (params.get('error')) {
+      setError(params.get('error'));
+    }
+
+    getLoginMethods()
+      .then(setMethods)
+      .catch((err) => console.error('Failed to load login methods:', err));
+  }, [loginWithToken, navigate]);
 
   const { register, handleSubmit, formState: { errors } } = useForm<LoginFormValues>({
     resolver: zodResolver(loginSchema),
@@ -34,11 +65,38 @@ const Login: React.FC = () => {
     try {
       setIsLoading(true);
       setError(null);
-      await login(data);
-      navigate('/');
+      const challenge = await login(data);
+      if (challenge) {
+        setChallengeToken(challenge);
+        return;
+      }
+      navigate(from);
     } catch (err) {
       console.error('Login error:', err);
-      setError('Invalid username or password');
+      setError(isThrottled(err)
+        ? 'Too many failed attempts, please wait a moment and try again'
+        : 'Invalid username or password');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const onSubmitCode = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!challengeToken || !code.trim()) {
+      return;
+    }
+    try {
+      setIsLoading(true);
+      setError(null);
+      await loginTwoFactor(challengeToken, code.trim());
+      navigate(from);
+    } catch (err) {
+      console.error('Two-factor login error:', err);
+      setError(isThrottled(err)
+        ? 'Too many failed attempts, please wait a moment and try again'
+        : 'Invalid code, or the login took too long');
+      setCode('');
     } finally {
       setIsLoading(false);
     }
@@ -53,6 +111,46 @@ const Login: React.FC = () => {
             Enter your credentials to access the admin panel
           </CardDescription>
         </CardHeader>
+        {!methods.password && error && (
+          <CardContent>
+            <div className="p-3 text-sm text-white bg-red-500 rounded-md">
+              {error}
+            </div>
+          </CardContent>
+        )}
+        {challengeToken && (
+        <form onSubmit={onSubmitCode}>
+          <CardContent className="space-y-4">
+            {error && (
+              <div className="p-3 text-sm text-white bg-red-500 rounded-md">
+                {error}
+              </div>
+            )}
+            <div className="space-y-2">
+              <label htmlFor="code" className="text-sm font-medium">
+                Authentication code
+              </label>
+              <Input
+                id="code"
+                autoComplete="one-time-code"
+                autoFocus
+                placeholder="123456"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+              />
+              <p className="text-sm text-gray-500">
+                Enter the code from your authenticator app, or one of your recovery codes.
+              </p>
+            </div>
+          </CardContent>
+          <CardFooter>
+            <Button type="submit" className="w-full" disabled={isLoading}>
+              {isLoading ? 'Verifying...' : 'Verify'}
+            </Button>
+          </CardFooter>
+        </form>
+        )}
+        {methods.password && !challengeToken && (
         <form onSubmit={handleSubmit(onSubmit)}>
           <CardContent className="space-y-4">
             {error && (
@@ -94,6 +192,14 @@ const Login: React.FC = () => {
             </Button>
           </CardFooter>
         </form>
+        )}
+        {methods.oidc && !challengeToken && (
+          <CardFooter>
+            <Button asChild variant="outline" className="w-full">
+              <a href={oidcLoginUrl}>Sign in with SSO</a>
+            </Button>
+          </CardFooter>
+        )}
       </Card>
     </div>
   );
@@ -17,6 +17,11 @@ export default defineConfig({
         target: 'http://localhost:8080',
         changeOrigin: true,
       },
+      // Redirects that count clicks on links
+      '/r': {
+        target: 'http://localhost:8080',
+        changeOrigin: true,
+      },
     },
   },
 })